@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"forum/database"
+	"forum/dataset"
+)
+
+// usage describes the command line
+const usage = `Usage: forum [command]
+
+Commands:
+  migrate status     List schema migrations and whether each has been applied
+  migrate up [N]     Apply all pending migrations, or only the next N
+  migrate down [N]   Revert the most recent migration, or the last N
+  repair-counters    Recompute post and comment like, dislike and comment counters
+  backup [DIR]       Copy the live database to a timestamped file in DIR (default: BACKUP_DIR or backups)
+  restore FILE       Check a backup and replace the database with it; stop the server first
+  seed [FLAGS]       Fill an empty database with generated users, posts, comments and votes
+  seed FILE...       Load fixtures from YAML or JSON files (see README)
+  import [-dry-run] FILE
+                     Import users, categories, posts, comments and votes from another forum or an archive (see README)
+  export [-password-hashes] [FILE]
+                     Write a JSON-lines archive of the whole forum to FILE or standard output
+
+With no command the web server is started.
+`
+
+// runCommand runs a maintenance command given on the command line and returns the exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "migrate":
+		return migrateCommand(args)
+	case "repair-counters":
+		return repairCountersCommand()
+	case "backup":
+		return backupCommand(args)
+	case "restore":
+		return restoreCommand(args)
+	case "seed":
+		return seedCommand(args)
+	case "import":
+		return importCommand(args)
+	case "export":
+		return exportCommand(args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+}
+
+// repairCountersCommand recomputes the denormalised counters and reports how many rows were off
+func repairCountersCommand() int {
+	posts, comments, err := database.RepairCounters()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to repair counters: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Repaired counters on %d posts and %d comments.\n", posts, comments)
+	return 0
+}
+
+// backupDir returns where backups go, BACKUP_DIR or "backups"
+func backupDir() string {
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		return dir
+	}
+	return "backups"
+}
+
+// backupKeep returns how many backups to keep, BACKUP_KEEP or 7
+func backupKeep() (int, error) {
+	keep := 7
+	if v := os.Getenv("BACKUP_KEEP"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid BACKUP_KEEP %q: must be a positive number", v)
+		}
+		keep = n
+	}
+	return keep, nil
+}
+
+// backupCommand backs the database up into the given or configured directory, then
+// prunes old backups when BACKUP_KEEP is set
+func backupCommand(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	dir := backupDir()
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	keep, err := backupKeep()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	file, err := database.Backup(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to back up: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Backed up to %s\n", file)
+
+	if os.Getenv("BACKUP_KEEP") != "" {
+		removed, err := database.PruneBackups(dir, keep)
+		for _, f := range removed {
+			fmt.Printf("Removed old backup %s\n", f)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove old backups: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// restoreCommand replaces the database with a backup that passes the integrity checks
+func restoreCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	previous, err := database.Restore(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to restore: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Restored %s. The previous database was kept as %s.\n", args[0], previous)
+	return 0
+}
+
+// migrateCommand shows, applies or reverts schema migrations
+func migrateCommand(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	steps := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "Invalid number of migrations %q\n", args[1])
+			return 2
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "status":
+		states, err := database.MigrationStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migrations: %v\n", err)
+			return 1
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+		return 0
+	case "up":
+		applied, err := database.MigrateUp(steps)
+		for _, m := range applied {
+			fmt.Printf("Applied migration %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to migrate: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date.")
+		}
+		return 0
+	case "down":
+		reverted, err := database.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted migration %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to revert: %v\n", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations to revert.")
+		}
+		return 0
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+// seedCommand loads fixture files given as arguments, or otherwise generates sample
+// content at the chosen scale. Generated content only goes into a forum without users.
+func seedCommand(args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	scaleName := flags.String("scale", "small", "amount of content: small, medium or large")
+	users := flags.Int("users", -1, "number of users, overriding the scale")
+	posts := flags.Int("posts", -1, "number of posts, overriding the scale")
+	comments := flags.Int("comments", -1, "number of comments, overriding the scale")
+	votes := flags.Int("votes", -1, "number of votes and reactions, overriding the scale")
+	seed := flags.Int64("seed", 1, "random seed; the same seed gives the same content")
+	password := flags.String("password", "Dino-password-1", "password for every generated user")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	ctx := context.Background()
+
+	if files := flags.Args(); len(files) > 0 {
+		for _, file := range files {
+			d, err := dataset.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", file, err)
+				return 1
+			}
+			res, err := dataset.Load(ctx, d, dataset.Options{})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", file, err)
+				return 1
+			}
+			fmt.Printf("Loaded %s: %s\n", file, seedSummary(res))
+		}
+		return 0
+	}
+
+	scale, ok := dataset.Scales[*scaleName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown scale %q: use small, medium or large\n", *scaleName)
+		return 2
+	}
+	for _, o := range []struct {
+		value *int
+		field *int
+	}{{users, &scale.Users}, {posts, &scale.Posts}, {comments, &scale.Comments}, {votes, &scale.Votes}} {
+		if *o.value >= 0 {
+			*o.field = *o.value
+		}
+	}
+
+	var existing int
+	if err := database.QueryRow(ctx, database.DB, "SELECT COUNT(*) FROM users").Scan(&existing); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to check the database: %v\n", err)
+		return 1
+	}
+	if existing > 0 {
+		fmt.Fprintf(os.Stderr, "The database already has %d users; seed an empty one, or load fixture files instead.\n", existing)
+		return 1
+	}
+
+	res, err := dataset.Load(ctx, dataset.Generate(scale, *seed, *password, time.Now()), dataset.Options{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to seed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Seeded %s with seed %d. Every user's password is %q.\n", seedSummary(res), *seed, *password)
+	return 0
+}
+
+// seedSummary describes what a load added
+func seedSummary(res dataset.Result) string {
+	s := fmt.Sprintf("%d users, %d new categories, %d posts, %d comments and %d votes", res.Users, res.Categories, res.Posts, res.Comments, res.Votes)
+	if res.ExistingCategories > 0 {
+		s += fmt.Sprintf(" (%d categories already existed)", res.ExistingCategories)
+	}
+	return s
+}
+
+// importCommand loads a file in the interchange format, merging users into existing
+// accounts by email, and reports what was or, with -dry-run, would be added
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "check the file and report what would be imported without writing anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	file := flags.Arg(0)
+
+	d, err := dataset.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", file, err)
+		return 1
+	}
+	res, err := dataset.Load(context.Background(), d, dataset.Options{MergeUsers: true, DryRun: *dryRun})
+	var problems dataset.ValidationError
+	if errors.As(err, &problems) {
+		fmt.Fprintf(os.Stderr, "%s has %d problem(s), nothing was imported:\n", file, len(problems))
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", p)
+		}
+		return 1
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to import %s: %v\n", file, err)
+		return 1
+	}
+
+	if *dryRun {
+		fmt.Printf("Dry run of %s, nothing was written. Importing would add:\n", file)
+	} else {
+		fmt.Printf("Imported %s:\n", file)
+	}
+	fmt.Printf("  users:      %d new, %d merged into existing accounts by email\n", res.Users, res.MergedUsers)
+	fmt.Printf("  categories: %d new, %d matched existing ones by name\n", res.Categories, res.ExistingCategories)
+	fmt.Printf("  posts:      %d\n", res.Posts)
+	fmt.Printf("  comments:   %d\n", res.Comments)
+	fmt.Printf("  votes:      %d (%d duplicates skipped)\n", res.Votes, res.SkippedVotes)
+	if len(res.Renamed) > 0 {
+		fmt.Println("Usernames that were invalid or taken:")
+		for _, r := range res.Renamed {
+			fmt.Printf("  %q -> %s\n", r.From, r.To)
+		}
+	}
+	if len(res.DroppedPasswords) > 0 {
+		fmt.Println("Password hashes that aren't bcrypt were dropped; these users can only sign in through OpenID Connect:")
+		for _, name := range res.DroppedPasswords {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	return 0
+}
+
+// exportCommand writes an archive of the forum to the given file, or standard output
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	hashes := flags.Bool("password-hashes", false, "include password hashes, so users keep their passwords after an import")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	out, report := os.Stdout, os.Stderr
+	file := flags.Arg(0)
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out, report = f, os.Stdout
+	}
+
+	counts, err := dataset.Export(context.Background(), out, dataset.ExportOptions{PasswordHashes: *hashes})
+	if err == nil && file != "" {
+		err = out.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export: %v\n", err)
+		if file != "" {
+			os.Remove(file)
+		}
+		return 1
+	}
+	fmt.Fprintf(report, "Exported %d categories, %d users, %d posts, %d comments and %d votes.\n",
+		counts.Categories, counts.Users, counts.Posts, counts.Comments, counts.Votes)
+	return 0
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the UTC timestamp in backup file names, which sorts oldest first
+const backupTimeFormat = "20060102-150405"
+
+// errPostgresBackup is returned by the backup commands when running on Postgres
+var errPostgresBackup = errors.New("backups of a Postgres database are taken with pg_dump and restored with pg_restore")
+
+// path is the SQLite file opened by InitDB
+var path string
+
+// backupPrefix returns the start of backup file names, the database file name without its extension
+func backupPrefix() string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// Backup writes a consistent copy of the live database to a new timestamped file in
+// dir, without blocking readers or writers, and returns its path
+func Backup(dir string) (string, error) {
+	if Driver == Postgres {
+		return "", errPostgresBackup
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, backupPrefix()+time.Now().UTC().Format(backupTimeFormat)+".db")
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("%s already exists", target)
+	}
+	if _, err := DB.Exec("VACUUM INTO ?", target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// PruneBackups deletes all but the newest keep backups of the database in dir and returns
+// the files removed. Other files in dir are left alone.
+func PruneBackups(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(backupPrefix()) + `\d{8}-\d{6}\.db$`)
+	var backups []string
+	for _, e := range entries {
+		if !e.IsDir() && pattern.MatchString(e.Name()) {
+			backups = append(backups, e.Name())
+		}
+	}
+	sort.Strings(backups)
+
+	var removed []string
+	for len(backups) > keep {
+		name := filepath.Join(dir, backups[0])
+		if err := os.Remove(name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+		backups = backups[1:]
+	}
+	return removed, nil
+}
+
+// Restore replaces the database with the backup at src once it has passed an integrity
+// check. The server must not be running. The replaced database is kept next to it with
+// a timestamped .pre-restore suffix, and its path is returned.
+func Restore(src string) (string, error) {
+	if Driver == Postgres {
+		return "", errPostgresBackup
+	}
+	if err := checkBackup(src); err != nil {
+		return "", fmt.Errorf("%s: %w", src, err)
+	}
+	// Never replace the database kept by an earlier restore
+	previous := path + ".pre-restore-" + time.Now().UTC().Format(backupTimeFormat)
+	if _, err := os.Stat(previous); err == nil {
+		return "", fmt.Errorf("%s already exists", previous)
+	}
+
+	// Closing the last connection checkpoints the WAL and deletes it, so a WAL file
+	// still present afterwards means another process has the database open
+	if err := DB.Close(); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path + "-wal"); err == nil {
+		return "", fmt.Errorf("%s is still in use; stop the server before restoring", path)
+	}
+
+	// Copy next to the database first, so the swap itself is a single rename
+	tmp := path + ".restoring"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(path, previous); err != nil && !os.IsNotExist(err) {
+		os.Remove(tmp)
+		return "", err
+	}
+	os.Remove(path + "-shm")
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+// checkBackup verifies that the file at src is an intact forum database this binary can run
+func checkBackup(src string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", "file:"+src+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("not a readable SQLite database: %w", err)
+	}
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err == nil && msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	rows.Close()
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+
+	var orphans int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&orphans); err != nil {
+		return err
+	}
+	if orphans > 0 {
+		return fmt.Errorf("%d rows reference missing parents", orphans)
+	}
+
+	var latest int
+	if err := db.QueryRow("SELECT IFNULL(MAX(version), 0) FROM schema_migrations").Scan(&latest); err != nil {
+		return fmt.Errorf("not a forum database: %w", err)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if n := len(migrations); n > 0 && latest > migrations[n-1].Version {
+		return fmt.Errorf("schema version %d is newer than this binary supports (%d)", latest, migrations[n-1].Version)
+	}
+	return nil
+}
+
+// copyFile copies src to dst and flushes it to disk
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreKeepsEveryReplacedDatabase(t *testing.T) {
+	dir := t.TempDir()
+	InitDB(SQLite, filepath.Join(dir, "forum.db"))
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := Backup(filepath.Join(dir, "backups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := Restore(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(first), "forum.db.pre-restore-") {
+		t.Errorf("replaced database kept as %s", first)
+	}
+	if err := os.WriteFile(first, []byte("kept"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second restore, even within the same second, leaves the first one's file alone
+	InitDB(SQLite, filepath.Join(dir, "forum.db"))
+	second, err := Restore(backup)
+	if err == nil && second == first {
+		t.Fatalf("second restore reused %s", first)
+	}
+	if data, err := os.ReadFile(first); err != nil || string(data) != "kept" {
+		t.Errorf("database kept by the first restore was overwritten: %q (%v)", data, err)
+	}
+	DB.Close()
+}
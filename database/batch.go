@@ -0,0 +1,28 @@
+package database
+
+import "strings"
+
+// maxBatch caps how many IDs go into one IN (...) list, well below SQLite's bound parameter limit
+const maxBatch = 500
+
+// InClause returns "?, ?, ..." with one placeholder per ID, and the IDs as query arguments
+func InClause(ids []int) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// Batches splits ids into slices small enough for one IN (...) list each
+func Batches(ids []int) [][]int {
+	var out [][]int
+	for len(ids) > maxBatch {
+		out = append(out, ids[:maxBatch])
+		ids = ids[maxBatch:]
+	}
+	if len(ids) > 0 {
+		out = append(out, ids)
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+)
+
+// counterColumns are the denormalised counters kept up to date by the triggers in the baseline migration
+var counterColumns = []struct {
+	table  string
+	column string
+}{
+	{"posts", "like_count"},
+	{"posts", "dislike_count"},
+	{"posts", "comment_count"},
+	{"comments", "like_count"},
+	{"comments", "dislike_count"},
+}
+
+// addCounterColumns adds the counter columns to databases created before they existed.
+// Reports whether any column was added, in which case the counters need recomputing.
+func addCounterColumns() (bool, error) {
+	added := false
+	for _, c := range counterColumns {
+		var exists int
+		err := DB.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&exists)
+		if err != nil {
+			return added, err
+		}
+		if exists > 0 {
+			continue
+		}
+		if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER NOT NULL DEFAULT 0", c.table, c.column)); err != nil {
+			return added, err
+		}
+		added = true
+	}
+	return added, nil
+}
+
+// RepairCounters recomputes every post and comment counter from the reactions and
+// comments tables, fixing any that have drifted. Returns how many posts and comments were corrected.
+func RepairCounters() (posts int64, comments int64, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE posts
+		SET like_count = actual.likes, dislike_count = actual.dislikes, comment_count = actual.comments
+		FROM (
+			SELECT posts.id,
+			       (SELECT COUNT(*) FROM reactions WHERE reactions.post_id = posts.id AND reactions.reaction = 'like') AS likes,
+			       (SELECT COUNT(*) FROM reactions WHERE reactions.post_id = posts.id AND reactions.reaction = 'dislike') AS dislikes,
+			       (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id) AS comments
+			FROM posts
+		) AS actual
+		WHERE posts.id = actual.id
+		  AND (posts.like_count != actual.likes OR posts.dislike_count != actual.dislikes OR posts.comment_count != actual.comments)
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("posts: %w", err)
+	}
+	posts, _ = res.RowsAffected()
+
+	res, err = tx.Exec(`
+		UPDATE comments
+		SET like_count = actual.likes, dislike_count = actual.dislikes
+		FROM (
+			SELECT comments.id,
+			       (SELECT COUNT(*) FROM reactions WHERE reactions.comment_id = comments.id AND reactions.reaction = 'like') AS likes,
+			       (SELECT COUNT(*) FROM reactions WHERE reactions.comment_id = comments.id AND reactions.reaction = 'dislike') AS dislikes
+			FROM comments
+		) AS actual
+		WHERE comments.id = actual.id
+		  AND (comments.like_count != actual.likes OR comments.dislike_count != actual.dislikes)
+	`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("comments: %w", err)
+	}
+	comments, _ = res.RowsAffected()
+
+	return posts, comments, tx.Commit()
+}
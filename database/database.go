@@ -2,29 +2,39 @@ package database
 
 import (
 	"database/sql"
-	"fmt"
-	"io/ioutil"
 	"log"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
-// InitDB opens the SQLite database and runs the schema migration.
-func InitDB(dbPath string, schemaPath string) {
+// InitDB opens the database: a SQLite file at source, or with driver Postgres the
+// server named by the connection string in source. MigrateOnStartup brings its
+// schema up to date.
+func InitDB(driver, source string) {
 	var err error
+	Driver = driver
 
-	// Open the SQLite database file (creates it if it doesn't exist)
-	DB, err = sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+	if driver == Postgres {
+		DB, err = sql.Open("postgres", source)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		if err := DB.Ping(); err != nil {
+			log.Fatalf("Failed to connect to Postgres: %v", err)
+		}
+		return
 	}
 
-	// Enable foreign key constraints
-	_, err = DB.Exec("PRAGMA foreign_keys = ON")
+	// Open the SQLite database file (creates it if it doesn't exist).
+	// Foreign keys are enabled through the DSN so that every pooled connection
+	// enforces them, not just the first one.
+	path = source
+	DB, err = sql.Open("sqlite3", source+"?_foreign_keys=on")
 	if err != nil {
-		log.Printf("Warning: Failed to enable foreign keys: %v", err)
+		log.Fatalf("Failed to open database: %v", err)
 	}
 
 	// Enable WAL mode for better concurrency and transaction handling
@@ -32,18 +42,30 @@ func InitDB(dbPath string, schemaPath string) {
 	if err != nil {
 		log.Printf("Warning: Failed to enable WAL mode: %v", err)
 	}
+}
 
-	// Read the schema.sql file
-	schema, err := ioutil.ReadFile(schemaPath)
-	if err != nil {
-		log.Fatalf("Failed to read schema file: %v", err)
+// MigrateOnStartup applies any pending schema migrations, or with apply unset only
+// warns about them
+func MigrateOnStartup(apply bool) {
+	if !apply {
+		pending, err := PendingMigrations()
+		if err != nil {
+			log.Fatalf("Failed to read schema migrations: %v", err)
+		}
+		if len(pending) > 0 {
+			log.Printf("Warning: %d schema migration(s) pending; run `forum migrate up` to apply them", len(pending))
+		}
+		return
 	}
 
-	// Execute the schema SQL to create tables
-	_, err = DB.Exec(string(schema))
+	applied, err := MigrateUp(0)
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
 	if err != nil {
-		log.Fatalf("Failed to execute schema: %v", err)
+		log.Fatalf("Failed to migrate schema: %v", err)
 	}
 
-	fmt.Println("Database initialized and schema migrated.")
+	// Logged rather than printed, so commands such as export can write to standard output
+	log.Println("Database initialized and schema migrated.")
 }
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Supported database drivers, as passed to sql.Open
+const (
+	SQLite   = "sqlite3"
+	Postgres = "postgres"
+)
+
+// Driver is the driver the database was opened with
+var Driver = SQLite
+
+// Rebind rewrites the ? placeholders in query to Postgres's $1, $2, ... when running on
+// Postgres, so queries outside the store can be written once for both databases.
+// Exec, Query and QueryRow apply it. Question marks inside quoted strings are left alone.
+func Rebind(query string) string {
+	if Driver != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
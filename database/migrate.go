@@ -0,0 +1,248 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Each driver has its own copy of every migration, under migrations/<driver name>
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// migrationDir returns the directory holding the migrations for the open database
+func migrationDir() string {
+	if Driver == Postgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+// migrationName matches files like 0002_add_user_bio.up.sql
+var migrationName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and, if it has been applied, when
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the migrations embedded in the binary for the open database, oldest first
+func Migrations() ([]Migration, error) {
+	dir := migrationDir()
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := migrationFiles.ReadFile(dir + "/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates the table recording which migrations have been applied
+func ensureMigrationsTable() error {
+	_, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	return err
+}
+
+// appliedMigrations returns when each applied migration version was applied
+func appliedMigrations() (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	rows, err := DB.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, ScanTime(&at)); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every known migration and whether it has been applied
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		at, ok := applied[m.Version]
+		states[i] = MigrationState{Migration: m, Applied: ok, AppliedAt: at}
+	}
+	return states, nil
+}
+
+// PendingMigrations returns the migrations that have not been applied yet
+func PendingMigrations() ([]Migration, error) {
+	states, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range states {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies up to steps pending migrations (all of them if steps <= 0), each in
+// its own transaction, and returns the ones applied
+func MigrateUp(steps int) ([]Migration, error) {
+	pending, err := PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+
+	// Databases created before versioned migrations already hold the tables but have no
+	// record of the baseline; it is idempotent, so it is applied like any other migration
+	legacy := false
+	if Driver == SQLite && len(pending) > 0 && pending[0].Version == 1 {
+		var tables int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&tables); err != nil {
+			return nil, err
+		}
+		legacy = tables > 0
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		if err := runMigration(m.Version, m.Name, m.Up, true); err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+		if m.Version == 1 && legacy {
+			if err := upgradeLegacyCounters(); err != nil {
+				return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the steps most recently applied migrations (one if steps <= 0)
+// and returns the ones reverted
+func MigrateDown(steps int) ([]Migration, error) {
+	states, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	if steps <= 0 {
+		steps = 1
+	}
+	var done []Migration
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		m := states[i]
+		if !m.Applied {
+			continue
+		}
+		if err := runMigration(m.Version, m.Name, m.Down, false); err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m.Migration)
+	}
+	return done, nil
+}
+
+// runMigration executes one migration's SQL and records (up) or forgets (down) it atomically
+func runMigration(version int, name string, body string, up bool) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(body); err != nil {
+		return err
+	}
+	if up {
+		_, err = tx.Exec(Rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), version, name)
+	} else {
+		_, err = tx.Exec(Rebind("DELETE FROM schema_migrations WHERE version = ?"), version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upgradeLegacyCounters adds and fills in the counter columns on databases created
+// before they were part of the baseline schema
+func upgradeLegacyCounters() error {
+	added, err := addCounterColumns()
+	if err != nil {
+		return err
+	}
+	if added {
+		_, _, err = RepairCounters()
+	}
+	return err
+}
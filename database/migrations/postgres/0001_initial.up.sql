@@ -0,0 +1,214 @@
+-- Baseline schema for Postgres, matching the SQLite baseline table for table.
+-- Timestamps are TIMESTAMPTZ and flags are BOOLEAN. The legacy likes table is
+-- left out since no Postgres database predates reactions. Later schema changes
+-- belong in new numbered migrations, one for each database.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_token TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- External OpenID Connect identities linked to local users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+
+-- Pending account deletions, executed once the grace period has passed
+CREATE TABLE IF NOT EXISTS account_deletions (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    mode TEXT NOT NULL CHECK (mode IN ('anonymise', 'remove')),
+    requested_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    execute_after TIMESTAMPTZ NOT NULL
+);
+
+-- History of username and email changes (old usernames keep redirecting to the profile)
+CREATE TABLE IF NOT EXISTS account_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    field TEXT NOT NULL CHECK (field IN ('username', 'email')),
+    old_value TEXT NOT NULL,
+    new_value TEXT NOT NULL,
+    changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Posts table
+CREATE TABLE IF NOT EXISTS posts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    like_count INTEGER NOT NULL DEFAULT 0,
+    dislike_count INTEGER NOT NULL DEFAULT 0,
+    comment_count INTEGER NOT NULL DEFAULT 0
+);
+
+-- Comments table
+CREATE TABLE IF NOT EXISTS comments (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    like_count INTEGER NOT NULL DEFAULT 0,
+    dislike_count INTEGER NOT NULL DEFAULT 0
+);
+
+-- Categories table
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+-- Post-Categories (many-to-many)
+CREATE TABLE IF NOT EXISTS post_categories (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, category_id)
+);
+
+-- Emoji reactions on posts and comments; like and dislike are two of the reaction types
+CREATE TABLE IF NOT EXISTS reactions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    reaction TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (
+        (post_id IS NOT NULL AND comment_id IS NULL) OR
+        (post_id IS NULL AND comment_id IS NOT NULL)
+    )
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_post ON reactions (user_id, post_id, reaction) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_comment ON reactions (user_id, comment_id, reaction) WHERE comment_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_reactions_post ON reactions (post_id);
+CREATE INDEX IF NOT EXISTS idx_reactions_comment ON reactions (comment_id);
+
+-- Keep the denormalised like/dislike/comment counters in step with reactions and
+-- comments; `forum repair-counters` recomputes them if they ever drift
+CREATE OR REPLACE FUNCTION count_reactions() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('DELETE', 'UPDATE') THEN
+        UPDATE posts SET like_count = like_count - (OLD.reaction = 'like')::int,
+                         dislike_count = dislike_count - (OLD.reaction = 'dislike')::int
+            WHERE id = OLD.post_id;
+        UPDATE comments SET like_count = like_count - (OLD.reaction = 'like')::int,
+                            dislike_count = dislike_count - (OLD.reaction = 'dislike')::int
+            WHERE id = OLD.comment_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE posts SET like_count = like_count + (NEW.reaction = 'like')::int,
+                         dislike_count = dislike_count + (NEW.reaction = 'dislike')::int
+            WHERE id = NEW.post_id;
+        UPDATE comments SET like_count = like_count + (NEW.reaction = 'like')::int,
+                            dislike_count = dislike_count + (NEW.reaction = 'dislike')::int
+            WHERE id = NEW.comment_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_reactions_count_insert ON reactions;
+CREATE TRIGGER trg_reactions_count_insert AFTER INSERT ON reactions
+    FOR EACH ROW WHEN (NEW.reaction IN ('like', 'dislike')) EXECUTE FUNCTION count_reactions();
+
+DROP TRIGGER IF EXISTS trg_reactions_count_delete ON reactions;
+CREATE TRIGGER trg_reactions_count_delete AFTER DELETE ON reactions
+    FOR EACH ROW WHEN (OLD.reaction IN ('like', 'dislike')) EXECUTE FUNCTION count_reactions();
+
+DROP TRIGGER IF EXISTS trg_reactions_count_update ON reactions;
+CREATE TRIGGER trg_reactions_count_update AFTER UPDATE OF reaction ON reactions
+    FOR EACH ROW WHEN (OLD.reaction IS DISTINCT FROM NEW.reaction) EXECUTE FUNCTION count_reactions();
+
+CREATE OR REPLACE FUNCTION count_comments() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE posts SET comment_count = comment_count + 1 WHERE id = NEW.post_id;
+    ELSE
+        UPDATE posts SET comment_count = comment_count - 1 WHERE id = OLD.post_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_comments_count_insert ON comments;
+CREATE TRIGGER trg_comments_count_insert AFTER INSERT ON comments
+    FOR EACH ROW EXECUTE FUNCTION count_comments();
+
+DROP TRIGGER IF EXISTS trg_comments_count_delete ON comments;
+CREATE TRIGGER trg_comments_count_delete AFTER DELETE ON comments
+    FOR EACH ROW EXECUTE FUNCTION count_comments();
+
+-- In-app notifications about activity on a user's content
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    is_read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, is_read);
+
+-- Per-type notification opt-outs; a missing row means the type is enabled
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+-- Users mentioned with @username in posts and comments (comment_id is NULL for the post body)
+CREATE TABLE IF NOT EXISTS mentions (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    notified BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_target ON mentions (post_id, COALESCE(comment_id, 0), user_id);
+
+-- Subscriptions to a post or a category, with the email digest schedule
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE,
+    category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+    frequency TEXT NOT NULL DEFAULT 'daily' CHECK (frequency IN ('immediate', 'daily', 'weekly')),
+    unsubscribe_token TEXT NOT NULL UNIQUE,
+    last_sent_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (
+        (post_id IS NOT NULL AND category_id IS NULL) OR
+        (post_id IS NULL AND category_id IS NOT NULL)
+    )
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_post ON subscriptions (user_id, post_id) WHERE post_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_category ON subscriptions (user_id, category_id) WHERE category_id IS NOT NULL;
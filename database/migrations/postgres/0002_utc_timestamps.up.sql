@@ -0,0 +1,3 @@
+-- TIMESTAMPTZ columns already store instants independent of the server's zone;
+-- this migration only normalises SQLite databases.
+SELECT 1;
@@ -0,0 +1,17 @@
+-- Drops the whole baseline schema, children before the tables they reference.
+-- Triggers and indexes go with their tables.
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS mentions;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS reactions;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS post_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS account_changes;
+DROP TABLE IF EXISTS account_deletions;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,254 @@
+-- Baseline schema. Everything here is idempotent (IF NOT EXISTS and re-runnable
+-- data fixes) so it can also be applied to databases created before versioned
+-- migrations existed. Later schema changes belong in new numbered migrations.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL UNIQUE,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions table
+CREATE TABLE IF NOT EXISTS sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    session_token TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- External OpenID Connect identities linked to local users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Pending account deletions, executed once the grace period has passed
+CREATE TABLE IF NOT EXISTS account_deletions (
+    user_id INTEGER PRIMARY KEY,
+    mode TEXT NOT NULL CHECK (mode IN ('anonymise', 'remove')),
+    requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    execute_after DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- History of username and email changes (old usernames keep redirecting to the profile)
+CREATE TABLE IF NOT EXISTS account_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    field TEXT NOT NULL CHECK (field IN ('username', 'email')),
+    old_value TEXT NOT NULL,
+    new_value TEXT NOT NULL,
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Posts table
+CREATE TABLE IF NOT EXISTS posts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    like_count INTEGER NOT NULL DEFAULT 0,
+    dislike_count INTEGER NOT NULL DEFAULT 0,
+    comment_count INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Comments table
+CREATE TABLE IF NOT EXISTS comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    like_count INTEGER NOT NULL DEFAULT 0,
+    dislike_count INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Categories table
+CREATE TABLE IF NOT EXISTS categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+-- Post-Categories (many-to-many)
+CREATE TABLE IF NOT EXISTS post_categories (
+    post_id INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, category_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- Likes table (for both posts and comments). Superseded by reactions below;
+-- kept only so older databases can be migrated.
+CREATE TABLE IF NOT EXISTS likes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER,
+    comment_id INTEGER,
+    is_like BOOLEAN NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    CHECK (
+        (post_id IS NOT NULL AND comment_id IS NULL) OR
+        (post_id IS NULL AND comment_id IS NOT NULL)
+    )
+);
+
+-- One vote per user per post or comment. Older databases may hold duplicate
+-- votes, so keep only the most recent one before enforcing uniqueness.
+DELETE FROM likes WHERE id NOT IN (SELECT MAX(id) FROM likes GROUP BY user_id, post_id, comment_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_likes_user_post ON likes (user_id, post_id) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_likes_user_comment ON likes (user_id, comment_id) WHERE comment_id IS NOT NULL;
+
+-- Emoji reactions on posts and comments; like and dislike are two of the reaction types
+CREATE TABLE IF NOT EXISTS reactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER,
+    comment_id INTEGER,
+    reaction TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    CHECK (
+        (post_id IS NOT NULL AND comment_id IS NULL) OR
+        (post_id IS NULL AND comment_id IS NOT NULL)
+    )
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_post ON reactions (user_id, post_id, reaction) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_comment ON reactions (user_id, comment_id, reaction) WHERE comment_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_reactions_post ON reactions (post_id);
+CREATE INDEX IF NOT EXISTS idx_reactions_comment ON reactions (comment_id);
+
+-- Move votes from the legacy likes table into reactions. The likes table is
+-- left empty afterwards, so this is a no-op on every later start.
+INSERT OR IGNORE INTO reactions (user_id, post_id, comment_id, reaction, created_at)
+    SELECT user_id, post_id, comment_id, CASE WHEN is_like THEN 'like' ELSE 'dislike' END, created_at FROM likes;
+DELETE FROM likes;
+
+-- Keep the denormalised like/dislike/comment counters in step with reactions and
+-- comments. Databases from before the counters get the columns (and a full
+-- recount) when this baseline is applied; `forum repair-counters` recomputes
+-- them if they ever drift.
+CREATE TRIGGER IF NOT EXISTS trg_reactions_count_insert AFTER INSERT ON reactions
+WHEN NEW.reaction IN ('like', 'dislike')
+BEGIN
+    UPDATE posts SET like_count = like_count + (NEW.reaction = 'like'), dislike_count = dislike_count + (NEW.reaction = 'dislike')
+        WHERE id = NEW.post_id;
+    UPDATE comments SET like_count = like_count + (NEW.reaction = 'like'), dislike_count = dislike_count + (NEW.reaction = 'dislike')
+        WHERE id = NEW.comment_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_reactions_count_delete AFTER DELETE ON reactions
+WHEN OLD.reaction IN ('like', 'dislike')
+BEGIN
+    UPDATE posts SET like_count = like_count - (OLD.reaction = 'like'), dislike_count = dislike_count - (OLD.reaction = 'dislike')
+        WHERE id = OLD.post_id;
+    UPDATE comments SET like_count = like_count - (OLD.reaction = 'like'), dislike_count = dislike_count - (OLD.reaction = 'dislike')
+        WHERE id = OLD.comment_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_reactions_count_update AFTER UPDATE OF reaction ON reactions
+WHEN OLD.reaction != NEW.reaction
+BEGIN
+    UPDATE posts SET like_count = like_count - (OLD.reaction = 'like') + (NEW.reaction = 'like'),
+                     dislike_count = dislike_count - (OLD.reaction = 'dislike') + (NEW.reaction = 'dislike')
+        WHERE id = NEW.post_id;
+    UPDATE comments SET like_count = like_count - (OLD.reaction = 'like') + (NEW.reaction = 'like'),
+                        dislike_count = dislike_count - (OLD.reaction = 'dislike') + (NEW.reaction = 'dislike')
+        WHERE id = NEW.comment_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_comments_count_insert AFTER INSERT ON comments
+BEGIN
+    UPDATE posts SET comment_count = comment_count + 1 WHERE id = NEW.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_comments_count_delete AFTER DELETE ON comments
+BEGIN
+    UPDATE posts SET comment_count = comment_count - 1 WHERE id = OLD.post_id;
+END;
+
+-- In-app notifications about activity on a user's content
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    post_id INTEGER,
+    comment_id INTEGER,
+    is_read BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, is_read);
+
+-- Per-type notification opt-outs; a missing row means the type is enabled
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Users mentioned with @username in posts and comments (comment_id is NULL for the post body)
+CREATE TABLE IF NOT EXISTS mentions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    comment_id INTEGER,
+    user_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    notified BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_target ON mentions (post_id, IFNULL(comment_id, 0), user_id);
+
+-- Subscriptions to a post or a category, with the email digest schedule
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER,
+    category_id INTEGER,
+    frequency TEXT NOT NULL DEFAULT 'daily' CHECK (frequency IN ('immediate', 'daily', 'weekly')),
+    unsubscribe_token TEXT NOT NULL UNIQUE,
+    last_sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE,
+    CHECK (
+        (post_id IS NOT NULL AND category_id IS NULL) OR
+        (post_id IS NULL AND category_id IS NOT NULL)
+    )
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_post ON subscriptions (user_id, post_id) WHERE post_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_category ON subscriptions (user_id, category_id) WHERE category_id IS NOT NULL;
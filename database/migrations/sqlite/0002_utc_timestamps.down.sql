@@ -0,0 +1,2 @@
+-- The rewritten timestamps mean the same instants as before, so there is nothing to undo.
+SELECT 1;
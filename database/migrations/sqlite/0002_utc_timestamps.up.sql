@@ -0,0 +1,19 @@
+-- Earlier versions stored timestamps set from Go (session expiry, scheduled deletions,
+-- digest times) in Go's own text form, with fractional seconds and whatever zone
+-- offset the server had. Rewrite every timestamp as UTC 'YYYY-MM-DD HH:MM:SS', the
+-- form of CURRENT_TIMESTAMP, so all of them compare correctly. Values SQLite can't
+-- read as a time are left as they are.
+UPDATE users SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE sessions SET expires_at = datetime(expires_at) WHERE datetime(expires_at) IS NOT NULL AND expires_at != datetime(expires_at);
+UPDATE user_identities SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE account_deletions SET requested_at = datetime(requested_at) WHERE datetime(requested_at) IS NOT NULL AND requested_at != datetime(requested_at);
+UPDATE account_deletions SET execute_after = datetime(execute_after) WHERE datetime(execute_after) IS NOT NULL AND execute_after != datetime(execute_after);
+UPDATE account_changes SET changed_at = datetime(changed_at) WHERE datetime(changed_at) IS NOT NULL AND changed_at != datetime(changed_at);
+UPDATE posts SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE comments SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE reactions SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE notifications SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE mentions SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE subscriptions SET last_sent_at = datetime(last_sent_at) WHERE datetime(last_sent_at) IS NOT NULL AND last_sent_at != datetime(last_sent_at);
+UPDATE subscriptions SET created_at = datetime(created_at) WHERE datetime(created_at) IS NOT NULL AND created_at != datetime(created_at);
+UPDATE schema_migrations SET applied_at = datetime(applied_at) WHERE datetime(applied_at) IS NOT NULL AND applied_at != datetime(applied_at);
@@ -0,0 +1,3 @@
+-- Timezone each user reads dates in, as an IANA name such as Europe/Berlin.
+-- Empty means the server's default.
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
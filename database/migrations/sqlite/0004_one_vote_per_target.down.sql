@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reactions_user_comment_vote;
+DROP INDEX IF EXISTS idx_reactions_user_post_vote;
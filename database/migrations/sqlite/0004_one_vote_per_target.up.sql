@@ -0,0 +1,14 @@
+-- A user holds at most one of like and dislike on a post or comment. Where both
+-- were recorded, the most recent vote is kept.
+DELETE FROM reactions
+WHERE reaction IN ('like', 'dislike') AND EXISTS (
+    SELECT 1 FROM reactions newer
+    WHERE newer.user_id = reactions.user_id
+      AND COALESCE(newer.post_id, 0) = COALESCE(reactions.post_id, 0)
+      AND COALESCE(newer.comment_id, 0) = COALESCE(reactions.comment_id, 0)
+      AND newer.reaction IN ('like', 'dislike')
+      AND newer.id > reactions.id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_post_vote ON reactions (user_id, post_id) WHERE comment_id IS NULL AND reaction IN ('like', 'dislike');
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_user_comment_vote ON reactions (user_id, comment_id) WHERE comment_id IS NOT NULL AND reaction IN ('like', 'dislike');
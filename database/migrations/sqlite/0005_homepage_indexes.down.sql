@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_user;
+DROP INDEX IF EXISTS idx_posts_user;
+DROP INDEX IF EXISTS idx_posts_created;
@@ -0,0 +1,5 @@
+-- The homepage lists posts newest first, a page at a time, with the reputation of
+-- each author, which sums the votes on everything they wrote
+CREATE INDEX IF NOT EXISTS idx_posts_created ON posts (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_user ON posts (user_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user ON comments (user_id);
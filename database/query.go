@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// QueryTimeout is the longest a single query may run before it is cancelled; zero or
+// less means no limit. Set from DB_QUERY_TIMEOUT.
+var QueryTimeout = 5 * time.Second
+
+// Querier is what Exec, Query and QueryRow run on: DB or a transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// queryContext limits ctx, usually the request's, to QueryTimeout for one query
+func queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, QueryTimeout)
+}
+
+// Exec runs a statement on q, cancelled when ctx ends or after QueryTimeout. Its ?
+// placeholders are rebound for the driver.
+func Exec(ctx context.Context, q Querier, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	return q.ExecContext(ctx, Rebind(query), args...)
+}
+
+// Rows are the results of Query. Closing them ends the query's deadline.
+type Rows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+// Query runs a query on q like Exec. The rows must be closed.
+func Query(ctx context.Context, q Querier, query string, args ...interface{}) (*Rows, error) {
+	ctx, cancel := queryContext(ctx)
+	rows, err := q.QueryContext(ctx, Rebind(query), args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Rows{rows, cancel}, nil
+}
+
+// Row is the result of QueryRow
+type Row struct {
+	row    *sql.Row
+	cancel context.CancelFunc
+}
+
+// Scan copies the row's columns into dest and ends the query's deadline, like sql.Row.Scan
+func (r *Row) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return r.row.Scan(dest...)
+}
+
+// QueryRow runs a query expected to return at most one row on q like Exec
+func QueryRow(ctx context.Context, q Querier, query string, args ...interface{}) *Row {
+	ctx, cancel := queryContext(ctx)
+	return &Row{q.QueryRowContext(ctx, Rebind(query), args...), cancel}
+}
+
+// IsTimeout reports whether err is a query that ran past its deadline
+func IsTimeout(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" { // query_canceled, e.g. by statement_timeout
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsUnavailable reports whether err means the database couldn't take the query: it was
+// busy or unreachable, or the request was cancelled before the query finished
+func IsUnavailable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// connection_exception, insufficient_resources and cannot_connect_now
+		return pqErr.Code.Class() == "08" || pqErr.Code.Class() == "53" || pqErr.Code == "57P03"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
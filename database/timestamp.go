@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// timestampFormat is how SQLite stores timestamps, the format of CURRENT_TIMESTAMP, always in UTC
+const timestampFormat = "2006-01-02 15:04:05"
+
+// Timestamp reads and writes a time.Time as UTC. Use it for every timestamp column:
+// scan through ScanTime and pass query arguments as Timestamp(t).
+type Timestamp time.Time
+
+// ScanTime returns a scan destination that stores a timestamp column in t, in UTC.
+// NULL, and text the SQLite driver can't parse as a time, leave t zero, which is shown
+// as an unknown date rather than mistaken for the current time.
+func ScanTime(t *time.Time) *Timestamp {
+	return (*Timestamp)(t)
+}
+
+// Scan implements sql.Scanner
+func (ts *Timestamp) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*ts = Timestamp{}
+		return nil
+	case time.Time:
+		*ts = Timestamp(v.UTC())
+		return nil
+	case []byte:
+		return ts.parse(string(v))
+	case string:
+		return ts.parse(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", value)
+	}
+}
+
+// parse reads a timestamp computed by an expression, which the driver hands over as
+// text; ones without a zone are UTC
+func (ts *Timestamp) parse(s string) error {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			*ts = Timestamp(t.UTC())
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+// Value implements driver.Valuer: SQLite gets the CURRENT_TIMESTAMP text form so values
+// compare correctly with column defaults, Postgres a UTC time for its TIMESTAMPTZ columns
+func (ts Timestamp) Value() (driver.Value, error) {
+	t := time.Time(ts).UTC()
+	if Driver == Postgres {
+		return t, nil
+	}
+	return t.Format(timestampFormat), nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampScan(t *testing.T) {
+	want := time.Date(2024, 6, 15, 9, 30, 45, 0, time.UTC)
+	tests := []struct {
+		value interface{}
+		want  time.Time
+	}{
+		// Every text layout the SQLite driver hands over
+		{"2024-06-15 11:30:45.000000000+02:00", want},
+		{"2024-06-15T11:30:45+02:00", want},
+		{"2024-06-15 09:30:45.123", want.Add(123 * time.Millisecond)},
+		{"2024-06-15T09:30:45.5", want.Add(500 * time.Millisecond)},
+		{"2024-06-15 09:30:45", want},
+		{"2024-06-15T09:30:45", want},
+		{"2024-06-15 09:30", want.Truncate(time.Minute)},
+		{"2024-06-15T09:30", want.Truncate(time.Minute)},
+		{"2024-06-15", want.Truncate(24 * time.Hour)},
+		{"2024-06-15T09:30:45Z", want},
+		{" 2024-06-15 09:30:45 ", want},
+		{[]byte("2024-06-15 09:30:45"), want},
+		// Column values the drivers already parsed
+		{want.In(time.FixedZone("CEST", 2*60*60)), want},
+		{nil, time.Time{}},
+	}
+	for _, tt := range tests {
+		var got time.Time
+		if err := ScanTime(&got).Scan(tt.value); err != nil {
+			t.Errorf("Scan(%#v): %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("Scan(%#v) = %v, want %v in UTC", tt.value, got, tt.want)
+		}
+	}
+
+	for _, bad := range []interface{}{"yesterday", "15/06/2024", int64(1718443845)} {
+		got := want
+		if err := ScanTime(&got).Scan(bad); err == nil {
+			t.Errorf("Scan(%#v) = %v, want an error", bad, got)
+		}
+	}
+}
+
+func TestTimestampValue(t *testing.T) {
+	defer func(d string) { Driver = d }(Driver)
+	at := time.Date(2024, 6, 15, 11, 30, 45, 0, time.FixedZone("CEST", 2*60*60))
+
+	Driver = SQLite
+	if v, err := Timestamp(at).Value(); err != nil || v != "2024-06-15 09:30:45" {
+		t.Errorf("SQLite value = %#v (%v), want the CURRENT_TIMESTAMP form in UTC", v, err)
+	}
+
+	Driver = Postgres
+	v, err := Timestamp(at).Value()
+	if tv, ok := v.(time.Time); err != nil || !ok || !tv.Equal(at) || tv.Location() != time.UTC {
+		t.Errorf("Postgres value = %#v (%v), want %v in UTC", v, err, at)
+	}
+}
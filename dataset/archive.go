@@ -0,0 +1,232 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/database"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat names the forum's archive format in its header line
+const ArchiveFormat = "dinoforum-archive"
+
+// ArchiveHeader is the first line of an archive
+type ArchiveHeader struct {
+	Format         string    `json:"format"`
+	Version        int       `json:"version"`
+	ExportedAt     time.Time `json:"exported_at"`
+	PasswordHashes bool      `json:"password_hashes"`
+}
+
+// ArchiveCounts is how many records of each type an archive holds. The last line of an
+// archive repeats them, so a truncated archive is recognised.
+type ArchiveCounts struct {
+	Categories int `json:"categories"`
+	Users      int `json:"users"`
+	Posts      int `json:"posts"`
+	Comments   int `json:"comments"`
+	Votes      int `json:"votes"`
+}
+
+// archiveLine is every line after the header: a record with its type, or the "end"
+// line. Data is the record when writing and json.RawMessage when reading.
+type archiveLine struct {
+	Type   string         `json:"type"`
+	Data   interface{}    `json:"data,omitempty"`
+	Counts *ArchiveCounts `json:"counts,omitempty"`
+}
+
+// ExportOptions change what Export writes
+type ExportOptions struct {
+	// PasswordHashes includes users' password hashes, so they can keep logging in with
+	// their password on the instance the archive is imported into
+	PasswordHashes bool
+}
+
+// Export writes every category, user, post, comment and vote to w as a JSON-lines
+// archive, in that order, one record per line after a header. Records are written as
+// they are read, so memory use doesn't grow with the forum. Titles and content are
+// unescaped back to the text that was entered, as Load expects.
+func Export(ctx context.Context, w io.Writer, opts ExportOptions) (ArchiveCounts, error) {
+	var counts ArchiveCounts
+	// One read-only transaction gives every table the same snapshot
+	tx, err := database.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return counts, err
+	}
+	defer tx.Rollback()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(ArchiveHeader{
+		Format:         ArchiveFormat,
+		Version:        FormatVersion,
+		ExportedAt:     time.Now().UTC(),
+		PasswordHashes: opts.PasswordHashes,
+	})
+	if err != nil {
+		return counts, err
+	}
+	write := func(typ string, record interface{}) error {
+		return enc.Encode(archiveLine{Type: typ, Data: record})
+	}
+
+	// Posts list their categories as a comma-separated string
+	postCategories := "(SELECT group_concat(category_id) FROM post_categories WHERE post_id = posts.id)"
+	if database.Driver == database.Postgres {
+		postCategories = "(SELECT string_agg(category_id::text, ',') FROM post_categories WHERE post_id = posts.id)"
+	}
+
+	tables := []struct {
+		query string
+		count *int
+		write func(rows *sql.Rows) error
+	}{
+		{"SELECT id, name FROM categories ORDER BY id", &counts.Categories, func(rows *sql.Rows) error {
+			var c Category
+			if err := rows.Scan(&c.ID, &c.Name); err != nil {
+				return err
+			}
+			return write("category", c)
+		}},
+		{"SELECT id, username, email, password_hash, timezone, created_at FROM users ORDER BY id", &counts.Users, func(rows *sql.Rows) error {
+			var u User
+			if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.Timezone, database.ScanTime(&u.CreatedAt)); err != nil {
+				return err
+			}
+			if !opts.PasswordHashes {
+				u.PasswordHash = ""
+			}
+			return write("user", u)
+		}},
+		{"SELECT id, user_id, title, content, created_at, " + postCategories + " FROM posts ORDER BY id", &counts.Posts, func(rows *sql.Rows) error {
+			var p Post
+			var categoryIDs sql.NullString
+			if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, database.ScanTime(&p.CreatedAt), &categoryIDs); err != nil {
+				return err
+			}
+			for _, id := range strings.Split(categoryIDs.String, ",") {
+				if n, err := strconv.Atoi(id); err == nil {
+					p.CategoryIDs = append(p.CategoryIDs, n)
+				}
+			}
+			sort.Ints(p.CategoryIDs)
+			p.Title, p.Content = html.UnescapeString(p.Title), html.UnescapeString(p.Content)
+			return write("post", p)
+		}},
+		{"SELECT id, post_id, user_id, content, created_at FROM comments ORDER BY id", &counts.Comments, func(rows *sql.Rows) error {
+			var c Comment
+			if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, database.ScanTime(&c.CreatedAt)); err != nil {
+				return err
+			}
+			c.Content = html.UnescapeString(c.Content)
+			return write("comment", c)
+		}},
+		{"SELECT user_id, post_id, comment_id, reaction, created_at FROM reactions ORDER BY id", &counts.Votes, func(rows *sql.Rows) error {
+			var v Vote
+			var postID, commentID sql.NullInt64
+			if err := rows.Scan(&v.UserID, &postID, &commentID, &v.Reaction, database.ScanTime(&v.CreatedAt)); err != nil {
+				return err
+			}
+			v.PostID, v.CommentID = int(postID.Int64), int(commentID.Int64)
+			return write("vote", v)
+		}},
+	}
+	for _, t := range tables {
+		// Not database.Query: the rows stay open while they are written out, which on a
+		// large forum or a slow connection takes longer than QueryTimeout
+		rows, err := tx.QueryContext(ctx, t.query)
+		if err != nil {
+			return counts, err
+		}
+		for rows.Next() {
+			if err := t.write(rows); err != nil {
+				rows.Close()
+				return counts, err
+			}
+			*t.count++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return counts, err
+		}
+	}
+
+	if err := enc.Encode(archiveLine{Type: "end", Counts: &counts}); err != nil {
+		return counts, err
+	}
+	return counts, bw.Flush()
+}
+
+// ReadArchive reads an archive written by Export into a dataset. Unlike Export it
+// isn't streamed: the whole dataset is held in memory, because Load validates every
+// reference before it writes anything and imports it in one transaction. Importing
+// needs memory roughly in proportion to the archive, a few times its size on disk.
+func ReadArchive(r io.Reader) (*Dataset, error) {
+	dec := json.NewDecoder(r)
+	var header ArchiveHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if header.Format != ArchiveFormat {
+		return nil, fmt.Errorf("not a forum archive")
+	}
+	if header.Version > FormatVersion {
+		return nil, fmt.Errorf("archive version %d is newer than this forum understands (%d)", header.Version, FormatVersion)
+	}
+
+	d := &Dataset{Version: header.Version, fromArchive: true}
+	for line := 2; ; line++ {
+		var data json.RawMessage
+		l := archiveLine{Data: &data}
+		if err := dec.Decode(&l); errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive is truncated: it ends without an end line")
+		} else if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var record interface{}
+		switch l.Type {
+		case "category":
+			d.Categories = append(d.Categories, Category{})
+			record = &d.Categories[len(d.Categories)-1]
+		case "user":
+			d.Users = append(d.Users, User{})
+			record = &d.Users[len(d.Users)-1]
+		case "post":
+			d.Posts = append(d.Posts, Post{})
+			record = &d.Posts[len(d.Posts)-1]
+		case "comment":
+			d.Comments = append(d.Comments, Comment{})
+			record = &d.Comments[len(d.Comments)-1]
+		case "vote":
+			d.Votes = append(d.Votes, Vote{})
+			record = &d.Votes[len(d.Votes)-1]
+		case "end":
+			got := ArchiveCounts{len(d.Categories), len(d.Users), len(d.Posts), len(d.Comments), len(d.Votes)}
+			if l.Counts == nil || *l.Counts != got {
+				return nil, fmt.Errorf("line %d: archive holds %+v but its end line says %+v", line, got, l.Counts)
+			}
+			return d, nil
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %q", line, l.Type)
+		}
+
+		rd := json.NewDecoder(bytes.NewReader(data))
+		rd.DisallowUnknownFields()
+		if err := rd.Decode(record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
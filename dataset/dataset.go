@@ -0,0 +1,220 @@
+// Package dataset holds forum content in a portable form, independent of database IDs:
+// fixtures read from YAML or JSON files and generated sample data, which Load inserts.
+package dataset
+
+import (
+	"fmt"
+	"forum/utils"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FormatVersion is the version of the interchange format this forum reads and writes
+const FormatVersion = 1
+
+// Dataset is a set of users, categories, posts, comments and votes. IDs are local to
+// the dataset and only link its records together; Load assigns new database IDs.
+type Dataset struct {
+	Version    int        `json:"version,omitempty" yaml:"version,omitempty"`
+	Users      []User     `json:"users,omitempty" yaml:"users,omitempty"`
+	Categories []Category `json:"categories,omitempty" yaml:"categories,omitempty"`
+	Posts      []Post     `json:"posts,omitempty" yaml:"posts,omitempty"`
+	Comments   []Comment  `json:"comments,omitempty" yaml:"comments,omitempty"`
+	Votes      []Vote     `json:"votes,omitempty" yaml:"votes,omitempty"`
+
+	// fromArchive is set by ReadArchive. An archive holds what a forum already
+	// contains, so Validate also accepts the deleted-user placeholder and posts that
+	// older versions saved without a category.
+	fromArchive bool
+}
+
+// User is an account. Without a password or a bcrypt PasswordHash it can only sign in
+// through OpenID Connect.
+type User struct {
+	ID           int       `json:"id" yaml:"id"`
+	Username     string    `json:"username" yaml:"username"`
+	Email        string    `json:"email" yaml:"email"`
+	Password     string    `json:"password,omitempty" yaml:"password,omitempty"` // plain text, hashed on load
+	PasswordHash string    `json:"password_hash,omitempty" yaml:"password_hash,omitempty"`
+	Timezone     string    `json:"timezone,omitempty" yaml:"timezone,omitempty"` // IANA name; empty for the forum's default
+	CreatedAt    time.Time `json:"created_at" yaml:"created_at,omitempty"`
+}
+
+// Category is a topic posts are filed under. Categories are matched to existing ones by name.
+type Category struct {
+	ID   int    `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+}
+
+// Post is a post by UserID filed under CategoryIDs
+type Post struct {
+	ID          int       `json:"id" yaml:"id"`
+	UserID      int       `json:"user_id" yaml:"user_id"`
+	Title       string    `json:"title" yaml:"title"`
+	Content     string    `json:"content" yaml:"content"`
+	CategoryIDs []int     `json:"category_ids" yaml:"category_ids"`
+	CreatedAt   time.Time `json:"created_at" yaml:"created_at,omitempty"`
+}
+
+// Comment is a comment by UserID on PostID
+type Comment struct {
+	ID        int       `json:"id" yaml:"id"`
+	PostID    int       `json:"post_id" yaml:"post_id"`
+	UserID    int       `json:"user_id" yaml:"user_id"`
+	Content   string    `json:"content" yaml:"content"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at,omitempty"`
+}
+
+// Vote is a reaction by UserID on a post or, when CommentID is set, a comment. Reaction
+// is like, dislike or another reaction key such as heart.
+type Vote struct {
+	UserID    int       `json:"user_id" yaml:"user_id"`
+	PostID    int       `json:"post_id,omitempty" yaml:"post_id,omitempty"`
+	CommentID int       `json:"comment_id,omitempty" yaml:"comment_id,omitempty"`
+	Reaction  string    `json:"reaction" yaml:"reaction"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at,omitempty"`
+}
+
+// Limits matching what the forum accepts from its forms
+const (
+	maxTitleLength   = 100
+	maxContentLength = 1000
+)
+
+// reactionPattern is the rule for reaction keys
+var reactionPattern = regexp.MustCompile(`^[a-z0-9_]{1,20}$`)
+
+// validUsername applies the forum's registration rule for usernames
+func validUsername(username string) bool {
+	valid, _ := utils.ValidateUsername(username)
+	return valid
+}
+
+// isDeletedPlaceholder reports whether u is the account anonymised content is
+// credited to
+func isDeletedPlaceholder(u User) bool {
+	return u.Username == utils.DeletedUsername && u.Email == utils.DeletedEmail
+}
+
+// ValidationError lists everything wrong with a dataset, one problem per entry
+type ValidationError []string
+
+// Error implements error
+func (e ValidationError) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// Validate checks that every record is complete and every reference points at a record
+// in the dataset, so Load doesn't fail halfway on bad input. It returns a
+// ValidationError listing all problems found.
+func (d *Dataset) Validate() error {
+	var problems ValidationError
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if d.Version > FormatVersion {
+		problem("version %d is newer than this forum understands (%d)", d.Version, FormatVersion)
+	}
+
+	users := map[int]bool{}
+	usernames := map[string]bool{}
+	emails := map[string]bool{}
+	for i, u := range d.Users {
+		placeholder := d.fromArchive && isDeletedPlaceholder(u)
+		switch {
+		case u.ID == 0 || users[u.ID]:
+			problem("users[%d]: missing or duplicate id %d", i, u.ID)
+		case !validUsername(u.Username) && !placeholder:
+			problem("users[%d]: username %q must be 3-20 letters, digits, underscores or hyphens", i, u.Username)
+		case !utils.ValidateEmail(u.Email) && !placeholder:
+			problem("users[%d]: invalid email %q", i, u.Email)
+		case emails[u.Email]:
+			problem("users[%d]: duplicate email %q", i, u.Email)
+		case usernames[u.Username]:
+			problem("users[%d]: duplicate username %q", i, u.Username)
+		case u.Password != "" && u.PasswordHash != "":
+			problem("users[%d]: has both password and password_hash", i)
+		case u.Timezone != "" && !utils.ValidTimezone(u.Timezone):
+			problem("users[%d]: unknown timezone %q", i, u.Timezone)
+		}
+		users[u.ID], usernames[u.Username], emails[u.Email] = true, true, true
+	}
+
+	categories := map[int]bool{}
+	for i, c := range d.Categories {
+		if c.ID == 0 || categories[c.ID] {
+			problem("categories[%d]: missing or duplicate id %d", i, c.ID)
+		} else if n := utf8.RuneCountInString(c.Name); n < 2 || n > 30 {
+			problem("categories[%d]: name %q must be 2-30 characters long", i, c.Name)
+		}
+		categories[c.ID] = true
+	}
+
+	posts := map[int]bool{}
+	for i, p := range d.Posts {
+		switch {
+		case p.ID == 0 || posts[p.ID]:
+			problem("posts[%d]: missing or duplicate id %d", i, p.ID)
+		case !users[p.UserID]:
+			problem("posts[%d]: unknown user_id %d", i, p.UserID)
+		case p.Title == "" || p.Content == "":
+			problem("posts[%d]: missing title or content", i)
+		case len(p.Title) > maxTitleLength || len(p.Content) > maxContentLength:
+			problem("posts[%d]: title or content too long (at most %d and %d bytes)", i, maxTitleLength, maxContentLength)
+		case len(p.CategoryIDs) == 0 && !d.fromArchive:
+			problem("posts[%d]: needs at least one category", i)
+		}
+		for _, id := range p.CategoryIDs {
+			if !categories[id] {
+				problem("posts[%d]: unknown category id %d", i, id)
+			}
+		}
+		posts[p.ID] = true
+	}
+
+	comments := map[int]bool{}
+	for i, c := range d.Comments {
+		switch {
+		case c.ID == 0 || comments[c.ID]:
+			problem("comments[%d]: missing or duplicate id %d", i, c.ID)
+		case !posts[c.PostID]:
+			problem("comments[%d]: unknown post_id %d", i, c.PostID)
+		case !users[c.UserID]:
+			problem("comments[%d]: unknown user_id %d", i, c.UserID)
+		case c.Content == "" || len(c.Content) > maxContentLength:
+			problem("comments[%d]: content must be 1-%d bytes", i, maxContentLength)
+		}
+		comments[c.ID] = true
+	}
+
+	// A user holds at most one of like and dislike on a post or comment
+	type target struct{ user, post, comment int }
+	votes := map[target]string{}
+	for i, v := range d.Votes {
+		switch {
+		case !users[v.UserID]:
+			problem("votes[%d]: unknown user_id %d", i, v.UserID)
+		case (v.PostID == 0) == (v.CommentID == 0):
+			problem("votes[%d]: needs exactly one of post_id and comment_id", i)
+		case v.PostID != 0 && !posts[v.PostID]:
+			problem("votes[%d]: unknown post_id %d", i, v.PostID)
+		case v.CommentID != 0 && !comments[v.CommentID]:
+			problem("votes[%d]: unknown comment_id %d", i, v.CommentID)
+		case !reactionPattern.MatchString(v.Reaction):
+			problem("votes[%d]: invalid reaction %q", i, v.Reaction)
+		case v.Reaction == "like" || v.Reaction == "dislike":
+			t := target{v.UserID, v.PostID, v.CommentID}
+			if previous, ok := votes[t]; ok && previous != v.Reaction {
+				problem("votes[%d]: user %d both likes and dislikes the same target", i, v.UserID)
+			}
+			votes[t] = v.Reaction
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
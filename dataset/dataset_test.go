@@ -0,0 +1,153 @@
+package dataset
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	scale := Scales["small"]
+
+	a := Generate(scale, 42, "secret", now)
+	b := Generate(scale, 42, "secret", now)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("the same seed gave different datasets")
+	}
+	if reflect.DeepEqual(a, Generate(scale, 43, "secret", now)) {
+		t.Error("different seeds gave the same dataset")
+	}
+
+	if err := a.Validate(); err != nil {
+		t.Fatalf("generated dataset is invalid:\n%v", err)
+	}
+	if len(a.Users) != scale.Users || len(a.Posts) != scale.Posts || len(a.Comments) != scale.Comments {
+		t.Errorf("got %d users, %d posts and %d comments, want %+v", len(a.Users), len(a.Posts), len(a.Comments), scale)
+	}
+	if len(a.Votes) == 0 || len(a.Votes) > scale.Votes {
+		t.Errorf("got %d votes, want 1-%d", len(a.Votes), scale.Votes)
+	}
+	for _, p := range a.Posts {
+		if p.CreatedAt.After(now) || p.CreatedAt.Before(now.Add(-generatedHistory)) {
+			t.Fatalf("post %d created at %v, outside the 90 days before %v", p.ID, p.CreatedAt, now)
+		}
+	}
+}
+
+// validFixture returns a small dataset that passes Validate
+func validFixture() *Dataset {
+	return &Dataset{
+		Version: FormatVersion,
+		Users: []User{
+			{ID: 1, Username: "rex", Email: "rex@example.com", Password: "roar"},
+			{ID: 2, Username: "trike", Email: "trike@example.com", Timezone: "Europe/Berlin"},
+		},
+		Categories: []Category{{ID: 1, Name: "Fossils"}},
+		Posts:      []Post{{ID: 1, UserID: 1, Title: "Found a tooth", Content: "Look", CategoryIDs: []int{1}}},
+		Comments:   []Comment{{ID: 1, PostID: 1, UserID: 2, Content: "Nice"}},
+		Votes: []Vote{
+			{UserID: 2, PostID: 1, Reaction: "like"},
+			{UserID: 2, PostID: 1, Reaction: "heart"},
+			{UserID: 1, CommentID: 1, Reaction: "dislike"},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validFixture().Validate(); err != nil {
+		t.Fatalf("valid fixture rejected:\n%v", err)
+	}
+
+	tests := []struct {
+		name  string
+		spoil func(d *Dataset)
+		want  string
+	}{
+		{"newer version", func(d *Dataset) { d.Version = FormatVersion + 1 }, "version 2 is newer"},
+		{"duplicate user id", func(d *Dataset) { d.Users[1].ID = 1 }, "users[1]: missing or duplicate id 1"},
+		{"bad username", func(d *Dataset) { d.Users[0].Username = "t rex" }, `users[0]: username "t rex"`},
+		{"duplicate email", func(d *Dataset) { d.Users[1].Email = "rex@example.com" }, `users[1]: duplicate email "rex@example.com"`},
+		{"missing email", func(d *Dataset) { d.Users[1].Email = "" }, `users[1]: invalid email ""`},
+		{"email without domain", func(d *Dataset) { d.Users[1].Email = "trike@localhost" }, `users[1]: invalid email "trike@localhost"`},
+		{"two @ in email", func(d *Dataset) { d.Users[1].Email = "trike@home@example.com" }, `users[1]: invalid email`},
+		{"password and hash", func(d *Dataset) { d.Users[0].PasswordHash = "$2a$10$x" }, "users[0]: has both password and password_hash"},
+		{"unknown timezone", func(d *Dataset) { d.Users[1].Timezone = "Mars/Olympus" }, `users[1]: unknown timezone "Mars/Olympus"`},
+		{"short category name", func(d *Dataset) { d.Categories[0].Name = "F" }, "categories[0]: name"},
+		{"post by unknown user", func(d *Dataset) { d.Posts[0].UserID = 9 }, "posts[0]: unknown user_id 9"},
+		{"post in unknown category", func(d *Dataset) { d.Posts[0].CategoryIDs = []int{1, 7} }, "posts[0]: unknown category id 7"},
+		{"post without category", func(d *Dataset) { d.Posts[0].CategoryIDs = nil }, "posts[0]: needs at least one category"},
+		{"long title", func(d *Dataset) { d.Posts[0].Title = strings.Repeat("a", maxTitleLength+1) }, "posts[0]: title or content too long"},
+		{"comment on unknown post", func(d *Dataset) { d.Comments[0].PostID = 5 }, "comments[0]: unknown post_id 5"},
+		{"comment by unknown user", func(d *Dataset) { d.Comments[0].UserID = 5 }, "comments[0]: unknown user_id 5"},
+		{"vote by unknown user", func(d *Dataset) { d.Votes[0].UserID = 3 }, "votes[0]: unknown user_id 3"},
+		{"vote on post and comment", func(d *Dataset) { d.Votes[0].CommentID = 1 }, "votes[0]: needs exactly one of post_id and comment_id"},
+		{"vote on unknown comment", func(d *Dataset) { d.Votes[2].CommentID = 4 }, "votes[2]: unknown comment_id 4"},
+		{"bad reaction", func(d *Dataset) { d.Votes[1].Reaction = "Heart!" }, `votes[1]: invalid reaction "Heart!"`},
+		{"like and dislike", func(d *Dataset) {
+			d.Votes = append(d.Votes, Vote{UserID: 2, PostID: 1, Reaction: "dislike"})
+		}, "votes[3]: user 2 both likes and dislikes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := validFixture()
+			tt.spoil(d)
+			err := d.Validate()
+			if err == nil {
+				t.Fatalf("Validate accepted the dataset, want %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate = %q, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported, not just the first
+	d := validFixture()
+	d.Posts[0].UserID = 9
+	d.Comments[0].UserID = 9
+	if problems, ok := d.Validate().(ValidationError); !ok || len(problems) != 2 {
+		t.Errorf("Validate = %v, want two problems", problems)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	files := []struct {
+		name, content string
+		wantErr       string
+	}{
+		{"ok.json", `{"version": 1, "categories": [{"id": 1, "name": "Fossils"}]}`, ""},
+		{"ok.yaml", "version: 1\ncategories:\n  - id: 1\n    name: Fossils\n", ""},
+		// A misspelt key is an error rather than silently dropped data
+		{"typo.json", `{"version": 1, "categories": [{"id": 1, "nmae": "Fossils"}]}`, `unknown field "nmae"`},
+		{"typo.yml", "version: 1\ncategorys:\n  - id: 1\n    name: Fossils\n", "field categorys not found"},
+		{"fixture.txt", "", "must be a .json, .yaml, .yml or .jsonl file"},
+	}
+	for _, f := range files {
+		d, err := ReadFile(write(f.name, f.content))
+		if f.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", f.name, err)
+			} else if len(d.Categories) != 1 || d.Categories[0].Name != "Fossils" {
+				t.Errorf("%s: categories = %+v", f.name, d.Categories)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), f.wantErr) {
+			t.Errorf("%s: error %v, want it to mention %q", f.name, err, f.wantErr)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadFile reads a dataset from a .json, .yaml or .yml file, or an archive written by
+// Export from a .jsonl file. Unknown fields are errors, so a misspelt key doesn't
+// silently drop data.
+func ReadFile(path string) (*Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var d Dataset
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&d)
+	case ".jsonl":
+		var archive *Dataset
+		if archive, err = ReadArchive(f); err == nil {
+			d = *archive
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(&d)
+	default:
+		return nil, fmt.Errorf("%s: must be a .json, .yaml, .yml or .jsonl file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &d, nil
+}
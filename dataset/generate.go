@@ -0,0 +1,232 @@
+package dataset
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Scale is how much content Generate produces. Votes is an upper bound: a user can't
+// react the same way twice, so small forums may end up with fewer.
+type Scale struct {
+	Users    int
+	Posts    int
+	Comments int
+	Votes    int
+}
+
+// Scales are the named sizes accepted by `forum seed -scale`
+var Scales = map[string]Scale{
+	"small":  {Users: 20, Posts: 50, Comments: 200, Votes: 500},
+	"medium": {Users: 200, Posts: 1000, Comments: 5000, Votes: 20000},
+	"large":  {Users: 2000, Posts: 20000, Comments: 100000, Votes: 400000},
+}
+
+// DefaultCategories are created when the forum first starts, and used by Generate
+var DefaultCategories = []string{"General", "Fossils", "Dino News", "Questions", "Paleontology", "Dino Art", "Research", "Fun Facts"}
+
+// generatedHistory is how far back generated content goes
+const generatedHistory = 90 * 24 * time.Hour
+
+// Generate returns made-up but plausible forum content at the given scale, with every
+// user's password set to password. The same seed and now always give the same dataset;
+// dates are spread over the 90 days before now. Early users are the most active and
+// early posts get the most attention, as on a real forum.
+func Generate(scale Scale, seed int64, password string, now time.Time) *Dataset {
+	r := rand.New(rand.NewSource(seed))
+	now = now.UTC().Truncate(time.Second)
+	start := now.Add(-generatedHistory)
+	d := &Dataset{}
+
+	// popular picks an index below n, favouring low ones
+	popular := func(n int) int {
+		f := r.Float64()
+		return int(float64(n) * f * f)
+	}
+	// after picks a time between t and now, usually soon after t
+	after := func(t time.Time) time.Time {
+		if !t.Before(now) {
+			return now
+		}
+		f := r.Float64()
+		return t.Add(time.Duration(float64(now.Sub(t)) * f * f * f)).Truncate(time.Second)
+	}
+	// later returns whichever of a and b is later
+	later := func(a, b time.Time) time.Time {
+		if a.After(b) {
+			return a
+		}
+		return b
+	}
+
+	for i, name := range append(append([]string{}, DefaultCategories...), extraCategories...) {
+		d.Categories = append(d.Categories, Category{ID: i + 1, Name: name})
+	}
+
+	taken := map[string]bool{}
+	for i := 0; i < scale.Users; i++ {
+		var username string
+		for username == "" || taken[strings.ToLower(username)] {
+			username = fmt.Sprintf("%s%s%d", pick(r, usernameAdjectives), pick(r, usernameDinos), r.Intn(900)+100)
+		}
+		taken[strings.ToLower(username)] = true
+		d.Users = append(d.Users, User{
+			ID:        i + 1,
+			Username:  username,
+			Email:     strings.ToLower(username) + "@example.com",
+			Password:  password,
+			CreatedAt: start.Add(time.Duration(r.Int63n(int64(generatedHistory)))).Truncate(time.Second),
+		})
+	}
+	if len(d.Users) == 0 {
+		return d
+	}
+
+	for i := 0; i < scale.Posts; i++ {
+		author := d.Users[popular(len(d.Users))]
+		categories := r.Perm(len(d.Categories))[:1+r.Intn(3)]
+		var categoryIDs []int
+		for _, c := range categories {
+			categoryIDs = append(categoryIDs, d.Categories[c].ID)
+		}
+		d.Posts = append(d.Posts, Post{
+			ID:          i + 1,
+			UserID:      author.ID,
+			Title:       fill(r, pick(r, titleTemplates)),
+			Content:     paragraph(r, 2+r.Intn(4)),
+			CategoryIDs: categoryIDs,
+			CreatedAt:   after(author.CreatedAt),
+		})
+	}
+	if len(d.Posts) == 0 {
+		return d
+	}
+
+	for i := 0; i < scale.Comments; i++ {
+		post := d.Posts[popular(len(d.Posts))]
+		author := d.Users[popular(len(d.Users))]
+		content := pick(r, commentOpeners)
+		if r.Intn(3) > 0 {
+			content += " " + paragraph(r, 1+r.Intn(2))
+		}
+		d.Comments = append(d.Comments, Comment{
+			ID:        i + 1,
+			PostID:    post.ID,
+			UserID:    author.ID,
+			Content:   content,
+			CreatedAt: after(later(post.CreatedAt, author.CreatedAt)),
+		})
+	}
+
+	// Each user reacts at most once per reaction on a target, and holds only one of like and dislike
+	type target struct{ user, post, comment int }
+	used := map[target]map[string]bool{}
+	for attempts := 0; len(d.Votes) < scale.Votes && attempts < 3*scale.Votes; attempts++ {
+		voter := d.Users[r.Intn(len(d.Users))]
+		v := Vote{UserID: voter.ID, Reaction: pick(r, generatedReactions)}
+		var createdAt time.Time
+		if len(d.Comments) > 0 && r.Intn(5) < 2 {
+			c := d.Comments[popular(len(d.Comments))]
+			v.CommentID, createdAt = c.ID, c.CreatedAt
+		} else {
+			p := d.Posts[popular(len(d.Posts))]
+			v.PostID, createdAt = p.ID, p.CreatedAt
+		}
+		t := target{v.UserID, v.PostID, v.CommentID}
+		if used[t] == nil {
+			used[t] = map[string]bool{}
+		}
+		vote := v.Reaction == "like" || v.Reaction == "dislike"
+		if used[t][v.Reaction] || (vote && (used[t]["like"] || used[t]["dislike"])) {
+			continue
+		}
+		used[t][v.Reaction] = true
+		v.CreatedAt = after(later(createdAt, voter.CreatedAt))
+		d.Votes = append(d.Votes, v)
+	}
+	return d
+}
+
+// pick returns a random element of list
+func pick(r *rand.Rand, list []string) string {
+	return list[r.Intn(len(list))]
+}
+
+// fill replaces each {dino}, {topic} and {place} in template with a random word
+func fill(r *rand.Rand, template string) string {
+	for _, w := range []struct {
+		placeholder string
+		words       []string
+	}{{"{dino}", dinos}, {"{topic}", topics}, {"{place}", places}} {
+		for strings.Contains(template, w.placeholder) {
+			template = strings.Replace(template, w.placeholder, pick(r, w.words), 1)
+		}
+	}
+	return template
+}
+
+// paragraph returns n random sentences
+func paragraph(r *rand.Rand, n int) string {
+	sentences := make([]string, n)
+	for i := range sentences {
+		sentences[i] = fill(r, pick(r, sentenceTemplates))
+	}
+	return strings.Join(sentences, " ")
+}
+
+// generatedReactions weights the reactions generated votes use: mostly likes
+var generatedReactions = []string{"like", "like", "like", "like", "like", "like", "dislike", "dislike", "heart", "laugh", "wow", "sad"}
+
+var extraCategories = []string{"Sauropods", "Theropods", "Fossil Hunting", "Museums", "Dino Movies"}
+
+var usernameAdjectives = []string{"Swift", "Tiny", "Grumpy", "Sleepy", "Mighty", "Clever", "Fuzzy", "Rusty", "Sunny", "Stompy", "Quiet", "Jolly"}
+
+var usernameDinos = []string{"Rex", "Raptor", "Stego", "Trike", "Bronto", "Ptero", "Ankylo", "Spino", "Dilo", "Iguano", "Pachy", "Diplo"}
+
+var dinos = []string{
+	"Tyrannosaurus", "Velociraptor", "Stegosaurus", "Triceratops", "Brachiosaurus", "Spinosaurus",
+	"Ankylosaurus", "Parasaurolophus", "Diplodocus", "Allosaurus", "Iguanodon", "Pachycephalosaurus",
+}
+
+var topics = []string{
+	"feathers", "bite force", "growth rings", "nesting sites", "skin impressions", "tail clubs",
+	"neck posture", "hunting packs", "eggshell colour", "brain size", "running speed", "migration",
+}
+
+var places = []string{
+	"the Hell Creek Formation", "Patagonia", "the Gobi Desert", "Alberta", "the Isle of Wight",
+	"Morocco", "Montana", "Liaoning", "the Morrison Formation", "my local museum",
+}
+
+var titleTemplates = []string{
+	"What do we really know about {dino} {topic}?",
+	"New {dino} find in {place}",
+	"Best places to see {dino} fossils?",
+	"{dino} vs {dino}: who would win?",
+	"Question about {topic}",
+	"My trip to {place}",
+	"Is the {dino} in the movies accurate?",
+	"Paper discussion: {topic} in {dino}",
+	"Drew a {dino}, feedback welcome",
+	"Beginner question: how did {dino} {topic} work?",
+}
+
+var sentenceTemplates = []string{
+	"I always assumed {dino} had impressive {topic}, but the evidence seems mixed.",
+	"A team working in {place} recently described a new {dino} specimen.",
+	"The {topic} of {dino} are still debated among paleontologists.",
+	"Has anyone here been to {place}? I'm planning a visit next year.",
+	"Compared with {dino}, the {topic} of {dino} look surprisingly similar.",
+	"I read that {topic} can tell us a lot about how {dino} lived.",
+	"The museum in {place} has a great {dino} cast on display.",
+	"Honestly, {dino} is underrated and deserves more attention.",
+	"Some researchers think {dino} used its {topic} for display rather than defence.",
+	"Any book recommendations on {topic}?",
+}
+
+var commentOpeners = []string{
+	"Great post!", "Interesting, thanks for sharing.", "I'm not so sure about that.",
+	"This is my favourite topic.", "Do you have a source for this?", "Roar! 🦖",
+	"Same question here.", "Fascinating.", "I disagree, respectfully.", "Thanks, this helped a lot.",
+}
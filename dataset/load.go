@@ -0,0 +1,245 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"forum/database"
+	"forum/utils"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Options change how Load treats data that doesn't fit the forum as it is
+type Options struct {
+	// MergeUsers maps a user whose email already has an account, ignoring case, onto that
+	// account instead of failing, and gives users whose username is invalid or taken a
+	// similar free one. Used when importing from other forums.
+	MergeUsers bool
+	// DryRun rolls everything back once loaded, so the Result reports what would be added
+	DryRun bool
+}
+
+// Rename is a username Load had to change
+type Rename struct {
+	From string
+	To   string
+}
+
+// Result counts what Load added. Categories with the name of an existing one are reused
+// rather than added, and counted in ExistingCategories; votes the database already
+// holds are skipped.
+type Result struct {
+	Users              int
+	MergedUsers        int
+	Categories         int
+	ExistingCategories int
+	Posts              int
+	Comments           int
+	Votes              int
+	SkippedVotes       int
+	Renamed            []Rename
+	// DroppedPasswords are the usernames whose password_hash wasn't a bcrypt hash. Like
+	// users without a password, they can only sign in through OpenID Connect.
+	DroppedPasswords []string
+}
+
+// Load validates the dataset and inserts it in one transaction, so either all of it is
+// added or nothing is. Passwords are hashed, text is escaped the way form input is, and
+// records without a timestamp get the current time.
+func Load(ctx context.Context, d *Dataset, opts Options) (Result, error) {
+	var res Result
+	original := make([]string, len(d.Users))
+	for i, u := range d.Users {
+		original[i] = u.Username
+	}
+	if opts.MergeUsers {
+		fixed := *d
+		fixed.Users = validUsernames(d.Users)
+		d = &fixed
+	}
+	if err := d.Validate(); err != nil {
+		return res, err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	at := func(t time.Time) database.Timestamp {
+		if t.IsZero() {
+			t = now
+		}
+		return database.Timestamp(t)
+	}
+
+	// Generated users often share a password; bcrypt is slow enough to hash each one once
+	hashes := map[string]string{}
+	userIDs := map[int]int{}
+	for i, u := range d.Users {
+		if opts.MergeUsers {
+			var id int
+			err := database.QueryRow(ctx, tx, "SELECT id FROM users WHERE LOWER(email) = LOWER(?)", u.Email).Scan(&id)
+			if err == nil {
+				userIDs[u.ID] = id
+				res.MergedUsers++
+				continue
+			} else if err != sql.ErrNoRows {
+				return res, fmt.Errorf("user %s: %w", u.Username, err)
+			}
+			if u.Username, err = freeUsername(ctx, tx, u.Username); err != nil {
+				return res, fmt.Errorf("user %s: %w", original[i], err)
+			}
+			if u.Username != original[i] {
+				res.Renamed = append(res.Renamed, Rename{original[i], u.Username})
+			}
+		}
+
+		hash, ok := hashes[u.Password]
+		if !ok && u.Password != "" {
+			if hash, err = utils.HashPassword(u.Password); err != nil {
+				return res, err
+			}
+			hashes[u.Password] = hash
+		}
+		if u.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err == nil {
+				hash = u.PasswordHash
+			} else {
+				res.DroppedPasswords = append(res.DroppedPasswords, u.Username)
+			}
+		}
+		var id int
+		err = database.QueryRow(ctx, tx, "INSERT INTO users (email, username, password_hash, timezone, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id",
+			u.Email, u.Username, hash, u.Timezone, at(u.CreatedAt)).Scan(&id)
+		if err != nil {
+			return res, fmt.Errorf("user %s: %w", u.Username, err)
+		}
+		userIDs[u.ID] = id
+		res.Users++
+	}
+
+	categoryIDs := map[int]int{}
+	for _, c := range d.Categories {
+		var id int
+		err := database.QueryRow(ctx, tx, "SELECT id FROM categories WHERE LOWER(name) = LOWER(?)", c.Name).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = database.QueryRow(ctx, tx, "INSERT INTO categories (name) VALUES (?) RETURNING id", c.Name).Scan(&id)
+			res.Categories++
+		} else if err == nil {
+			res.ExistingCategories++
+		}
+		if err != nil {
+			return res, fmt.Errorf("category %s: %w", c.Name, err)
+		}
+		categoryIDs[c.ID] = id
+	}
+
+	postIDs := map[int]int{}
+	for _, p := range d.Posts {
+		var id int
+		err := database.QueryRow(ctx, tx, "INSERT INTO posts (user_id, title, content, created_at) VALUES (?, ?, ?, ?) RETURNING id",
+			userIDs[p.UserID], utils.SanitizeTitle(p.Title), utils.SanitizeHTML(p.Content), at(p.CreatedAt)).Scan(&id)
+		if err != nil {
+			return res, fmt.Errorf("post %d: %w", p.ID, err)
+		}
+		for _, catID := range p.CategoryIDs {
+			if _, err := database.Exec(ctx, tx, "INSERT INTO post_categories (post_id, category_id) VALUES (?, ?) ON CONFLICT DO NOTHING", id, categoryIDs[catID]); err != nil {
+				return res, fmt.Errorf("post %d: %w", p.ID, err)
+			}
+		}
+		postIDs[p.ID] = id
+		res.Posts++
+	}
+
+	commentIDs := map[int]int{}
+	for _, c := range d.Comments {
+		var id int
+		err := database.QueryRow(ctx, tx, "INSERT INTO comments (post_id, user_id, content, created_at) VALUES (?, ?, ?, ?) RETURNING id",
+			postIDs[c.PostID], userIDs[c.UserID], utils.SanitizeHTML(c.Content), at(c.CreatedAt)).Scan(&id)
+		if err != nil {
+			return res, fmt.Errorf("comment %d: %w", c.ID, err)
+		}
+		commentIDs[c.ID] = id
+		res.Comments++
+	}
+
+	for i, v := range d.Votes {
+		var postID, commentID interface{}
+		if v.CommentID != 0 {
+			commentID = commentIDs[v.CommentID]
+		} else {
+			postID = postIDs[v.PostID]
+		}
+		result, err := database.Exec(ctx, tx, "INSERT INTO reactions (user_id, post_id, comment_id, reaction, created_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			userIDs[v.UserID], postID, commentID, v.Reaction, at(v.CreatedAt))
+		if err != nil {
+			return res, fmt.Errorf("vote %d: %w", i, err)
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			res.Votes += int(n)
+		}
+	}
+	res.SkippedVotes = len(d.Votes) - res.Votes
+
+	if opts.DryRun {
+		return res, nil
+	}
+	return res, tx.Commit()
+}
+
+// validUsernames returns a copy of users with every username made valid and unique
+// within the list, such as "Jane Doe" becoming "JaneDoe"
+func validUsernames(users []User) []User {
+	fixed := make([]User, len(users))
+	taken := map[string]bool{}
+	for _, u := range users {
+		if validUsername(u.Username) {
+			taken[u.Username] = true
+		}
+	}
+	for i, u := range users {
+		fixed[i] = u
+		// The placeholder is merged into the forum's own by email, or kept as it is
+		if validUsername(u.Username) || isDeletedPlaceholder(u) {
+			continue
+		}
+		base := utils.UsernameBase(u.Username)
+		name := base
+		for n := 1; taken[name]; n++ {
+			name = fmt.Sprintf("%s%d", base, n)
+		}
+		taken[name] = true
+		fixed[i].Username = name
+	}
+	return fixed
+}
+
+// freeUsername returns username, or if it belongs to an account or still redirects to
+// one after a rename, the first free name made by adding a number
+func freeUsername(ctx context.Context, q database.Querier, username string) (string, error) {
+	base := username
+	if len(base) > 16 {
+		base = base[:16]
+	}
+	candidate := username
+	for i := 1; i < 1000; i++ {
+		var count int
+		err := database.QueryRow(ctx, q, `
+			SELECT (SELECT COUNT(*) FROM users WHERE username = ?)
+			     + (SELECT COUNT(*) FROM account_changes WHERE field = 'username' AND old_value = ?)
+		`, candidate, candidate).Scan(&count)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", fmt.Errorf("no free username for %q", username)
+}
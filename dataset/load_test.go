@@ -0,0 +1,113 @@
+package dataset
+
+import (
+	"context"
+	"forum/database"
+	"testing"
+)
+
+// useMemoryDB points the database package at a fresh, migrated in-memory SQLite
+// database. It lives as long as its one connection, so the pool is held to one.
+func useMemoryDB(t *testing.T) {
+	t.Helper()
+	database.InitDB(database.SQLite, ":memory:")
+	database.DB.SetMaxOpenConns(1)
+	t.Cleanup(func() { database.DB.Close() })
+	if _, err := database.MigrateUp(0); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+}
+
+// count returns the number of rows in table
+func count(t *testing.T, table string) int {
+	t.Helper()
+	var n int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestLoadDryRun(t *testing.T) {
+	useMemoryDB(t)
+	ctx := context.Background()
+
+	res, err := Load(ctx, validFixture(), Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Users != 2 || res.Categories != 1 || res.Posts != 1 || res.Comments != 1 || res.Votes != 3 {
+		t.Errorf("dry run reports %+v, want everything in the fixture", res)
+	}
+	for _, table := range []string{"users", "categories", "posts", "comments", "reactions"} {
+		if n := count(t, table); n != 0 {
+			t.Errorf("dry run left %d rows in %s", n, table)
+		}
+	}
+
+	// The real load adds what the dry run promised
+	if _, err := Load(ctx, validFixture(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, "users"); n != 2 {
+		t.Errorf("%d users after loading, want 2", n)
+	}
+}
+
+func TestLoadMergeUsers(t *testing.T) {
+	useMemoryDB(t)
+	ctx := context.Background()
+	if _, err := Load(ctx, validFixture(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var rexID int
+	if err := database.DB.QueryRow("SELECT id FROM users WHERE username = 'rex'").Scan(&rexID); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := &Dataset{
+		Users: []User{
+			{ID: 1, Username: "tyrannosaurus", Email: "REX@example.com"}, // rex's email in other case
+			{ID: 2, Username: "Jane Doe", Email: "jane@example.com"},     // invalid username
+			{ID: 3, Username: "trike", Email: "other@example.com"},       // taken username
+		},
+		Categories: []Category{{ID: 1, Name: "fossils"}},
+		Posts:      []Post{{ID: 1, UserID: 1, Title: "Another tooth", Content: "Look again", CategoryIDs: []int{1}}},
+	}
+
+	// Without merging, the invalid username stops the import before anything is added
+	if _, err := Load(ctx, imported, Options{}); err == nil {
+		t.Fatal("loaded a user with an invalid username without MergeUsers")
+	}
+
+	res, err := Load(ctx, imported, Options{MergeUsers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Users != 2 || res.MergedUsers != 1 || res.Categories != 0 || res.ExistingCategories != 1 {
+		t.Errorf("result = %+v, want 2 users added, 1 merged and the category reused", res)
+	}
+	want := []Rename{{"Jane Doe", "JaneDoe"}, {"trike", "trike1"}}
+	if len(res.Renamed) != len(want) || res.Renamed[0] != want[0] || res.Renamed[1] != want[1] {
+		t.Errorf("renamed = %+v, want %+v", res.Renamed, want)
+	}
+
+	// The merged user's post belongs to the existing account
+	var authorID int
+	if err := database.DB.QueryRow("SELECT user_id FROM posts WHERE title = 'Another tooth'").Scan(&authorID); err != nil {
+		t.Fatal(err)
+	}
+	if authorID != rexID {
+		t.Errorf("imported post belongs to user %d, want rex (%d)", authorID, rexID)
+	}
+	for _, name := range []string{"JaneDoe", "trike1"} {
+		var n int
+		database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", name).Scan(&n)
+		if n != 1 {
+			t.Errorf("no user named %s", name)
+		}
+	}
+	if n := count(t, "users"); n != 4 {
+		t.Errorf("%d users, want 4", n)
+	}
+}
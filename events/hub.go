@@ -0,0 +1,85 @@
+package events
+
+import (
+	"strconv"
+	"sync"
+)
+
+// HomeTopic receives events shown on the homepage
+const HomeTopic = "home"
+
+// PostTopic returns the topic for events on a single post page
+func PostTopic(postID int) string {
+	return "post:" + strconv.Itoa(postID)
+}
+
+// Event is a named message pushed to subscribers; Data is sent as JSON
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before events are dropped
+const subscriberBuffer = 16
+
+// Hub is an in-process publish/subscribe hub keyed by topic
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[chan Event]struct{}
+}
+
+// NewHub returns an empty hub
+func NewHub() *Hub {
+	return &Hub{topics: map[string]map[chan Event]struct{}{}}
+}
+
+// Subscribe registers a listener on topic. The returned function must be
+// called to unsubscribe; it closes the channel.
+func (h *Hub) Subscribe(topic string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	h.mu.Lock()
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[chan Event]struct{}{}
+	}
+	h.topics[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.topics[topic], ch)
+			if len(h.topics[topic]) == 0 {
+				delete(h.topics, topic)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends ev to every subscriber of topic without blocking;
+// subscribers whose buffer is full miss the event
+func (h *Hub) Publish(topic string, ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.topics[topic] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Default is the hub shared by the handlers
+var Default = NewHub()
+
+// Subscribe registers a listener on the default hub
+func Subscribe(topic string) (<-chan Event, func()) {
+	return Default.Subscribe(topic)
+}
+
+// Publish sends an event through the default hub
+func Publish(topic string, ev Event) {
+	Default.Publish(topic, ev)
+}
@@ -3,7 +3,9 @@ module forum
 go 1.23.6
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
-	golang.org/x/crypto v0.39.0 // indirect
+	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/crypto v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
 )
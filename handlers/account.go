@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"forum/store"
+	"forum/utils"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// accountDeletionGraceDays is how long a deletion request can still be cancelled
+const accountDeletionGraceDays = 7
+
+// AccountExport is the personal data archive returned by /account/export
+type AccountExport struct {
+	ExportedAt time.Time        `json:"exported_at"`
+	Profile    ExportProfile    `json:"profile"`
+	Posts      []ExportPost     `json:"posts"`
+	Comments   []ExportComment  `json:"comments"`
+	Reactions  []ExportReaction `json:"reactions"`
+	Sessions   []ExportSession  `json:"sessions"`
+	Identities []ExportIdentity `json:"identities"`
+}
+
+// ExportProfile is the user's own account row, without the password hash
+type ExportProfile struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportPost is a post written by the user
+type ExportPost struct {
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Categories []string  `json:"categories"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ExportComment is a comment written by the user
+type ExportComment struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportReaction is a reaction (including likes and dislikes) left by the user
+type ExportReaction struct {
+	PostID    *int      `json:"post_id,omitempty"`
+	CommentID *int      `json:"comment_id,omitempty"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportSession is session metadata; the token itself is never exported
+type ExportSession struct {
+	ID        int       `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExportIdentity is a linked OpenID Connect identity
+type ExportIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountHandler handles GET /account
+func AccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+	renderAccountPage(w, r, "")
+}
+
+// renderAccountPage renders the account page with an optional error message
+func renderAccountPage(w http.ResponseWriter, r *http.Request, errMsg string) {
+	ctx := r.Context()
+	userID, username := utils.GetCurrentUser(r)
+
+	user, err := Store.Users.Get(ctx, userID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account")
+		return
+	}
+
+	deletion, err := Store.Users.Deletion(ctx, userID)
+	pendingDeletion := err == nil
+
+	// Recent username and email changes
+	type accountChange struct {
+		Field    string
+		OldValue string
+		NewValue string
+		Changed  template.HTML
+	}
+	loc := utils.ViewerLocation(r)
+	var history []accountChange
+	changes, err := Store.Users.Changes(ctx, userID, 10)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account history")
+		return
+	}
+	for _, c := range changes {
+		history = append(history, accountChange{c.Field, c.OldValue, c.NewValue, utils.TimeHTML(c.ChangedAt, loc)})
+	}
+
+	// Confirmation after a successful username, email or timezone change
+	updated := r.URL.Query().Get("updated")
+	if updated != "username" && updated != "email" && updated != "timezone" {
+		updated = ""
+	}
+
+	tmpl, err := template.ParseFiles("templates/account.html")
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to load account template")
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"LoggedIn":        true,
+		"UserID":          userID,
+		"Username":        username,
+		"Email":           user.Email,
+		"HasPassword":     user.PasswordHash != "",
+		"PendingDeletion": pendingDeletion,
+		"DeleteMode":      deletion.Mode,
+		"DeleteAfter":     utils.ExactTime(deletion.ExecuteAfter, loc),
+		"GraceDays":       accountDeletionGraceDays,
+		"Timezone":        user.Timezone,
+		"DefaultTimezone": utils.DefaultLocation.String(),
+		"History":         history,
+		"Updated":         updated,
+		"Error":           errMsg,
+		"CSRFToken":       utils.CSRFToken(w, r),
+	})
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to render account page")
+		return
+	}
+}
+
+// AccountExportHandler handles GET /account/export?format=json|zip
+func AccountExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+
+	userID, username := utils.GetCurrentUser(r)
+	export, err := exportAccount(ctx, userID)
+	if err != nil {
+		log.Printf("Account export for user %d failed: %v", userID, err)
+		utils.HandleDatabaseError(w, err, "Failed to export account data")
+		return
+	}
+
+	filename := "dinoforum-" + username + "-" + export.ExportedAt.Format("20060102")
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(export); err != nil {
+			abortExport(userID, err)
+		}
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		zw := zip.NewWriter(w)
+		files := []struct {
+			Name string
+			Data interface{}
+		}{
+			{"profile.json", export.Profile},
+			{"posts.json", export.Posts},
+			{"comments.json", export.Comments},
+			{"reactions.json", export.Reactions},
+			{"sessions.json", export.Sessions},
+			{"identities.json", export.Identities},
+		}
+		for _, f := range files {
+			fw, err := zw.Create(f.Name)
+			if err != nil {
+				abortExport(userID, err)
+			}
+			enc := json.NewEncoder(fw)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(f.Data); err != nil {
+				abortExport(userID, fmt.Errorf("%s: %w", f.Name, err))
+			}
+		}
+		if err := zw.Close(); err != nil {
+			abortExport(userID, err)
+		}
+	default:
+		utils.HandleError(w, 400, "Invalid Format", "Export format must be json or zip")
+	}
+}
+
+// abortExport logs an export that failed after its headers were sent and drops the
+// connection, so the download ends in an error instead of a file that looks complete
+func abortExport(userID int, err error) {
+	log.Printf("Account export for user %d failed while writing: %v", userID, err)
+	panic(http.ErrAbortHandler)
+}
+
+// exportAccount collects everything stored about a user
+func exportAccount(ctx context.Context, userID int) (*AccountExport, error) {
+	export := &AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Posts:      []ExportPost{},
+		Comments:   []ExportComment{},
+		Reactions:  []ExportReaction{},
+		Sessions:   []ExportSession{},
+		Identities: []ExportIdentity{},
+	}
+
+	user, err := Store.Users.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("profile: %w", err)
+	}
+	export.Profile = ExportProfile{ID: user.ID, Email: user.Email, Username: user.Username, CreatedAt: user.CreatedAt}
+
+	posts, err := Store.Posts.List(ctx, store.PostFilter{AuthorID: userID})
+	if err != nil {
+		return nil, fmt.Errorf("posts: %w", err)
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID < posts[j].ID })
+	postIDs := make([]int, len(posts))
+	for i, p := range posts {
+		postIDs[i] = p.ID
+	}
+	cats, err := Store.Posts.Categories(ctx, postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("post categories: %w", err)
+	}
+	for _, p := range posts {
+		names := []string{}
+		for _, c := range cats[p.ID] {
+			names = append(names, c.Name)
+		}
+		export.Posts = append(export.Posts, ExportPost{ID: p.ID, Title: p.Title, Content: p.Content, Categories: names, CreatedAt: p.CreatedAt})
+	}
+
+	comments, err := Store.Comments.ByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("comments: %w", err)
+	}
+	for _, c := range comments {
+		export.Comments = append(export.Comments, ExportComment{ID: c.ID, PostID: c.PostID, Content: c.Content, CreatedAt: c.CreatedAt})
+	}
+
+	reactions, err := Store.Votes.ByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("reactions: %w", err)
+	}
+	for _, r := range reactions {
+		v := ExportReaction{Reaction: r.Key, CreatedAt: r.CreatedAt}
+		if r.PostID != 0 {
+			id := r.PostID
+			v.PostID = &id
+		}
+		if r.CommentID != 0 {
+			id := r.CommentID
+			v.CommentID = &id
+		}
+		export.Reactions = append(export.Reactions, v)
+	}
+
+	sessions, err := Store.Sessions.ForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("sessions: %w", err)
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, ExportSession{ID: s.ID, ExpiresAt: s.ExpiresAt})
+	}
+
+	identities, err := Store.Users.Identities(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("identities: %w", err)
+	}
+	for _, i := range identities {
+		export.Identities = append(export.Identities, ExportIdentity{Provider: i.Provider, Subject: i.Subject, Email: i.Email, CreatedAt: i.CreatedAt})
+	}
+
+	return export, nil
+}
+
+// AccountDeleteHandler handles POST /account/delete, scheduling the account for deletion
+func AccountDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, username := utils.GetCurrentUser(r)
+
+	mode := r.FormValue("mode")
+	if mode != "anonymise" && mode != "remove" {
+		renderAccountPage(w, r, "Please choose what should happen to your posts and comments.")
+		return
+	}
+	if strings.TrimSpace(r.FormValue("confirm_username")) != username {
+		renderAccountPage(w, r, "Please type your username to confirm.")
+		return
+	}
+
+	// Accounts with a password must re-enter it; SSO-only accounts rely on the username confirmation
+	if ok, err := checkAccountPassword(ctx, userID, r.FormValue("password")); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account")
+		return
+	} else if !ok {
+		renderAccountPage(w, r, "Incorrect password.")
+		return
+	}
+
+	err := Store.Users.ScheduleDeletion(ctx, store.AccountDeletion{
+		UserID:       userID,
+		Mode:         mode,
+		ExecuteAfter: time.Now().AddDate(0, 0, accountDeletionGraceDays),
+	})
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to schedule account deletion")
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// AccountDeleteCancelHandler handles POST /account/delete/cancel during the grace period
+func AccountDeleteCancelHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	if err := Store.Users.CancelDeletion(ctx, userID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to cancel account deletion")
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// PurgeDueAccounts deletes every account whose grace period has ended
+func PurgeDueAccounts(ctx context.Context) {
+	pending, err := Store.Users.DueDeletions(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to load due account deletions: %v", err)
+		return
+	}
+
+	for _, d := range pending {
+		if err := purgeAccount(ctx, d.UserID, d.Mode == "anonymise"); err != nil {
+			log.Printf("Failed to delete account %d: %v", d.UserID, err)
+			continue
+		}
+		log.Printf("Deleted account %d (mode %s)", d.UserID, d.Mode)
+	}
+}
+
+// purgeAccount removes a user. With anonymise set, their posts and comments are
+// reassigned to the deleted-user placeholder instead of being removed.
+func purgeAccount(ctx context.Context, userID int, anonymise bool) error {
+	var placeholder *store.User
+	if anonymise {
+		placeholder = &store.User{Email: utils.DeletedEmail, Username: utils.DeletedUsername}
+	}
+	return Store.Users.Delete(ctx, userID, placeholder)
+}
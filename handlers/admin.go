@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"forum/dataset"
+	"forum/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminUserIDs are the users allowed to use the admin endpoints, set from ADMIN_USER_IDS.
+// IDs rather than usernames, since users can change their username.
+var AdminUserIDs = map[int]bool{}
+
+// LoadAdminUserIDs sets AdminUserIDs from a comma-separated list of user IDs, e.g. "1,7"
+func LoadAdminUserIDs(spec string) error {
+	ids := map[int]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, err := strconv.Atoi(item)
+		if err != nil || id <= 0 {
+			return fmt.Errorf("%q is not a user ID", item)
+		}
+		ids[id] = true
+	}
+	AdminUserIDs = ids
+	return nil
+}
+
+// countingWriter records whether anything has been written yet
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// SiteExportHandler handles GET /admin/export, streaming an archive of the whole forum
+// to an admin. ?password_hashes=true includes password hashes.
+func SiteExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+	userID, _ := utils.GetCurrentUser(r)
+	if !AdminUserIDs[userID] {
+		utils.HandleError(w, 403, "Forbidden", "Only administrators can export the forum")
+		return
+	}
+
+	opts := dataset.ExportOptions{PasswordHashes: r.URL.Query().Get("password_hashes") == "true"}
+	filename := "dinoforum-export-" + time.Now().UTC().Format("20060102-150405") + ".jsonl"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	cw := &countingWriter{ResponseWriter: w}
+	counts, err := dataset.Export(r.Context(), cw, opts)
+	if err != nil {
+		log.Printf("Site export by user %d failed after %d bytes: %v", userID, cw.written, err)
+		if cw.written == 0 {
+			w.Header().Del("Content-Disposition")
+			utils.HandleDatabaseError(w, err, "Failed to export the forum")
+		}
+		// Otherwise the archive is cut short without its end line, which importers reject
+		return
+	}
+	log.Printf("User %d exported the forum: %+v (password hashes: %t)", userID, counts, opts.PasswordHashes)
+}
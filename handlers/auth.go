@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"database/sql"
-	"forum/database"
+	"forum/oidc"
+	"forum/store"
+	"forum/utils"
 	"html/template"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
@@ -24,73 +24,33 @@ func RenderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
 	t.Execute(w, data)
 }
 
-// validateEmail checks if the email format is valid
-func validateEmail(email string) bool {
-	
-	// emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+\.[a-zA-Z]{2,}$`)
-
-	// Additional checks for common invalid patterns
-	if strings.Contains(email, "..") {
-		return false
-	}
-	if strings.HasPrefix(email, ".") || strings.HasSuffix(email, ".") {
-		return false
-	}
-	if strings.Contains(email, "@.") || strings.Contains(email, ".@") {
-		return false
-	}
-
-	// Check that there's at least one dot in the domain part
-	parts := strings.Split(email, "@")
-	if len(parts) != 2 {
-		return false
-	}
-	domain := parts[1]
-	if !strings.Contains(domain, ".") {
-		return false
-	}
-
-	// Check that the domain has at least one character before the first dot
-	domainParts := strings.Split(domain, ".")
-	if len(domainParts) < 2 || domainParts[0] == "" {
-		return false
-	}
-
-	return len(email) <= 254
+// renderAuthForm renders the login or register form with an optional error, a CSRF token and the OIDC sign-in options
+func renderAuthForm(w http.ResponseWriter, r *http.Request, tmpl string, errMsg string) {
+	RenderTemplate(w, tmpl, authFormData(w, r, errMsg))
 }
 
-// validateUsername checks if username meets requirements
-func validateUsername(username string) (bool, string) {
-	if len(username) < 3 {
-		return false, "Username must be at least 3 characters long."
-	}
-	if len(username) > 20 {
-		return false, "Username must be no more than 20 characters long."
+// authFormData is the template data shared by the login and register forms
+func authFormData(w http.ResponseWriter, r *http.Request, errMsg string) map[string]interface{} {
+	return map[string]interface{}{
+		"Error":       errMsg,
+		"CSRFToken":   utils.CSRFToken(w, r),
+		"Providers":   oidc.Providers(),
+		"PasswordMin": utils.Policy.MinLength,
+		"PasswordMax": utils.Policy.MaxLength,
 	}
-	// Check for valid characters (letters, numbers, underscores, hyphens)
-	usernameRegex := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
-	if !usernameRegex.MatchString(username) {
-		return false, "Username can only contain letters, numbers, underscores, and hyphens."
-	}
-	return true, ""
 }
 
-// validatePassword checks if password meets requirements
-func validatePassword(password string) (bool, string) {
-	if len(password) < 8 {
-		return false, "Password must be at least 8 characters long."
-	}
-	if len(password) > 50 {
-		return false, "Password must be no more than 50 characters long."
-	}
-	return true, ""
+// validatePassword checks if password meets the configured password policy
+func validatePassword(password string, username string, email string) (bool, string) {
+	return utils.CheckPassword(password, username, email)
 }
 
 // RegisterHandler handles GET and POST for /register
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method == http.MethodGet {
 		// Show the registration form
-		RenderTemplate(w, "register.html", nil)
+		renderAuthForm(w, r, "register.html", "")
 		return
 	}
 
@@ -101,51 +61,58 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Basic validation - check for empty fields
 		if email == "" || username == "" || password == "" {
-			RenderTemplate(w, "register.html", map[string]string{"Error": "All fields are required."})
+			renderAuthForm(w, r, "register.html", "All fields are required.")
 			return
 		}
 
 		// Validate email format
-		if !validateEmail(email) {
-			RenderTemplate(w, "register.html", map[string]string{"Error": "Please enter a valid email address."})
+		if !utils.ValidateEmail(email) {
+			renderAuthForm(w, r, "register.html", "Please enter a valid email address.")
 			return
 		}
 
 		// Validate username
-		if valid, errMsg := validateUsername(username); !valid {
-			RenderTemplate(w, "register.html", map[string]string{"Error": errMsg})
+		if valid, errMsg := utils.ValidateUsername(username); !valid {
+			renderAuthForm(w, r, "register.html", errMsg)
 			return
 		}
 
 		// Validate password
-		if valid, errMsg := validatePassword(password); !valid {
-			RenderTemplate(w, "register.html", map[string]string{"Error": errMsg})
+		if valid, errMsg := validatePassword(password, username, email); !valid {
+			renderAuthForm(w, r, "register.html", errMsg)
 			return
 		}
 
 		// Check if email or username already exists
-		var exists int
-		err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? OR username = ?", email, username).Scan(&exists)
+		exists, err := Store.Users.Exists(ctx, email, username)
 		if err != nil {
-			RenderTemplate(w, "register.html", map[string]string{"Error": "Database error."})
+			utils.HandleDatabaseError(w, err, "Failed to check your email and username")
 			return
 		}
-		if exists > 0 {
-			RenderTemplate(w, "register.html", map[string]string{"Error": "Email or username already taken."})
+		if exists {
+			renderAuthForm(w, r, "register.html", "Email or username already taken.")
+			return
+		}
+
+		// Former usernames stay reserved so old profile links keep pointing at their owner
+		if taken, err := usernameTaken(ctx, username, 0); err != nil {
+			utils.HandleDatabaseError(w, err, "Failed to check your username")
+			return
+		} else if taken {
+			renderAuthForm(w, r, "register.html", "Email or username already taken.")
 			return
 		}
 
 		// Hash the password
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hash, err := utils.HashPassword(password)
 		if err != nil {
-			RenderTemplate(w, "register.html", map[string]string{"Error": "Error securing password."})
+			renderAuthForm(w, r, "register.html", "Error securing password.")
 			return
 		}
 
 		// Insert the new user
-		_, err = database.DB.Exec("INSERT INTO users (email, username, password_hash) VALUES (?, ?, ?)", email, username, string(hash))
-		if err != nil {
-			RenderTemplate(w, "register.html", map[string]string{"Error": "Failed to register user."})
+		if _, err := Store.Users.Create(ctx, email, username, hash); err != nil {
+			renderAuthForm(w, r, "register.html", "Failed to register user.")
 			return
 		}
 
@@ -160,9 +127,14 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 // LoginHandler handles GET and POST for /login
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method == http.MethodGet {
-		// Show the login form
-		RenderTemplate(w, "login.html", nil)
+		// Show the login form, explaining why after an OIDC sign-in that needs confirming
+		data := authFormData(w, r, "")
+		if provider, ok := oidc.GetProvider(r.URL.Query().Get("link")); ok {
+			data["Notice"] = "An account with your " + provider.DisplayName + " email address already exists. Log in with its password to link " + provider.DisplayName + " to it."
+		}
+		RenderTemplate(w, "login.html", data)
 		return
 	}
 
@@ -172,52 +144,39 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Simple validation
 		if email == "" || password == "" {
-			RenderTemplate(w, "login.html", map[string]string{"Error": "All fields are required."})
+			renderAuthForm(w, r, "login.html", "All fields are required.")
 			return
 		}
 
 		// Look up user by email
-		var id int
-		var username, passwordHash string
-		err := database.DB.QueryRow("SELECT id, username, password_hash FROM users WHERE email = ?", email).Scan(&id, &username, &passwordHash)
-		if err == sql.ErrNoRows {
-			RenderTemplate(w, "login.html", map[string]string{"Error": "Invalid email or password."})
+		user, err := Store.Users.ByEmail(ctx, email)
+		if err == store.ErrNotFound {
+			renderAuthForm(w, r, "login.html", "Invalid email or password.")
 			return
 		} else if err != nil {
-			RenderTemplate(w, "login.html", map[string]string{"Error": "Database error."})
+			utils.HandleDatabaseError(w, err, "Failed to load account")
 			return
 		}
 
 		// Compare password
-		err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 		if err != nil {
-			RenderTemplate(w, "login.html", map[string]string{"Error": "Invalid email or password."})
+			renderAuthForm(w, r, "login.html", "Invalid email or password.")
 			return
 		}
 
-		// Enforce one session per user: delete old sessions
-		_, _ = database.DB.Exec("DELETE FROM sessions WHERE user_id = ?", id)
-
-		// Create a new session (UUID)
-		sessionToken := uuid.New().String()
-		expiresAt := time.Now().Add(24 * time.Hour) // Session valid for 24 hours
-
-		// Store session in DB
-		_, err = database.DB.Exec("INSERT INTO sessions (user_id, session_token, expires_at) VALUES (?, ?, ?)", id, sessionToken, expiresAt)
-		if err != nil {
-			RenderTemplate(w, "login.html", map[string]string{"Error": "Failed to create session."})
-			return
+		// Upgrade hashes made with an older, cheaper bcrypt cost while we have the plaintext
+		if utils.NeedsRehash(user.PasswordHash) {
+			if newHash, err := utils.HashPassword(password); err == nil {
+				_ = Store.Users.SetPasswordHash(ctx, user.ID, newHash)
+			}
 		}
 
-		// Set session cookie
-		cookie := &http.Cookie{
-			Name:     "session_token",
-			Value:    sessionToken,
-			Expires:  expiresAt,
-			HttpOnly: true,
-			Path:     "/",
+		if err := createSession(w, r, user.ID); err != nil {
+			renderAuthForm(w, r, "login.html", "Failed to create session.")
+			return
 		}
-		http.SetCookie(w, cookie)
+		confirmOIDCLink(w, r, user.ID)
 
 		// Login successful, redirect to home
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -228,18 +187,49 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
-// LogoutHandler logs the user out by deleting the session and clearing the cookie
+// createSession starts a fresh session for the user and sets the session cookie
+func createSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	// Create a new session (UUID), replacing any the user already had
+	sessionToken := uuid.New().String()
+	expiresAt := time.Now().Add(24 * time.Hour) // Session valid for 24 hours
+	if err := Store.Sessions.Create(r.Context(), userID, sessionToken, expiresAt); err != nil {
+		return err
+	}
+
+	// Set session cookie
+	cookie := &http.Cookie{
+		Name:     "session_token",
+		Value:    sessionToken,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   utils.IsSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	}
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// LogoutHandler handles POST /logout by deleting the session and clearing the cookie
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
 	cookie, err := r.Cookie("session_token")
 	if err == nil {
-		// Delete session from DB
-		database.DB.Exec("DELETE FROM sessions WHERE session_token = ?", cookie.Value)
+		// Delete the session
+		_ = Store.Sessions.Delete(ctx, cookie.Value)
 		// Clear the cookie
 		cleared := &http.Cookie{
 			Name:     "session_token",
 			Value:    "",
 			Expires:  time.Unix(0, 0),
 			HttpOnly: true,
+			Secure:   utils.IsSecureRequest(r),
+			SameSite: http.SameSiteLaxMode,
 			Path:     "/",
 		}
 		http.SetCookie(w, cleared)
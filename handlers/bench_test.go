@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"forum/database"
+	"forum/dataset"
+	"forum/store"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// benchScale is the forum the page benchmarks run against
+var benchScale = dataset.Scale{Users: 1000, Posts: 100000, Comments: 100000, Votes: 200000}
+
+var (
+	benchOnce  sync.Once
+	benchDir   string
+	benchStore *store.Store
+	benchErr   error
+)
+
+// seedBenchDB fills a temporary SQLite database with generated content at benchScale,
+// once per test binary, and makes it the database the handlers use
+func seedBenchDB(b *testing.B) {
+	b.Helper()
+	benchOnce.Do(func() {
+		benchDir, benchErr = os.MkdirTemp("", "forum-bench")
+		if benchErr != nil {
+			return
+		}
+		database.InitDB(database.SQLite, filepath.Join(benchDir, "bench.db"))
+		if _, benchErr = database.MigrateUp(0); benchErr != nil {
+			return
+		}
+		d := dataset.Generate(benchScale, 1, "bench-password", time.Now())
+		if _, benchErr = dataset.Load(context.Background(), d, dataset.Options{}); benchErr != nil {
+			return
+		}
+		benchStore = store.NewSQLite(database.DB)
+	})
+	if benchErr != nil {
+		b.Fatalf("seeding benchmark database: %v", benchErr)
+	}
+	Store = benchStore
+	b.ResetTimer()
+}
+
+// BenchmarkHomepage renders the homepage the way a guest first sees it
+func BenchmarkHomepage(b *testing.B) {
+	benchmarkHomepage(b, "/")
+}
+
+// BenchmarkHomepageLastPage renders the page with the oldest posts, the furthest the
+// listing has to skip
+func BenchmarkHomepageLastPage(b *testing.B) {
+	benchmarkHomepage(b, "/?page="+strconv.Itoa(benchScale.Posts/postsPerPage))
+}
+
+func benchmarkHomepage(b *testing.B, path string) {
+	seedBenchDB(b)
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		HomeHandler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			b.Fatalf("status = %d", rec.Code)
+		}
+	}
+}
+
+// BenchmarkPostPage renders the post with the most comments and reactions
+func BenchmarkPostPage(b *testing.B) {
+	seedBenchDB(b)
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		ViewPostHandler(rec, httptest.NewRequest(http.MethodGet, "/post?id=1", nil))
+		if rec.Code != http.StatusOK {
+			b.Fatalf("status = %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"forum/store"
+	"forum/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPostCategories is the most categories a post can be filed under
+const maxPostCategories = 5
+
+// parsePostCategories reads the submitted category_id values, dropping duplicates. If they
+// aren't between one and maxPostCategories existing categories, problem says why. The
+// count is checked before the database, which is asked about all of them at once.
+func parsePostCategories(ctx context.Context, values []string) (ids []int, problem string, err error) {
+	seen := map[int]bool{}
+	for _, v := range values {
+		id, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			return nil, "One of the selected categories is not valid.", nil
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, "Please select at least one category.", nil
+	}
+	if len(ids) > maxPostCategories {
+		return nil, fmt.Sprintf("Please select at most %d categories.", maxPostCategories), nil
+	}
+	exist, err := Store.Categories.AllExist(ctx, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	if !exist {
+		return nil, "One of the selected categories doesn't exist.", nil
+	}
+	return ids, "", nil
+}
+
+// CategoryOption is a category shown as a checkbox, with whether the post has it
+type CategoryOption struct {
+	Category
+	Selected bool
+}
+
+// PostCategories returns the category names of each of the posts
+func PostCategories(ctx context.Context, postIDs []int) (map[int][]string, error) {
+	cats, err := Store.Posts.Categories(ctx, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int][]string, len(cats))
+	for postID, list := range cats {
+		for _, c := range list {
+			names[postID] = append(names[postID], c.Name)
+		}
+	}
+	return names, nil
+}
+
+// CreateCategoryHandler handles POST /categories for users with the create_category privilege
+func CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	allowed, err := hasPrivilege(ctx, userID, "create_category")
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to check your reputation")
+		return
+	}
+	if !allowed {
+		utils.HandleError(w, 403, "Not Enough Reputation", "You need more reputation to create categories")
+		return
+	}
+
+	// Stored as plain text; templates escape it when rendering
+	name := strings.TrimSpace(r.FormValue("name"))
+	if n := utf8.RuneCountInString(name); n < 2 || n > 30 {
+		utils.HandleError(w, 400, "Invalid Category", "Category names must be 2-30 characters long")
+		return
+	}
+	if exists, err := Store.Categories.NameExists(ctx, name); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to check category name")
+		return
+	} else if exists {
+		utils.HandleError(w, 409, "Category Exists", "A category with that name already exists")
+		return
+	}
+
+	if _, err := Store.Categories.Create(ctx, name); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to create category")
+		return
+	}
+
+	ref := r.Referer()
+	if ref == "" {
+		ref = "/"
+	}
+	http.Redirect(w, r, ref, http.StatusSeeOther)
+}
+
+// EditPostCategoriesHandler handles POST /post/categories. Authors can always recategorise
+// their own posts; other users need the edit_categories privilege.
+func EditPostCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil || postID <= 0 {
+		utils.HandleError(w, 400, "Invalid Post ID", "The post ID provided is not valid")
+		return
+	}
+
+	post, err := Store.Posts.Get(ctx, postID)
+	if err == store.ErrNotFound {
+		utils.HandleError(w, 404, "Post Not Found", "The post you're trying to edit doesn't exist")
+		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load post")
+		return
+	}
+	if post.UserID != userID {
+		allowed, err := hasPrivilege(ctx, userID, "edit_categories")
+		if err != nil {
+			utils.HandleDatabaseError(w, err, "Failed to check your reputation")
+			return
+		}
+		if !allowed {
+			utils.HandleError(w, 403, "Not Enough Reputation", "You need more reputation to edit categories on other people's posts")
+			return
+		}
+	}
+
+	if err := r.ParseForm(); err != nil {
+		utils.HandleError(w, 400, "Invalid Form", "The categories form could not be read")
+		return
+	}
+	categoryIDs, problem, err := parsePostCategories(ctx, r.Form["category_id"])
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to check categories")
+		return
+	} else if problem != "" {
+		utils.HandleError(w, 400, "Invalid Categories", problem)
+		return
+	}
+
+	if err := Store.Posts.SetCategories(ctx, postID, categoryIDs); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to update categories")
+		return
+	}
+
+	http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
+}
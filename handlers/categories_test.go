@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestParsePostCategories(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"Fossils", "Art", "News"} {
+		id, err := s.Categories.Create(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, strconv.Itoa(id))
+	}
+	tooMany := fmt.Sprintf("Please select at most %d categories.", maxPostCategories)
+
+	tests := []struct {
+		name    string
+		values  []string
+		want    int
+		problem string
+	}{
+		{"one", ids[:1], 1, ""},
+		{"duplicates dropped", []string{ids[0], ids[1], ids[0], ids[1]}, 2, ""},
+		{"duplicates don't count towards the cap", []string{ids[0], ids[0], ids[0], ids[0], ids[0], ids[1]}, 2, ""},
+		{"none", nil, 0, "Please select at least one category."},
+		{"not a number", []string{ids[0], "fossils"}, 0, "One of the selected categories is not valid."},
+		{"unknown", []string{ids[0], "999"}, 0, "One of the selected categories doesn't exist."},
+		// Too many is refused before asking the database, even when some don't exist
+		{"too many", []string{"101", "102", "103", "104", "105", "106"}, 0, tooMany},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problem, err := parsePostCategories(ctx, tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want || problem != tt.problem {
+				t.Errorf("parsePostCategories(%v) = %v, %q, want %d IDs, %q", tt.values, got, problem, tt.want, tt.problem)
+			}
+		})
+	}
+}
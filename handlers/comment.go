@@ -1,8 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"forum/database"
+	"forum/store"
 	"forum/utils"
 	"net/http"
 	"strconv"
@@ -10,6 +11,7 @@ import (
 
 // CommentHandler handles POST /comment
 func CommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
 		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
 		return
@@ -29,11 +31,42 @@ func CommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = database.DB.Exec("INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)", postID, userID, content)
+	post, err := Store.Posts.Get(ctx, postID)
+	if err == store.ErrNotFound {
+		utils.HandleError(w, 404, "Post Not Found", "The post you're trying to comment on doesn't exist")
+		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load post")
+		return
+	}
+	postOwnerID := post.UserID
+
+	commentID, err := Store.Comments.Create(ctx, postID, userID, content)
 	if err != nil {
-		utils.HandleError(w, 500, "Database Error", "Failed to add comment")
+		utils.HandleDatabaseError(w, err, "Failed to add comment")
 		return
 	}
+	// The comment is saved, so finish the follow-up work even if the client goes away
+	ctx = context.WithoutCancel(ctx)
+
+	// Tell the post author, then everyone else already in the discussion
+	notify(ctx, postOwnerID, userID, "comment", postID, commentID)
+	if participants, err := Store.Comments.Commenters(ctx, postID); err == nil {
+		for _, id := range participants {
+			if id != userID && id != postOwnerID {
+				notify(ctx, id, userID, "reply", postID, commentID)
+			}
+		}
+	}
+
+	// Link and notify @mentioned users
+	recordMentions(ctx, userID, postID, commentID, content)
+
+	// Follow the thread so the commenter hears about further replies
+	autoSubscribe(ctx, userID, postID)
+
+	// Show the comment live to everyone viewing the post
+	publishComment(ctx, postID, commentID)
 
 	// Redirect back to the post page
 	http.Redirect(w, r, "/post?id="+postIDStr, http.StatusSeeOther)
@@ -41,6 +74,7 @@ func CommentHandler(w http.ResponseWriter, r *http.Request) {
 
 // DeleteCommentHandler handles POST /delete_comment
 func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
 		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
 		return
@@ -56,28 +90,28 @@ func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the comment exists and belongs to the current user
-	var commentUserID, postID int
-	err = database.DB.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ?", commentID).Scan(&commentUserID, &postID)
-	if err != nil {
+	comment, err := Store.Comments.Get(ctx, commentID)
+	if err == store.ErrNotFound {
 		utils.HandleError(w, 404, "Comment Not Found", "The comment you're trying to delete doesn't exist")
 		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load comment")
+		return
 	}
+	postID := comment.PostID
 
-	if commentUserID != userID {
+	if comment.UserID != userID {
 		utils.HandleError(w, 403, "Forbidden", "You can only delete your own comments")
 		return
 	}
 
-	// Delete the comment
-	result, err := database.DB.Exec("DELETE FROM comments WHERE id = ?", commentID)
-	if err != nil {
-		utils.HandleError(w, 500, "Database Error", "Failed to delete comment")
+	// Delete the comment along with its votes
+	if err := Store.Comments.Delete(ctx, commentID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to delete comment")
 		return
 	}
-
-	// Check how many rows were affected
-	rowsAffected, _ := result.RowsAffected()
-	fmt.Printf("Deleted comment %d, rows affected: %d\n", commentID, rowsAffected)
+	fmt.Printf("Deleted comment %d\n", commentID)
+	publishCommentDeleted(postID, commentID)
 
 	// Redirect back to the post page
 	http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"forum/events"
+	"forum/store"
+	"forum/utils"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseKeepAlive is how often an idle stream sends a comment so proxies don't close it
+const sseKeepAlive = 25 * time.Second
+
+// CommentEvent is pushed to a post page when a comment is added
+type CommentEvent struct {
+	ID          int               `json:"id"`
+	PostID      int               `json:"post_id"`
+	UserID      int               `json:"user_id"`
+	Author      string            `json:"author"`
+	Reputation  int               `json:"reputation"`
+	CreatedAt   time.Time         `json:"created_at"` // UTC
+	ContentHTML string            `json:"content_html"`
+	Reactions   []ReactionSummary `json:"reactions"`
+}
+
+// VoteEvent carries the new like/dislike counts and reactions of a post or comment
+type VoteEvent struct {
+	PostID       int               `json:"post_id"`
+	CommentID    int               `json:"comment_id,omitempty"`
+	LikeCount    int               `json:"like_count"`
+	DislikeCount int               `json:"dislike_count"`
+	Reactions    []ReactionSummary `json:"reactions"`
+}
+
+// PostEvent announces a new post on the homepage
+type PostEvent struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+}
+
+// DeleteEvent announces that a post or comment was removed
+type DeleteEvent struct {
+	ID int `json:"id"`
+}
+
+// voteCounts returns the like and dislike counts of a comment (commentID > 0) or a post
+func voteCounts(ctx context.Context, postID, commentID int) (likes int, dislikes int) {
+	likes, dislikes, _ = Store.Votes.Counts(ctx, postID, commentID)
+	return likes, dislikes
+}
+
+// publishVotes pushes fresh vote counts and reactions to the post page and, for posts, the homepage
+func publishVotes(ctx context.Context, postID, commentID int) {
+	likes, dislikes := voteCounts(ctx, postID, commentID)
+	reactions, err := ReactionsFor(ctx, postID, commentID, 0)
+	if err != nil {
+		return
+	}
+	ev := events.Event{Type: "votes", Data: VoteEvent{postID, commentID, likes, dislikes, reactions}}
+	events.Publish(events.PostTopic(postID), ev)
+	if commentID == 0 {
+		events.Publish(events.HomeTopic, ev)
+	}
+}
+
+// publishComment pushes a newly added comment to viewers of its post
+func publishComment(ctx context.Context, postID, commentID int) {
+	c, err := Store.Comments.Get(ctx, commentID)
+	if err != nil {
+		return
+	}
+	_, commentNames := postMentions(ctx, postID)
+	ev := CommentEvent{ID: commentID, PostID: postID, UserID: c.UserID, Author: c.Author, CreatedAt: c.CreatedAt}
+	ev.ContentHTML = string(utils.RenderMentions(c.Content, commentNames[commentID]))
+	if ev.Reactions, err = ReactionsFor(ctx, postID, commentID, 0); err != nil {
+		return
+	}
+	if ev.Reputation, err = Reputation(ctx, ev.UserID); err != nil {
+		return
+	}
+	events.Publish(events.PostTopic(postID), events.Event{Type: "comment", Data: ev})
+}
+
+// publishPost announces a new post on the homepage
+func publishPost(postID int, title, author string) {
+	events.Publish(events.HomeTopic, events.Event{Type: "post", Data: PostEvent{postID, html.UnescapeString(title), author}})
+}
+
+// publishCommentDeleted tells viewers of a post that a comment is gone
+func publishCommentDeleted(postID, commentID int) {
+	events.Publish(events.PostTopic(postID), events.Event{Type: "comment_deleted", Data: DeleteEvent{commentID}})
+}
+
+// publishPostDeleted tells the homepage and viewers of the post that it is gone
+func publishPostDeleted(postID int) {
+	ev := events.Event{Type: "post_deleted", Data: DeleteEvent{postID}}
+	events.Publish(events.PostTopic(postID), ev)
+	events.Publish(events.HomeTopic, ev)
+}
+
+// HomeEventsHandler handles GET /events, the Server-Sent Events stream for the homepage
+func HomeEventsHandler(w http.ResponseWriter, r *http.Request) {
+	streamEvents(w, r, events.HomeTopic)
+}
+
+// PostEventsHandler handles GET /events/post?id=<id>, the Server-Sent Events stream for one post
+func PostEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || postID <= 0 {
+		utils.HandleError(w, 400, "Invalid Post ID", "The post ID provided is not valid")
+		return
+	}
+	if _, err := Store.Posts.Get(ctx, postID); err == store.ErrNotFound {
+		utils.HandleError(w, 404, "Post Not Found", "The post you're looking for doesn't exist")
+		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load post")
+		return
+	}
+	streamEvents(w, r, events.PostTopic(postID))
+}
+
+// streamEvents writes every event published on topic until the client disconnects
+func streamEvents(w http.ResponseWriter, r *http.Request, topic string) {
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.HandleError(w, 500, "Streaming Unsupported", "The server cannot stream events")
+		return
+	}
+
+	ch, unsubscribe := events.Subscribe(topic)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// Ask the browser to wait a few seconds before reconnecting after a drop
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case ev := <-ch:
+			data, err := json.Marshal(ev.Data)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
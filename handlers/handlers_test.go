@@ -0,0 +1,584 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"forum/mailer"
+	"forum/store"
+	"forum/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCSRFToken is a well-formed double-submit token, sent as both cookie and form field
+var testCSRFToken = strings.Repeat("ab", 32)
+
+// useMemoryStore points the handlers and session lookups at a fresh in-memory store
+func useMemoryStore(t *testing.T) *store.Store {
+	t.Helper()
+	s := store.NewMemory()
+	Store = s
+	utils.Sessions = s.Sessions
+	return s
+}
+
+// addUser creates an account with the given password and returns its ID
+func addUser(t *testing.T, s *store.Store, username, password string) int {
+	t.Helper()
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.Users.Create(context.Background(), username+"@example.com", username, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// logIn starts a session for the user and returns its token
+func logIn(t *testing.T, s *store.Store, userID int) string {
+	t.Helper()
+	token := "session-" + strconv.Itoa(userID)
+	if err := s.Sessions.Create(context.Background(), userID, token, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// postForm sends a form to a handler wrapped the way main registers state-changing
+// routes, as the user with the session token (none when empty)
+func postForm(handler http.HandlerFunc, path, session string, form url.Values, header http.Header) *httptest.ResponseRecorder {
+	form.Set(utils.CSRFFieldName, testCSRFToken)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.AddCookie(&http.Cookie{Name: utils.CSRFCookieName, Value: testCSRFToken})
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func unread(t *testing.T, s *store.Store, userID int) int {
+	t.Helper()
+	n, err := s.Notifications.Unread(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestLoginHandler(t *testing.T) {
+	s := useMemoryStore(t)
+	addUser(t, s, "alice", "correct horse")
+	login := utils.RequireCSRF(utils.RequireGuest(LoginHandler))
+
+	rec := postForm(login, "/login", "", url.Values{"email": {"alice@example.com"}, "password": {"wrong password"}}, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Invalid email or password.") {
+		t.Fatalf("wrong password: status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	rec = postForm(login, "/login", "", url.Values{"email": {"alice@example.com"}, "password": {"correct horse"}}, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("login: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	var session string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session_token" {
+			session = c.Value
+		}
+	}
+	if user, err := s.Sessions.User(context.Background(), session); err != nil || user.Username != "alice" {
+		t.Fatalf("session %q belongs to %+v (%v), want alice", session, user, err)
+	}
+
+	// Without the CSRF token nothing is checked at all
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("email=alice%40example.com&password=correct+horse"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	login(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("login without CSRF token: status %d, want 403", rec.Code)
+	}
+}
+
+func TestRegisterHandler(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	if err := s.Users.Change(ctx, alice, "username", "alice", "alicia"); err != nil {
+		t.Fatal(err)
+	}
+	register := utils.RequireCSRF(utils.RequireGuest(RegisterHandler))
+
+	refused := []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{"taken email", url.Values{"email": {"alice@example.com"}, "username": {"rex"}, "password": {"amber-sediment-42"}}, "Email or username already taken."},
+		{"current username", url.Values{"email": {"rex@example.com"}, "username": {"alicia"}, "password": {"amber-sediment-42"}}, "Email or username already taken."},
+		{"former username", url.Values{"email": {"rex@example.com"}, "username": {"alice"}, "password": {"amber-sediment-42"}}, "Email or username already taken."},
+		{"short password", url.Values{"email": {"rex@example.com"}, "username": {"rex"}, "password": {"roar"}}, "at least"},
+	}
+	for _, tt := range refused {
+		rec := postForm(register, "/register", "", tt.form, nil)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s: status %d, body %q", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := postForm(register, "/register", "", url.Values{"email": {"rex@example.com"}, "username": {"rex"}, "password": {"amber-sediment-42"}}, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("register: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if u, err := s.Users.ByUsername(ctx, "rex"); err != nil || u.Email != "rex@example.com" || u.PasswordHash == "amber-sediment-42" {
+		t.Errorf("registered user = %+v (%v)", u, err)
+	}
+}
+
+func TestAccountSettingsHandlers(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	addUser(t, s, "bob", "battery staple")
+	session := logIn(t, s, alice)
+	changeUsername := utils.RequireAuth(utils.RequireCSRF(ChangeUsernameHandler))
+	changeEmail := utils.RequireAuth(utils.RequireCSRF(ChangeEmailHandler))
+	changeTimezone := utils.RequireAuth(utils.RequireCSRF(ChangeTimezoneHandler))
+
+	refused := []struct {
+		name    string
+		handler http.HandlerFunc
+		form    url.Values
+		want    string
+	}{
+		{"wrong password", changeUsername, url.Values{"new_username": {"alicia"}, "password": {"wrong"}}, "Incorrect password."},
+		{"taken username", changeUsername, url.Values{"new_username": {"bob"}, "password": {"correct horse"}}, "That username is already taken."},
+		{"taken email", changeEmail, url.Values{"new_email": {"bob@example.com"}, "password": {"correct horse"}}, "That email address is already in use."},
+		{"unknown timezone", changeTimezone, url.Values{"timezone": {"Mars/Olympus_Mons"}}, "Unknown timezone."},
+	}
+	for _, tt := range refused {
+		rec := postForm(tt.handler, "/account", session, tt.form, nil)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s: status %d, body %q", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+
+	changed := []struct {
+		handler http.HandlerFunc
+		form    url.Values
+		want    string
+	}{
+		{changeUsername, url.Values{"new_username": {"alicia"}, "password": {"correct horse"}}, "/account?updated=username"},
+		{changeEmail, url.Values{"new_email": {"alicia@example.com"}, "password": {"correct horse"}}, "/account?updated=email"},
+		{changeTimezone, url.Values{"timezone": {"Europe/Berlin"}}, "/account?updated=timezone"},
+	}
+	for _, tt := range changed {
+		rec := postForm(tt.handler, "/account", session, tt.form, nil)
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != tt.want {
+			t.Errorf("%s: status %d, location %q, body %q", tt.want, rec.Code, rec.Header().Get("Location"), rec.Body.String())
+		}
+	}
+	u, err := s.Users.Get(ctx, alice)
+	if err != nil || u.Username != "alicia" || u.Email != "alicia@example.com" || u.Timezone != "Europe/Berlin" {
+		t.Fatalf("after changes: %+v (%v)", u, err)
+	}
+
+	// A second rename has to wait for the cooldown
+	rec := postForm(changeUsername, "/account", session, url.Values{"new_username": {"ally"}, "password": {"correct horse"}}, nil)
+	if !strings.Contains(rec.Body.String(), "You can change your username again in 30 day(s).") {
+		t.Errorf("second rename: status %d, body %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProfileHandler(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	bob := addUser(t, s, "bob", "battery staple")
+	post, err := s.Posts.Create(ctx, alice, "Found a tooth", "Look", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"One", "Two"} {
+		if _, err := s.Comments.Create(ctx, post, alice, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Votes.Cast(ctx, bob, post, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.Change(ctx, alice, "username", "alice", "alicia"); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ProfileHandler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/user/alicia")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "alicia") || !strings.Contains(body, "Found a tooth") {
+		t.Fatalf("profile: status %d, body %q", rec.Code, body)
+	}
+
+	// Old links follow the rename
+	rec = get("/user/alice")
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/user/alicia" {
+		t.Errorf("former name: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := get("/user/nobody"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want 404", rec.Code)
+	}
+}
+
+func TestCreatePostHandler(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	bob := addUser(t, s, "bob", "battery staple")
+	fossils, err := s.Categories.Create(ctx, "Fossils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	createPost := utils.RequireAuth(utils.RequireCSRF(CreatePostHandler))
+	session := logIn(t, s, alice)
+
+	rec := postForm(createPost, "/create_post", session, url.Values{
+		"title":       {"Found a tooth"},
+		"content":     {"Look at this, @bob"},
+		"category_id": {strconv.Itoa(fossils)},
+	}, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("status %d, want 303: %s", rec.Code, rec.Body.String())
+	}
+
+	posts, err := s.Posts.List(ctx, store.PostFilter{CategoryID: fossils})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("posts in Fossils: %+v (%v)", posts, err)
+	}
+	if p := posts[0]; p.Title != "Found a tooth" || p.UserID != alice {
+		t.Errorf("post = %+v", p)
+	}
+	if n := unread(t, s, bob); n != 1 {
+		t.Errorf("bob has %d notifications, want 1 for the mention", n)
+	}
+
+	// A category that doesn't exist is refused without saving anything
+	rec = postForm(createPost, "/create_post", session, url.Values{
+		"title":       {"Another"},
+		"content":     {"Text"},
+		"category_id": {"999"},
+	}, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "One of the selected categories") {
+		t.Fatalf("unknown category: status %d", rec.Code)
+	}
+	if posts, _ := s.Posts.List(ctx, store.PostFilter{}); len(posts) != 1 {
+		t.Errorf("%d posts after a refused one, want 1", len(posts))
+	}
+
+	// Guests are sent to the login page
+	rec = postForm(createPost, "/create_post", "", url.Values{"title": {"x"}, "content": {"y"}}, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Fatalf("guest: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestCommentHandler(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	bob := addUser(t, s, "bob", "battery staple")
+	carol := addUser(t, s, "carol", "hunter22")
+	postID, err := s.Posts.Create(ctx, alice, "Found a tooth", "Look", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment := utils.RequireAuth(utils.RequireCSRF(CommentHandler))
+
+	rec := postForm(comment, "/comment", logIn(t, s, bob), url.Values{"post_id": {strconv.Itoa(postID)}, "content": {"Nice find"}}, nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/post?id="+strconv.Itoa(postID) {
+		t.Fatalf("status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = postForm(comment, "/comment", logIn(t, s, carol), url.Values{"post_id": {strconv.Itoa(postID)}, "content": {"Agreed"}}, nil)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("second comment: status %d", rec.Code)
+	}
+
+	comments, err := s.Comments.ForPost(ctx, postID)
+	if err != nil || len(comments) != 2 || comments[0].Content != "Nice find" || comments[0].UserID != bob {
+		t.Fatalf("comments = %+v (%v)", comments, err)
+	}
+	// The author hears about both comments, the first commenter about the reply
+	if n := unread(t, s, alice); n != 2 {
+		t.Errorf("alice has %d notifications, want 2", n)
+	}
+	if n := unread(t, s, bob); n != 1 {
+		t.Errorf("bob has %d notifications, want 1", n)
+	}
+
+	rec = postForm(comment, "/comment", logIn(t, s, bob), url.Values{"post_id": {"999"}, "content": {"Hello?"}}, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("comment on a missing post: status %d, want 404", rec.Code)
+	}
+}
+
+func TestLikeHandler(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	bob := addUser(t, s, "bob", "battery staple")
+	postID, err := s.Posts.Create(ctx, alice, "Found a tooth", "Look", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	like := utils.RequireAuth(utils.RequireCSRF(LikeHandler))
+	session := logIn(t, s, bob)
+	wantJSON := http.Header{"Accept": {"application/json"}}
+
+	vote := func(isLike string) VoteResponse {
+		t.Helper()
+		rec := postForm(like, "/like", session, url.Values{"post_id": {strconv.Itoa(postID)}, "is_like": {isLike}}, wantJSON)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		var v VoteResponse
+		if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if v := vote("1"); v.Vote != "like" || v.LikeCount != 1 || v.DislikeCount != 0 {
+		t.Errorf("like: %+v", v)
+	}
+	if v := vote("0"); v.Vote != "dislike" || v.LikeCount != 0 || v.DislikeCount != 1 {
+		t.Errorf("switch to dislike: %+v", v)
+	}
+	if v := vote("0"); v.Vote != "" || v.LikeCount != 0 || v.DislikeCount != 0 {
+		t.Errorf("retract: %+v", v)
+	}
+	// The like and the dislike were worth telling alice about, the retraction wasn't
+	if n := unread(t, s, alice); n != 2 {
+		t.Errorf("alice has %d notifications, want 2", n)
+	}
+
+	// Without JavaScript the voter goes back where they came from
+	rec := postForm(like, "/like", session, url.Values{"post_id": {strconv.Itoa(postID)}, "is_like": {"1"}}, http.Header{"Referer": {"/post?id=1"}})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/post?id=1" {
+		t.Fatalf("form vote: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = postForm(like, "/like", "", url.Values{"post_id": {strconv.Itoa(postID)}, "is_like": {"1"}}, wantJSON)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("guest vote: status %d, want 401", rec.Code)
+	}
+	rec = postForm(like, "/like", session, url.Values{"post_id": {"999"}, "is_like": {"1"}}, wantJSON)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("vote on a missing post: status %d, want 404", rec.Code)
+	}
+}
+
+// slowVotes is a vote store whose reads all run past their deadline
+type slowVotes struct{ store.VoteStore }
+
+func (slowVotes) OnPosts(ctx context.Context, postIDs []int) ([]store.Reaction, error) {
+	return nil, context.DeadlineExceeded
+}
+
+func (slowVotes) OnComments(ctx context.Context, commentIDs []int) ([]store.Reaction, error) {
+	return nil, context.DeadlineExceeded
+}
+
+func (slowVotes) Received(ctx context.Context, userIDs []int) ([]store.ReceivedVotes, error) {
+	return nil, context.DeadlineExceeded
+}
+
+// uncountedNotifications is a notification store that can't count what was sent
+type uncountedNotifications struct{ store.NotificationStore }
+
+func (uncountedNotifications) SentSince(ctx context.Context, actorID int, notifType string, since time.Time) (int, error) {
+	return 0, context.DeadlineExceeded
+}
+
+func TestMentionRateLimitFailsClosed(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	bob := addUser(t, s, "bob", "battery staple")
+	postID, err := s.Posts.Create(ctx, alice, "Found a tooth", "Look @bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Notifications = uncountedNotifications{s.Notifications}
+
+	recordMentions(ctx, alice, postID, 0, "Look @bob")
+	if n := unread(t, s, bob); n != 0 {
+		t.Errorf("bob has %d notifications although the rate limit couldn't be checked", n)
+	}
+}
+
+func TestQueryTimeouts(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	bob := addUser(t, s, "bob", "battery staple")
+	postID, err := s.Posts.Create(ctx, alice, "Found a tooth", "Look", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Votes = slowVotes{s.Votes}
+	session := logIn(t, s, bob)
+
+	// Pages show the timeout instead of rendering without reactions and reputations
+	req := httptest.NewRequest(http.MethodGet, "/post?id="+strconv.Itoa(postID), nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	rec := httptest.NewRecorder()
+	ViewPostHandler(rec, req)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("post page: status %d, want 504", rec.Code)
+	}
+
+	// A reputation that can't be computed isn't a missing privilege
+	createCategory := utils.RequireAuth(utils.RequireCSRF(CreateCategoryHandler))
+	rec = postForm(createCategory, "/categories", session, url.Values{"name": {"Fossils"}}, nil)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("create category: status %d, want 504", rec.Code)
+	}
+	editCategories := utils.RequireAuth(utils.RequireCSRF(EditPostCategoriesHandler))
+	rec = postForm(editCategories, "/post/categories", session, url.Values{"post_id": {strconv.Itoa(postID)}}, nil)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("edit categories: status %d, want 504", rec.Code)
+	}
+}
+
+// countingMailer counts the emails it is asked to send
+type countingMailer struct{ sent int }
+
+func (m *countingMailer) Send(msg mailer.Message) error {
+	m.sent++
+	return nil
+}
+
+func TestQuietDigestWaitsForNextPeriod(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	fossils, err := s.Categories.Create(ctx, "Fossils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscriptions.Subscribe(ctx, alice, 0, fossils, "daily", "token"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := s.Subscriptions.ByToken(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Subscriptions.MarkSent(ctx, sub.ID, time.Now().AddDate(0, 0, -2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing happened in the category, so no email, but the day is still used up
+	m := &countingMailer{}
+	SendDigests(ctx, m)
+	if m.sent != 0 {
+		t.Errorf("sent %d emails without any activity", m.sent)
+	}
+	if due, err := s.Subscriptions.Due(ctx, time.Now()); err != nil || len(due) != 0 {
+		t.Errorf("Due after a quiet run = %+v (%v), want none", due, err)
+	}
+}
+
+func TestHomepagePages(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	for i := 1; i <= postsPerPage+1; i++ {
+		if _, err := s.Posts.Create(ctx, alice, "Fossil number "+strconv.Itoa(i)+".", "Look", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(path string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		HomeHandler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	first := get("/")
+	if strings.Contains(first, "Fossil number 1.") || !strings.Contains(first, "Fossil number 2.") || !strings.Contains(first, "/?page=2") {
+		t.Errorf("first page should list the newest %d posts and link to the next", postsPerPage)
+	}
+	second := get("/?page=2")
+	if !strings.Contains(second, "Fossil number 1.") || strings.Contains(second, "Fossil number 2.") || strings.Contains(second, "/?page=3") {
+		t.Error("second page should list only the oldest post")
+	}
+}
+
+// failingWriter is a response whose body can't be written, like a dropped connection
+type failingWriter struct{ *httptest.ResponseRecorder }
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, context.Canceled
+}
+
+func TestAccountExport(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice", "correct horse")
+	fossils, err := s.Categories.Create(ctx, "Fossils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cats := range [][]int{{fossils}, nil} {
+		if _, err := s.Posts.Create(ctx, alice, "Found a tooth", "Look", cats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session := logIn(t, s, alice)
+	export := utils.RequireAuth(AccountExportHandler)
+	request := func(format string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/account/export?format="+format, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	export(rec, request("json"))
+	var got AccountExport
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Posts) != 2 || len(got.Posts[0].Categories) != 1 || got.Posts[0].Categories[0] != "Fossils" || len(got.Posts[1].Categories) != 0 {
+		t.Errorf("exported posts = %+v", got.Posts)
+	}
+
+	// Once the download has started, a failed write drops the connection
+	for _, format := range []string{"json", "zip"} {
+		func() {
+			defer func() {
+				if r := recover(); r != http.ErrAbortHandler {
+					t.Errorf("%s export to a broken connection: recovered %v, want http.ErrAbortHandler", format, r)
+				}
+			}()
+			export(failingWriter{httptest.NewRecorder()}, request(format))
+		}()
+	}
+}
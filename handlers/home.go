@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"forum/store"
+	"forum/utils"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// PostView is used to display posts on the homepage
+type PostView struct {
+	ID           int
+	Title        string
+	Content      string
+	Author       string
+	Created      template.HTML
+	LikeCount    int
+	DislikeCount int
+	CommentCount int
+	Categories   []string
+	UserID       int
+	ViewerVote   string // "like", "dislike" or "" for the logged-in viewer
+	ReactionBar  ReactionBar
+	Reputation   int // the author's reputation
+}
+
+// postsPerPage is how many posts the homepage lists at once
+const postsPerPage = 20
+
+// pageURL links to another page of the listing, keeping the request's filters
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	} else {
+		query.Del("page")
+	}
+	if len(query) == 0 {
+		return "/"
+	}
+	return "/?" + query.Encode()
+}
+
+// HomeHandler handles GET /, listing posts, optionally only the viewer's own or liked
+// posts or those in one category
+func HomeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, username := utils.GetCurrentUser(r)
+
+	// Fetch all categories for the filter UI
+	allCategories, err := Store.Categories.All(ctx)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load categories")
+		return
+	}
+
+	// Check for category filter
+	categoryFilter := r.URL.Query().Get("category_id")
+	filter := r.URL.Query().Get("filter")
+	var postFilter store.PostFilter
+	if filter == "my" && userID != 0 {
+		postFilter.AuthorID = userID
+	} else if filter == "liked" && userID != 0 {
+		postFilter.LikedBy = userID
+	} else if categoryFilter != "" {
+		postFilter.CategoryID, _ = strconv.Atoi(categoryFilter)
+	}
+	// One page at a time, asking for one post more to know whether an older page follows
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	postFilter.Limit = postsPerPage + 1
+	postFilter.Offset = (page - 1) * postsPerPage
+	list, err := Store.Posts.List(ctx, postFilter)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load posts")
+		return
+	}
+	var newerPage, olderPage string
+	if page > 1 {
+		newerPage = pageURL(r, page-1)
+	}
+	if len(list) > postsPerPage {
+		list = list[:postsPerPage]
+		olderPage = pageURL(r, page+1)
+	}
+
+	csrfToken := utils.CSRFToken(w, r)
+	loc := utils.ViewerLocation(r)
+	var posts []PostView
+	for _, p := range list {
+		posts = append(posts, PostView{
+			ID:           p.ID,
+			Title:        p.Title,
+			Content:      p.Content,
+			Author:       p.Author,
+			Created:      utils.TimeHTML(p.CreatedAt, loc),
+			LikeCount:    p.LikeCount,
+			DislikeCount: p.DislikeCount,
+			CommentCount: p.CommentCount,
+			UserID:       p.UserID,
+		})
+	}
+
+	// Fetch reactions, categories and author reputations for the whole page at once
+	var postIDs, authorIDs []int
+	for _, p := range posts {
+		postIDs = append(postIDs, p.ID)
+		authorIDs = append(authorIDs, p.UserID)
+	}
+	reactions, err := PostReactions(ctx, postIDs, userID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load reactions")
+		return
+	}
+	categories, err := PostCategories(ctx, postIDs)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load post categories")
+		return
+	}
+	reputations, err := Reputations(ctx, authorIDs)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load reputations")
+		return
+	}
+	for i := range posts {
+		p := &posts[i]
+		p.ViewerVote = ViewerVoteIn(reactions[p.ID])
+		p.ReactionBar = ReactionBar{
+			PostID:    p.ID,
+			Reactions: reactions[p.ID],
+			LoggedIn:  userID != 0,
+			CSRFToken: csrfToken,
+		}
+		p.Categories = categories[p.ID]
+		p.Reputation = reputations[p.UserID]
+	}
+
+	// Subscription state for the category being viewed
+	categoryID, _ := strconv.Atoi(categoryFilter)
+	categorySubscription := ""
+	if categoryID > 0 {
+		categorySubscription, err = CategorySubscription(ctx, userID, categoryID)
+		if err != nil {
+			utils.HandleDatabaseError(w, err, "Failed to load subscription")
+			return
+		}
+	}
+	unreadCount, err := UnreadNotificationCount(ctx, userID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to count notifications")
+		return
+	}
+
+	data := map[string]interface{}{
+		"LoggedIn":        userID != 0,
+		"Username":        username,
+		"UserID":          userID,
+		"Posts":           posts,
+		"Categories":      allCategories,
+		"CurrentCategory": categoryFilter,
+		"CurrentFilter":   filter,
+		"CategoryID":      categoryID,
+		"Subscription":    categorySubscription,
+		"UnreadCount":     unreadCount,
+		"CSRFToken":       csrfToken,
+		"NewerPage":       newerPage,
+		"OlderPage":       olderPage,
+	}
+	tmpl, err := template.ParseFiles("templates/index.html", "templates/reactions.html")
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to load homepage template")
+		return
+	}
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to render homepage")
+		return
+	}
+}
@@ -1,16 +1,26 @@
 package handlers
 
 import (
-	"forum/database"
+	"context"
+	"forum/store"
 	"forum/utils"
 	"net/http"
 	"strconv"
 )
 
-// LikeHandler handles POST /like for posts
+// VoteResponse is returned to clients that ask /like for JSON
+type VoteResponse struct {
+	VoteEvent
+	Vote string `json:"vote"` // "like", "dislike" or "" when the user hasn't voted or retracted
+}
+
+// LikeHandler handles POST /like for posts and comments.
+// Clicking the button of the vote already cast removes it.
+// Clients sending Accept: application/json get the updated counts instead of a redirect.
 func LikeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
-		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		utils.HandleErrorJSON(w, r, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
 		return
 	}
 
@@ -23,44 +33,39 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
 	commentID, _ := strconv.Atoi(commentIDStr)
 	isLike, _ := strconv.Atoi(isLikeStr)
 	if (postID <= 0 && commentID <= 0) || (isLike != 0 && isLike != 1) {
-		utils.HandleError(w, 400, "Invalid Like Data", "Invalid post/comment ID or like value")
+		utils.HandleErrorJSON(w, r, 400, "Invalid Like Data", "Invalid post/comment ID or like value")
 		return
 	}
 
-	if commentID > 0 {
-		// Verify comment exists and belongs to a valid post
-		var postID int
-		err := database.DB.QueryRow("SELECT post_id FROM comments WHERE id = ?", commentID).Scan(&postID)
-		if err != nil {
-			utils.HandleError(w, 404, "Comment Not Found", "The comment you're trying to like doesn't exist")
-			return
-		}
+	// Verify the post or comment exists; comments also tell us their post
+	ownerID, postID, err := reactionOwner(ctx, postID, commentID)
+	if err == store.ErrNotFound && commentID > 0 {
+		utils.HandleErrorJSON(w, r, 404, "Comment Not Found", "The comment you're trying to like doesn't exist")
+		return
+	} else if err == store.ErrNotFound {
+		utils.HandleErrorJSON(w, r, 404, "Post Not Found", "The post you're trying to like doesn't exist")
+		return
+	} else if err != nil {
+		utils.HandleDatabaseErrorJSON(w, r, err, "Failed to load the post or comment")
+		return
+	}
 
-		// Like/dislike for a comment
-		var existingID int
-		err = database.DB.QueryRow("SELECT id FROM likes WHERE user_id = ? AND comment_id = ?", userID, commentID).Scan(&existingID)
-		if err == nil {
-			_, _ = database.DB.Exec("UPDATE likes SET is_like = ? WHERE id = ?", isLike, existingID)
-		} else {
-			_, _ = database.DB.Exec("INSERT INTO likes (user_id, comment_id, is_like) VALUES (?, ?, ?)", userID, commentID, isLike)
-		}
-	} else {
-		// Verify post exists
-		var postExists int
-		err := database.DB.QueryRow("SELECT COUNT(*) FROM posts WHERE id = ?", postID).Scan(&postExists)
-		if err != nil || postExists == 0 {
-			utils.HandleError(w, 404, "Post Not Found", "The post you're trying to like doesn't exist")
-			return
-		}
+	changed, err := castVote(ctx, userID, postID, commentID, isLike == 1)
+	if err != nil {
+		utils.HandleDatabaseErrorJSON(w, r, err, "Failed to save your vote")
+		return
+	}
+	// The vote is saved, so finish the follow-up work even if the client goes away
+	ctx = context.WithoutCancel(ctx)
+	// Only a new or changed vote is worth telling the author about, not a retraction
+	if changed {
+		notify(ctx, ownerID, userID, voteNotificationType(isLike), postID, commentID)
+	}
+	publishVotes(ctx, postID, commentID)
 
-		// Like/dislike for a post
-		var existingID int
-		err = database.DB.QueryRow("SELECT id FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL", userID, postID).Scan(&existingID)
-		if err == nil {
-			_, _ = database.DB.Exec("UPDATE likes SET is_like = ? WHERE id = ?", isLike, existingID)
-		} else {
-			_, _ = database.DB.Exec("INSERT INTO likes (user_id, post_id, is_like) VALUES (?, ?, ?)", userID, postID, isLike)
-		}
+	if utils.WantsJSON(r) {
+		writeVoteResponse(ctx, w, r, userID, postID, commentID)
+		return
 	}
 
 	// Redirect back to the referring page
@@ -70,3 +75,31 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	http.Redirect(w, r, ref, http.StatusSeeOther)
 }
+
+// castVote applies a like or dislike to a post or comment (commentID > 0).
+// Repeating the current vote retracts it. Reports whether a vote was added or switched.
+func castVote(ctx context.Context, userID, postID, commentID int, isLike bool) (bool, error) {
+	return Store.Votes.Cast(ctx, userID, postID, commentID, isLike)
+}
+
+// writeVoteResponse sends the counts, the user's own vote and every reaction on a post or comment
+func writeVoteResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, userID, postID, commentID int) {
+	likes, dislikes := voteCounts(ctx, postID, commentID)
+	reactions, err := ReactionsFor(ctx, postID, commentID, userID)
+	if err != nil {
+		utils.HandleDatabaseErrorJSON(w, r, err, "Failed to load reactions")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, VoteResponse{
+		VoteEvent: VoteEvent{postID, commentID, likes, dislikes, reactions},
+		Vote:      ViewerVoteIn(reactions),
+	})
+}
+
+// voteNotificationType maps an is_like value to its notification type
+func voteNotificationType(isLike int) string {
+	if isLike == 1 {
+		return "like"
+	}
+	return "dislike"
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Templates and static files are loaded relative to the repository root
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"forum/store"
+	"forum/utils"
+	"log"
+	"time"
+)
+
+const (
+	// maxMentionNotificationsPerItem caps how many people one post or comment can ping
+	maxMentionNotificationsPerItem = 10
+	// maxMentionNotificationsPerHour caps how many mention notifications one author can send per hour
+	maxMentionNotificationsPerHour = 30
+	// maxMentionsResolved bounds the lookups done for a single piece of content
+	maxMentionsResolved = 50
+)
+
+// recordMentions resolves the @usernames in content, stores them against the post
+// (or comment, when commentID > 0) and notifies newly mentioned users within the rate limits.
+// It is safe to call again after an edit: users already mentioned are never notified twice.
+func recordMentions(ctx context.Context, authorID, postID, commentID int, content string) {
+	names := utils.ParseMentions(content)
+	if len(names) > maxMentionsResolved {
+		names = names[:maxMentionsResolved]
+	}
+
+	var newlyMentioned []int
+	for _, name := range names {
+		user, err := Store.Users.ByUsername(ctx, name)
+		if err == store.ErrNotFound {
+			continue
+		} else if err != nil {
+			log.Printf("Failed to resolve mention @%s: %v", name, err)
+			continue
+		}
+
+		added, err := Store.Mentions.Add(ctx, store.Mention{PostID: postID, CommentID: commentID, UserID: user.ID, Username: name})
+		if err != nil {
+			log.Printf("Failed to record mention @%s: %v", name, err)
+			continue
+		}
+		if added && user.ID != authorID {
+			newlyMentioned = append(newlyMentioned, user.ID)
+		}
+	}
+	if len(newlyMentioned) == 0 {
+		return
+	}
+
+	// Without the count the rate limit can't be checked, so nobody is notified
+	sentThisHour, err := Store.Notifications.SentSince(ctx, authorID, "mention", time.Now().Add(-time.Hour))
+	if err != nil {
+		log.Printf("Failed to count mention notifications from user %d, none sent: %v", authorID, err)
+		return
+	}
+
+	for i, userID := range newlyMentioned {
+		if i >= maxMentionNotificationsPerItem || sentThisHour >= maxMentionNotificationsPerHour {
+			log.Printf("Mention notifications from user %d rate limited (%d skipped)", authorID, len(newlyMentioned)-i)
+			break
+		}
+		notify(ctx, userID, authorID, "mention", postID, commentID)
+		sentThisHour++
+		_ = Store.Mentions.MarkNotified(ctx, postID, commentID, userID)
+	}
+}
+
+// postMentions returns the usernames mentioned in a post body and, per comment ID, in each of its comments
+func postMentions(ctx context.Context, postID int) (map[string]bool, map[int]map[string]bool) {
+	postNames := map[string]bool{}
+	commentNames := map[int]map[string]bool{}
+
+	mentions, err := Store.Mentions.ForPost(ctx, postID)
+	if err != nil {
+		return postNames, commentNames
+	}
+	for _, m := range mentions {
+		if m.CommentID == 0 {
+			postNames[m.Username] = true
+			continue
+		}
+		if commentNames[m.CommentID] == nil {
+			commentNames[m.CommentID] = map[string]bool{}
+		}
+		commentNames[m.CommentID][m.Username] = true
+	}
+	return postNames, commentNames
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"forum/store"
+	"forum/utils"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// NotificationType describes one kind of notification a user can opt out of
+type NotificationType struct {
+	Key         string
+	Description string
+}
+
+// NotificationTypes lists every notification type in the order shown on the preferences form
+var NotificationTypes = []NotificationType{
+	{"comment", "Someone comments on your post"},
+	{"reply", "Someone else comments on a post you commented on"},
+	{"mention", "Someone mentions you with @username"},
+	{"like", "Someone likes your post or comment"},
+	{"dislike", "Someone dislikes your post or comment"},
+}
+
+// NotificationView is used to display a notification
+type NotificationView struct {
+	ID      int
+	Type    string
+	Actor   string
+	PostID  int
+	Title   string
+	Target  string
+	IsRead  bool
+	Created template.HTML
+}
+
+// notify records a notification for userID about something actorID did, unless
+// the user is acting on their own content or has turned this type off
+func notify(ctx context.Context, userID, actorID int, notifType string, postID int, commentID int) {
+	if userID == 0 || userID == actorID {
+		return
+	}
+
+	enabled, err := Store.Notifications.Enabled(ctx, userID, notifType)
+	if err == nil && !enabled {
+		return
+	}
+	if err := Store.Notifications.Create(ctx, userID, actorID, notifType, postID, commentID); err != nil {
+		log.Printf("Failed to create %s notification for user %d: %v", notifType, userID, err)
+	}
+}
+
+// UnreadNotificationCount returns how many unread notifications the user has
+func UnreadNotificationCount(ctx context.Context, userID int) (int, error) {
+	if userID == 0 {
+		return 0, nil
+	}
+	return Store.Notifications.Unread(ctx, userID)
+}
+
+// NotificationsHandler handles GET /notifications
+func NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+
+	userID, username := utils.GetCurrentUser(r)
+	loc := utils.ViewerLocation(r)
+
+	list, err := Store.Notifications.List(ctx, userID, 100)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load notifications")
+		return
+	}
+	var notifications []NotificationView
+	for _, n := range list {
+		view := NotificationView{ID: n.ID, Type: n.Type, Actor: n.Actor, PostID: n.PostID, Title: n.PostTitle, Target: "post", IsRead: n.Read}
+		if n.CommentID > 0 {
+			view.Target = "comment"
+		}
+		view.Created = utils.TimeHTML(n.CreatedAt, loc)
+		notifications = append(notifications, view)
+	}
+
+	// Current preferences, defaulting to enabled
+	saved, err := Store.Notifications.Preferences(ctx, userID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load notification preferences")
+		return
+	}
+
+	type preferenceView struct {
+		NotificationType
+		Enabled bool
+	}
+	var prefs []preferenceView
+	for _, t := range NotificationTypes {
+		enabled, ok := saved[t.Key]
+		prefs = append(prefs, preferenceView{t, enabled || !ok})
+	}
+
+	unreadCount, err := UnreadNotificationCount(ctx, userID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to count notifications")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/notifications.html")
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to load notifications template")
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"LoggedIn":      true,
+		"UserID":        userID,
+		"Username":      username,
+		"Notifications": notifications,
+		"UnreadCount":   unreadCount,
+		"Preferences":   prefs,
+		"CSRFToken":     utils.CSRFToken(w, r),
+	})
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to render notifications page")
+		return
+	}
+}
+
+// MarkNotificationReadHandler handles POST /notifications/read for a single notification.
+// With redirect=post it continues to the post the notification is about.
+func MarkNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	notificationID, err := strconv.Atoi(r.FormValue("notification_id"))
+	if err != nil || notificationID <= 0 {
+		utils.HandleError(w, 400, "Invalid Notification ID", "The notification ID provided is not valid")
+		return
+	}
+
+	postID, err := Store.Notifications.MarkRead(ctx, userID, notificationID)
+	if err == store.ErrNotFound {
+		utils.HandleError(w, 404, "Notification Not Found", "The notification doesn't exist")
+		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to update notification")
+		return
+	}
+
+	if r.FormValue("redirect") == "post" {
+		http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// MarkAllNotificationsReadHandler handles POST /notifications/read_all
+func MarkAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	if err := Store.Notifications.MarkAllRead(ctx, userID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to update notifications")
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// NotificationPreferencesHandler handles POST /notifications/preferences.
+// Every known type is saved: checked boxes enable it, unchecked ones disable it.
+func NotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	if err := r.ParseForm(); err != nil {
+		utils.HandleError(w, 400, "Invalid Form", "The preferences form could not be read")
+		return
+	}
+	checked := map[string]bool{}
+	for _, t := range r.Form["enabled"] {
+		checked[t] = true
+	}
+	enabled := map[string]bool{}
+	for _, t := range NotificationTypes {
+		enabled[t.Key] = checked[t.Key]
+	}
+	if err := Store.Notifications.SetPreferences(ctx, userID, enabled); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to save preferences")
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"forum/oidc"
+	"forum/store"
+	"forum/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcFlow is the server-side state of an in-progress OIDC sign-in
+type oidcFlow struct {
+	Provider string
+	Nonce    string
+	Verifier string
+	Expires  time.Time
+}
+
+const (
+	// oidcFlowLifetime is how long a sign-in may take at the identity provider
+	oidcFlowLifetime = 10 * time.Minute
+	// maxOIDCFlows bounds the sign-ins pending at once, so abandoned ones can't grow memory without limit
+	maxOIDCFlows = 10000
+)
+
+// oidcLink is an external identity whose verified email matches an account with a
+// password. It is linked only once the account's owner signs in with that password.
+type oidcLink struct {
+	UserID   int
+	Provider string
+	Subject  string
+	Email    string
+	Expires  time.Time
+}
+
+var (
+	oidcFlowsMu sync.Mutex
+	oidcFlows   = map[string]oidcFlow{}
+	oidcLinks   = map[string]oidcLink{} // pending links by the token in the oidc_link cookie, also guarded by oidcFlowsMu
+)
+
+// sweepOIDCFlows drops expired flows and links. The caller holds oidcFlowsMu.
+func sweepOIDCFlows(now time.Time) {
+	for s, f := range oidcFlows {
+		if now.After(f.Expires) {
+			delete(oidcFlows, s)
+		}
+	}
+	for token, l := range oidcLinks {
+		if now.After(l.Expires) {
+			delete(oidcLinks, token)
+		}
+	}
+}
+
+// putOIDCFlow stores a pending flow under its state value. It reports false when too
+// many sign-ins are already pending.
+func putOIDCFlow(state string, flow oidcFlow) bool {
+	oidcFlowsMu.Lock()
+	defer oidcFlowsMu.Unlock()
+
+	if len(oidcFlows) >= maxOIDCFlows {
+		sweepOIDCFlows(time.Now())
+		if len(oidcFlows) >= maxOIDCFlows {
+			return false
+		}
+	}
+	oidcFlows[state] = flow
+	return true
+}
+
+// takeOIDCFlow removes and returns the pending flow for a state value, if it hasn't expired
+func takeOIDCFlow(state string) (oidcFlow, bool) {
+	oidcFlowsMu.Lock()
+	defer oidcFlowsMu.Unlock()
+
+	flow, ok := oidcFlows[state]
+	delete(oidcFlows, state)
+	if ok && time.Now().After(flow.Expires) {
+		return oidcFlow{}, false
+	}
+	return flow, ok
+}
+
+// putOIDCLink stores a link waiting for a password sign-in. It reports false when too
+// many links are already pending.
+func putOIDCLink(token string, link oidcLink) bool {
+	oidcFlowsMu.Lock()
+	defer oidcFlowsMu.Unlock()
+
+	if len(oidcLinks) >= maxOIDCFlows {
+		sweepOIDCFlows(time.Now())
+		if len(oidcLinks) >= maxOIDCFlows {
+			return false
+		}
+	}
+	oidcLinks[token] = link
+	return true
+}
+
+// takeOIDCLink removes and returns the pending link for a token, if it hasn't expired
+func takeOIDCLink(token string) (oidcLink, bool) {
+	oidcFlowsMu.Lock()
+	defer oidcFlowsMu.Unlock()
+
+	link, ok := oidcLinks[token]
+	delete(oidcLinks, token)
+	if ok && time.Now().After(link.Expires) {
+		return oidcLink{}, false
+	}
+	return link, ok
+}
+
+// confirmOIDCLink links the identity waiting in the request's oidc_link cookie, now
+// that userID has signed in with their password. A link for another account is dropped.
+func confirmOIDCLink(w http.ResponseWriter, r *http.Request, userID int) {
+	cookie, err := r.Cookie("oidc_link")
+	if err != nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: "oidc_link", Value: "", Path: "/login", MaxAge: -1})
+	link, ok := takeOIDCLink(cookie.Value)
+	if !ok || link.UserID != userID {
+		return
+	}
+	if err := Store.Users.LinkIdentity(r.Context(), userID, link.Provider, link.Subject, link.Email); err != nil {
+		log.Printf("Failed to link %s identity to user %d: %v", link.Provider, userID, err)
+	}
+}
+
+// OIDCLoginHandler handles GET /oidc/login?provider=NAME by redirecting to the identity provider
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+
+	provider, ok := oidc.GetProvider(r.URL.Query().Get("provider"))
+	if !ok {
+		utils.HandleError(w, 404, "Unknown Provider", "That sign-in provider is not configured")
+		return
+	}
+
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err1 != nil || err2 != nil || err3 != nil {
+		utils.HandleError(w, 500, "Internal Server Error", "Failed to start sign-in")
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC provider %s: %v", provider.Name, err)
+		utils.HandleError(w, 502, "Sign-in Unavailable", "The identity provider could not be reached")
+		return
+	}
+
+	ok = putOIDCFlow(state, oidcFlow{
+		Provider: provider.Name,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Expires:  time.Now().Add(oidcFlowLifetime),
+	})
+	if !ok {
+		utils.HandleError(w, 503, "Sign-in Unavailable", "Too many sign-ins are in progress. Please try again in a few minutes.")
+		return
+	}
+
+	// Bind the flow to this browser so a stolen callback URL can't be replayed elsewhere
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    state,
+		Path:     "/oidc/",
+		MaxAge:   int(oidcFlowLifetime / time.Second),
+		HttpOnly: true,
+		Secure:   utils.IsSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler handles GET /oidc/callback after the identity provider authenticates the user
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+
+	// The state cookie is single use
+	http.SetCookie(w, &http.Cookie{Name: "oidc_state", Value: "", Path: "/oidc/", MaxAge: -1})
+
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		utils.HandleError(w, 403, "Sign-in Cancelled", "The identity provider did not sign you in")
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie("oidc_state")
+	if state == "" || err != nil || cookie.Value != state {
+		utils.HandleError(w, 403, "Forbidden", "Your sign-in request has expired. Please try again.")
+		return
+	}
+	flow, ok := takeOIDCFlow(state)
+	if !ok {
+		utils.HandleError(w, 403, "Forbidden", "Your sign-in request has expired. Please try again.")
+		return
+	}
+	provider, ok := oidc.GetProvider(flow.Provider)
+	if !ok {
+		utils.HandleError(w, 404, "Unknown Provider", "That sign-in provider is not configured")
+		return
+	}
+
+	claims, err := provider.Exchange(q.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Printf("OIDC provider %s: %v", provider.Name, err)
+		utils.HandleError(w, 403, "Sign-in Failed", "The identity provider's response could not be verified")
+		return
+	}
+
+	userID, link, errMsg := resolveOIDCUser(ctx, provider.Name, claims)
+	if link != nil {
+		// The account has a password: its owner confirms the link by signing in with it
+		token, err := oidc.RandomString()
+		if err != nil {
+			utils.HandleError(w, 500, "Internal Server Error", "Failed to start linking your account")
+			return
+		}
+		link.Expires = time.Now().Add(oidcFlowLifetime)
+		if !putOIDCLink(token, *link) {
+			utils.HandleError(w, 503, "Sign-in Unavailable", "Too many sign-ins are in progress. Please try again in a few minutes.")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     "oidc_link",
+			Value:    token,
+			Path:     "/login",
+			MaxAge:   int(oidcFlowLifetime / time.Second),
+			HttpOnly: true,
+			Secure:   utils.IsSecureRequest(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/login?link="+url.QueryEscape(provider.Name), http.StatusSeeOther)
+		return
+	}
+	if userID == 0 {
+		utils.HandleError(w, 403, "Sign-in Failed", errMsg)
+		return
+	}
+
+	if err := createSession(w, r, userID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to create session")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// resolveOIDCUser finds the local user for an external identity, creating a new account
+// for a verified email as needed. A verified email is linked straight away only to an
+// account without a password, which can't have been registered by someone else ahead
+// of its owner; for an account with a password it returns the link to confirm with
+// that password instead. Returns 0 and a message when sign-in must be refused.
+func resolveOIDCUser(ctx context.Context, provider string, claims *oidc.Claims) (int, *oidcLink, string) {
+	// Already linked
+	linked, err := Store.Users.ByIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		return linked.ID, nil, ""
+	} else if err != store.ErrNotFound {
+		return 0, nil, "Database error."
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !utils.ValidateEmail(email) {
+		return 0, nil, "The identity provider did not share a valid email address."
+	}
+
+	// Link to an existing account, but only when the provider vouches for the email
+	existing, err := Store.Users.ByEmailFold(ctx, email)
+	if err == nil {
+		if !claims.EmailVerified {
+			return 0, nil, "An account with this email already exists. Log in with your password instead."
+		}
+		if existing.PasswordHash != "" {
+			return 0, &oidcLink{UserID: existing.ID, Provider: provider, Subject: claims.Subject, Email: email}, ""
+		}
+		if err := Store.Users.LinkIdentity(ctx, existing.ID, provider, claims.Subject, email); err != nil {
+			return 0, nil, "Failed to link your account."
+		}
+		return existing.ID, nil, ""
+	} else if err != store.ErrNotFound {
+		return 0, nil, "Database error."
+	}
+
+	// An unverified email could belong to someone else, who would then be locked out of
+	// registering with it, or have their verified identity linked to this account later
+	if !claims.EmailVerified {
+		return 0, nil, "The identity provider has not verified your email address. Verify it with the provider, or register with a password instead."
+	}
+
+	// New account without a usable password
+	username, err := uniqueUsername(ctx, claims)
+	if err != nil {
+		return 0, nil, "Database error."
+	}
+	newID, err := Store.Users.CreateWithIdentity(ctx, email, username, provider, claims.Subject)
+	if err != nil {
+		return 0, nil, "Failed to register user."
+	}
+	return newID, nil, ""
+}
+
+// uniqueUsername derives a valid, unused username from the ID token claims
+func uniqueUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = utils.UsernameBase(base)
+
+	candidate := base
+	for i := 1; i < 1000; i++ {
+		taken, err := usernameTaken(ctx, candidate, 0)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
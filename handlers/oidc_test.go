@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"forum/oidc"
+	"forum/store"
+	"forum/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOIDCFlowsAreBounded(t *testing.T) {
+	oidcFlowsMu.Lock()
+	oidcFlows = map[string]oidcFlow{}
+	oidcFlowsMu.Unlock()
+
+	expired := oidcFlow{Provider: "mock", Expires: time.Now().Add(-time.Minute)}
+	for i := 0; i < maxOIDCFlows; i++ {
+		if !putOIDCFlow(fmt.Sprintf("old-%d", i), expired) {
+			t.Fatalf("flow %d refused below the cap", i)
+		}
+	}
+	// A full map of expired flows is swept to make room
+	live := oidcFlow{Provider: "mock", Expires: time.Now().Add(oidcFlowLifetime)}
+	if !putOIDCFlow("new", live) {
+		t.Fatal("flow refused although every pending flow had expired")
+	}
+	if len(oidcFlows) != 1 {
+		t.Fatalf("%d flows pending after the sweep, want 1", len(oidcFlows))
+	}
+
+	for i := 1; i < maxOIDCFlows; i++ {
+		putOIDCFlow(fmt.Sprintf("live-%d", i), live)
+	}
+	if putOIDCFlow("one-too-many", live) {
+		t.Fatal("flow accepted beyond the cap")
+	}
+
+	if _, ok := takeOIDCFlow("new"); !ok {
+		t.Fatal("pending flow not found")
+	}
+	if _, ok := takeOIDCFlow("new"); ok {
+		t.Fatal("flow could be used twice")
+	}
+}
+
+func TestOIDCFlowExpires(t *testing.T) {
+	putOIDCFlow("stale", oidcFlow{Provider: "mock", Expires: time.Now().Add(-time.Second)})
+	if _, ok := takeOIDCFlow("stale"); ok {
+		t.Fatal("expired flow was accepted")
+	}
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	putOIDCFlow("state-1", oidcFlow{Provider: "mock", Expires: time.Now().Add(oidcFlowLifetime)})
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+	}{
+		{"no state", "/oidc/callback?code=c", "state-1"},
+		{"no cookie", "/oidc/callback?code=c&state=state-1", ""},
+		{"cookie for another flow", "/oidc/callback?code=c&state=state-1", "state-2"},
+		{"unknown state", "/oidc/callback?code=c&state=state-3", "state-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.query, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "oidc_state", Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			OIDCCallbackHandler(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want 403", rec.Code)
+			}
+		})
+	}
+
+	// The flow is still pending: the rejected callbacks didn't consume it
+	if _, ok := takeOIDCFlow("state-1"); !ok {
+		t.Fatal("a rejected callback consumed the pending flow")
+	}
+}
+
+func TestOIDCLinksPasswordAccountOnlyAfterPasswordLogin(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	userID := addUser(t, s, "ammonite", "amber-sediment-42")
+	claims := &oidc.Claims{Subject: "sub-1", Email: "Ammonite@example.com", EmailVerified: true}
+
+	// Someone who registered the email first must not gain the verified identity
+	got, link, errMsg := resolveOIDCUser(ctx, "mock", claims)
+	if got != 0 || errMsg != "" || link == nil || link.UserID != userID {
+		t.Fatalf("resolveOIDCUser = %d, %+v, %q; want a pending link to user %d", got, link, errMsg, userID)
+	}
+	if _, err := s.Users.ByIdentity(ctx, "mock", "sub-1"); err != store.ErrNotFound {
+		t.Fatalf("identity linked before the password was confirmed: %v", err)
+	}
+
+	link.Expires = time.Now().Add(oidcFlowLifetime)
+	if !putOIDCLink("link-token", *link) {
+		t.Fatal("pending link refused")
+	}
+	header := http.Header{"Cookie": {"oidc_link=link-token"}}
+	form := url.Values{"email": {"ammonite@example.com"}, "password": {"amber-sediment-42"}}
+	rec := postForm(utils.RequireCSRF(utils.RequireGuest(LoginHandler)), "/login", "", form, header)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("login returned %d", rec.Code)
+	}
+	linked, err := s.Users.ByIdentity(ctx, "mock", "sub-1")
+	if err != nil || linked.ID != userID {
+		t.Fatalf("identity not linked after the password login: %+v, %v", linked, err)
+	}
+	if _, ok := takeOIDCLink("link-token"); ok {
+		t.Fatal("pending link left behind after it was confirmed")
+	}
+}
+
+func TestOIDCLinksPasswordlessAccount(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	userID, err := s.Users.Create(ctx, "trilobite@example.com", "trilobite", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unverified := &oidc.Claims{Subject: "sub-2", Email: "trilobite@example.com"}
+	if got, link, errMsg := resolveOIDCUser(ctx, "mock", unverified); got != 0 || link != nil || errMsg == "" {
+		t.Fatalf("unverified email resolved to %d, %+v, %q; want a refusal", got, link, errMsg)
+	}
+
+	verified := &oidc.Claims{Subject: "sub-2", Email: "trilobite@example.com", EmailVerified: true}
+	if got, link, errMsg := resolveOIDCUser(ctx, "mock", verified); got != userID || link != nil {
+		t.Fatalf("verified email resolved to %d, %+v, %q; want user %d", got, link, errMsg, userID)
+	}
+	if linked, err := s.Users.ByIdentity(ctx, "mock", "sub-2"); err != nil || linked.ID != userID {
+		t.Fatalf("identity not linked: %+v, %v", linked, err)
+	}
+}
@@ -1,38 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"forum/database"
+	"forum/store"
 	"forum/utils"
 	"html/template"
+	"log"
 	"net/http"
 	"strconv"
-	"time"
 )
 
 // CreatePostHandler handles GET and POST for /create_post
 func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _ := utils.GetCurrentUser(r)
+	ctx := r.Context()
+	userID, username := utils.GetCurrentUser(r)
 
 	if r.Method == http.MethodGet {
-		// Show the form with categories
-		cats, err := getAllCategories()
-		if err != nil {
-			utils.HandleError(w, 500, "Database Error", "Failed to load categories")
-			return
-		}
-		tmpl, err := template.ParseFiles("templates/create_post.html")
-		if err != nil {
-			utils.HandleError(w, 500, "Template Error", "Failed to load create post template")
-			return
-		}
-		err = tmpl.Execute(w, map[string]interface{}{
-			"Categories": cats,
-		})
-		if err != nil {
-			utils.HandleError(w, 500, "Template Error", "Failed to render create post page")
-			return
-		}
+		renderCreatePostPage(w, r, userID, "")
 		return
 	}
 
@@ -40,82 +25,41 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 
 		title := utils.SanitizeTitle(r.FormValue("title"))
 		content := utils.SanitizeHTML(r.FormValue("content"))
-		categoryIDs := r.Form["category_id"]
-
-		if title == "" || content == "" || len(categoryIDs) == 0 {
-			cats, err := getAllCategories()
-			if err != nil {
-				utils.HandleError(w, 500, "Database Error", "Failed to load categories")
-				return
-			}
-			tmpl, err := template.ParseFiles("templates/create_post.html")
-			if err != nil {
-				utils.HandleError(w, 500, "Template Error", "Failed to load create post template")
-				return
-			}
-			errorMsg := "All fields are required."
-			if len(categoryIDs) == 0 {
-				errorMsg = "Please select at least one category."
-			}
-			err = tmpl.Execute(w, map[string]interface{}{
-				"Error":      errorMsg,
-				"Categories": cats,
-			})
-			if err != nil {
-				utils.HandleError(w, 500, "Template Error", "Failed to render create post page")
-				return
-			}
+
+		if title == "" || content == "" {
+			renderCreatePostPage(w, r, userID, "All fields are required.")
 			return
 		}
 		if len(title) > 100 || len(content) > 1000 {
-			cats, err := getAllCategories()
-			if err != nil {
-				utils.HandleError(w, 500, "Database Error", "Failed to load categories")
-				return
-			}
-			tmpl, err := template.ParseFiles("templates/create_post.html")
-			if err != nil {
-				utils.HandleError(w, 500, "Template Error", "Failed to load create post template")
-				return
-			}
-			err = tmpl.Execute(w, map[string]interface{}{
-				"Error":      "Title or content too long.",
-				"Categories": cats,
-			})
-			if err != nil {
-				utils.HandleError(w, 500, "Template Error", "Failed to render create post page")
-				return
-			}
+			renderCreatePostPage(w, r, userID, "Title or content too long.")
 			return
 		}
-		res, err := database.DB.Exec("INSERT INTO posts (user_id, title, content) VALUES (?, ?, ?)", userID, title, content)
+		catIDs, problem, err := parsePostCategories(ctx, r.Form["category_id"])
 		if err != nil {
-			cats, err := getAllCategories()
-			if err != nil {
-				utils.HandleError(w, 500, "Database Error", "Failed to load categories")
-				return
-			}
-			tmpl, err := template.ParseFiles("templates/create_post.html")
-			if err != nil {
-				utils.HandleError(w, 500, "Template Error", "Failed to load create post template")
-				return
-			}
-			err = tmpl.Execute(w, map[string]interface{}{
-				"Error":      "Failed to create post.",
-				"Categories": cats,
-			})
-			if err != nil {
-				utils.HandleError(w, 500, "Template Error", "Failed to render create post page")
-				return
-			}
+			utils.HandleDatabaseError(w, err, "Failed to check categories")
+			return
+		} else if problem != "" {
+			renderCreatePostPage(w, r, userID, problem)
 			return
 		}
-		postID, _ := res.LastInsertId()
 
-		// Save selected categories
-		for _, catID := range categoryIDs {
-			_, _ = database.DB.Exec("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, catID)
+		// The post and its categories are saved together or not at all
+		postID, err := Store.Posts.Create(ctx, userID, title, content, catIDs)
+		if err != nil {
+			log.Printf("Failed to create post for user %d: %v", userID, err)
+			renderCreatePostPage(w, r, userID, "Failed to create post.")
+			return
 		}
+		// The post is saved, so finish the follow-up work even if the client goes away
+		ctx = context.WithoutCancel(ctx)
+		// Link and notify @mentioned users
+		recordMentions(ctx, userID, postID, 0, content)
+
+		// Follow the new thread so its author hears about replies
+		autoSubscribe(ctx, userID, postID)
+
+		// Let homepage visitors know there is something new
+		publishPost(postID, title, username)
 
 		// Success: redirect to homepage
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -126,19 +70,55 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET and POST requests")
 }
 
+// renderCreatePostPage shows the new post form with an optional error message
+func renderCreatePostPage(w http.ResponseWriter, r *http.Request, userID int, errMsg string) {
+	ctx := r.Context()
+	cats, err := getAllCategories(ctx)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load categories")
+		return
+	}
+	canCreateCategory, err := hasPrivilege(ctx, userID, "create_category")
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to check your reputation")
+		return
+	}
+	tmpl, err := template.ParseFiles("templates/create_post.html")
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to load create post template")
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Error":             errMsg,
+		"Categories":        cats,
+		"MaxCategories":     maxPostCategories,
+		"CanCreateCategory": canCreateCategory,
+		"CSRFToken":         utils.CSRFToken(w, r),
+	})
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to render create post page")
+		return
+	}
+}
+
 // CommentView is used to display comments on a post
 type CommentView struct {
 	ID           int
 	Content      string
+	ContentHTML  template.HTML
 	Author       string
-	Created      string
+	Created      template.HTML
 	LikeCount    int
 	DislikeCount int
 	UserID       int
+	ViewerVote   string // "like", "dislike" or "" for the logged-in viewer
+	ReactionBar  ReactionBar
+	Reputation   int // the author's reputation
 }
 
 // ViewPostHandler handles GET /post?id=POST_ID
 func ViewPostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	// Get post ID from query
 	idStr := r.URL.Query().Get("id")
 	postID, err := strconv.Atoi(idStr)
@@ -148,119 +128,149 @@ func ViewPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch the post
-	var postTitle, postContent, postAuthor, postCreated string
-	var postUserID int
-	err = database.DB.QueryRow(`
-		SELECT posts.title, posts.content, users.username, posts.created_at, posts.user_id
-		FROM posts
-		JOIN users ON posts.user_id = users.id
-		WHERE posts.id = ?
-	`, postID).Scan(&postTitle, &postContent, &postAuthor, &postCreated, &postUserID)
-	if err != nil {
+	post, err := Store.Posts.Get(ctx, postID)
+	if err == store.ErrNotFound {
 		utils.HandleError(w, 404, "Post Not Found", "The post you're looking for doesn't exist")
 		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load post")
+		return
 	}
+	postUserID := post.UserID
 
-	// Format post timestamp
-	postTime, err := time.Parse("2006-01-02 15:04:05", postCreated)
+	// Check if user is logged in
+	userID, username := utils.GetCurrentUser(r)
+	csrfToken := utils.CSRFToken(w, r)
+	loc := utils.ViewerLocation(r)
+
+	// Fetch comments for the post
+	list, err := Store.Comments.ForPost(ctx, postID)
 	if err != nil {
-		postTime, err = time.Parse("2006-01-02 15:04:05.000", postCreated)
+		utils.HandleDatabaseError(w, err, "Failed to load comments")
+		return
 	}
-	if err != nil {
-		postTime, err = time.Parse("2006-01-02T15:04:05Z", postCreated)
+	var comments []CommentView
+	for _, c := range list {
+		comments = append(comments, CommentView{
+			ID:           c.ID,
+			Content:      c.Content,
+			Author:       c.Author,
+			Created:      utils.TimeHTML(c.CreatedAt, loc),
+			LikeCount:    c.LikeCount,
+			DislikeCount: c.DislikeCount,
+			UserID:       c.UserID,
+		})
+	}
+
+	// Fetch reactions and author reputations for every comment at once, and
+	// render content with @mentions linked to profiles
+	var commentIDs []int
+	authorIDs := []int{postUserID}
+	for _, c := range comments {
+		commentIDs = append(commentIDs, c.ID)
+		authorIDs = append(authorIDs, c.UserID)
 	}
+	reactions, err := CommentReactions(ctx, commentIDs, userID)
 	if err != nil {
-		postTime, err = time.Parse(time.RFC3339, postCreated)
+		utils.HandleDatabaseError(w, err, "Failed to load reactions")
+		return
 	}
+	reputations, err := Reputations(ctx, authorIDs)
 	if err != nil {
-		postTime = time.Now() // fallback
+		utils.HandleDatabaseError(w, err, "Failed to load reputations")
+		return
+	}
+	postNames, commentNames := postMentions(ctx, postID)
+	for i := range comments {
+		c := &comments[i]
+		c.ViewerVote = ViewerVoteIn(reactions[c.ID])
+		c.ReactionBar = ReactionBar{
+			PostID:    postID,
+			CommentID: c.ID,
+			Reactions: reactions[c.ID],
+			LoggedIn:  userID != 0,
+			CSRFToken: csrfToken,
+		}
+		c.ContentHTML = utils.RenderMentions(c.Content, commentNames[c.ID])
+		c.Reputation = reputations[c.UserID]
 	}
-	formattedPostTime := postTime.Format("January 2, 2006 15:04")
 
-	// Fetch comments for the post
-	rows, err := database.DB.Query(`
-		SELECT comments.id, comments.content, users.username, comments.created_at, comments.user_id
-		FROM comments
-		JOIN users ON comments.user_id = users.id
-		WHERE comments.post_id = ?
-		ORDER BY comments.created_at ASC
-	`, postID)
+	// Fetch categories for the post
+	postCats, err := Store.Posts.Categories(ctx, []int{postID})
 	if err != nil {
-		utils.HandleError(w, 500, "Database Error", "Failed to load comments")
+		utils.HandleDatabaseError(w, err, "Failed to load post categories")
 		return
 	}
-	defer rows.Close()
-
-	var comments []CommentView
-	for rows.Next() {
-		var c CommentView
-		var commentTimeStr string
-		if err := rows.Scan(&c.ID, &c.Content, &c.Author, &commentTimeStr, &c.UserID); err != nil {
-			continue
-		}
+	var cats []string
+	selected := map[int]bool{}
+	for _, c := range postCats[postID] {
+		cats = append(cats, c.Name)
+		selected[c.ID] = true
+	}
 
-		// Format comment timestamp
-		commentTime, err := time.Parse("2006-01-02 15:04:05", commentTimeStr)
-		if err != nil {
-			commentTime, err = time.Parse("2006-01-02 15:04:05.000", commentTimeStr)
-		}
+	// The author, and users with enough reputation, may change the post's categories
+	var categoryOptions []CategoryOption
+	canEditCategories := userID != 0 && userID == postUserID
+	if !canEditCategories {
+		canEditCategories, err = hasPrivilege(ctx, userID, "edit_categories")
 		if err != nil {
-			commentTime, err = time.Parse("2006-01-02T15:04:05Z", commentTimeStr)
+			utils.HandleDatabaseError(w, err, "Failed to check your reputation")
+			return
 		}
+	}
+	if canEditCategories {
+		all, err := getAllCategories(ctx)
 		if err != nil {
-			commentTime, err = time.Parse(time.RFC3339, commentTimeStr)
+			utils.HandleDatabaseError(w, err, "Failed to load categories")
+			return
 		}
-		if err != nil {
-			commentTime = time.Now() // fallback
+		for _, c := range all {
+			categoryOptions = append(categoryOptions, CategoryOption{c, selected[c.ID]})
 		}
-		c.Created = commentTime.Format("January 2, 2006 15:04")
-
-		// Fetch like and dislike counts for the comment
-		likeCount := 0
-		dislikeCount := 0
-		_ = database.DB.QueryRow("SELECT COUNT(*) FROM likes WHERE comment_id = ? AND is_like = 1", c.ID).Scan(&likeCount)
-		_ = database.DB.QueryRow("SELECT COUNT(*) FROM likes WHERE comment_id = ? AND is_like = 0", c.ID).Scan(&dislikeCount)
-		c.LikeCount = likeCount
-		c.DislikeCount = dislikeCount
-		comments = append(comments, c)
 	}
 
-	// Check if user is logged in
-	userID, username := utils.GetCurrentUser(r)
-
-	// Fetch categories for the post
-	catRows, err := database.DB.Query(`SELECT categories.name FROM categories JOIN post_categories ON categories.id = post_categories.category_id WHERE post_categories.post_id = ?`, postID)
+	postReactions, err := ReactionsFor(ctx, postID, 0, userID)
 	if err != nil {
-		utils.HandleError(w, 500, "Database Error", "Failed to load post categories")
+		utils.HandleDatabaseError(w, err, "Failed to load reactions")
 		return
 	}
-	var cats []string
-	for catRows.Next() {
-		var catName string
-		catRows.Scan(&catName)
-		cats = append(cats, catName)
+	subscription, err := subscriptionFrequency(ctx, userID, postID, 0)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load subscription")
+		return
 	}
-	catRows.Close()
 
 	// Render the template
-	tmpl, err := template.ParseFiles("templates/post.html")
+	tmpl, err := template.ParseFiles("templates/post.html", "templates/reactions.html")
 	if err != nil {
 		utils.HandleError(w, 500, "Template Error", "Failed to load post template")
 		return
 	}
 
 	data := map[string]interface{}{
-		"ID":         postID,
-		"Title":      postTitle,
-		"Content":    postContent,
-		"Author":     postAuthor,
-		"Created":    formattedPostTime,
-		"Comments":   comments,
-		"LoggedIn":   userID != 0,
-		"Username":   username,
-		"UserID":     userID,
-		"PostUserID": postUserID,
-		"Categories": cats,
+		"ID":                postID,
+		"Title":             post.Title,
+		"Content":           utils.RenderMentions(post.Content, postNames),
+		"Author":            post.Author,
+		"Reputation":        reputations[postUserID],
+		"Created":           utils.TimeHTML(post.CreatedAt, loc),
+		"Timezone":          loc.String(),
+		"Comments":          comments,
+		"LoggedIn":          userID != 0,
+		"Username":          username,
+		"UserID":            userID,
+		"PostUserID":        postUserID,
+		"Categories":        cats,
+		"Subscription":      subscription,
+		"CanEditCategories": canEditCategories,
+		"CategoryOptions":   categoryOptions,
+		"ReactionBar": ReactionBar{
+			PostID:    postID,
+			Reactions: postReactions,
+			LoggedIn:  userID != 0,
+			CSRFToken: csrfToken,
+		},
+		"CSRFToken": csrfToken,
 	}
 	err = tmpl.Execute(w, data)
 	if err != nil {
@@ -270,31 +280,16 @@ func ViewPostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Category represents a forum category
-type Category struct {
-	ID   int
-	Name string
-}
+type Category = store.Category
 
-// getAllCategories fetches all categories from the database
-func getAllCategories() ([]Category, error) {
-	rows, err := database.DB.Query("SELECT id, name FROM categories ORDER BY name ASC")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var cats []Category
-	for rows.Next() {
-		var c Category
-		if err := rows.Scan(&c.ID, &c.Name); err != nil {
-			continue
-		}
-		cats = append(cats, c)
-	}
-	return cats, nil
+// getAllCategories fetches all categories, sorted by name
+func getAllCategories(ctx context.Context) ([]Category, error) {
+	return Store.Categories.All(ctx)
 }
 
 // DeletePostHandler handles POST /delete_post
 func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	if r.Method != http.MethodPost {
 		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
 		return
@@ -310,28 +305,27 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the post exists and belongs to the current user
-	var postUserID int
-	err = database.DB.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&postUserID)
-	if err != nil {
+	post, err := Store.Posts.Get(ctx, postID)
+	if err == store.ErrNotFound {
 		utils.HandleError(w, 404, "Post Not Found", "The post you're trying to delete doesn't exist")
 		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load post")
+		return
 	}
 
-	if postUserID != userID {
+	if post.UserID != userID {
 		utils.HandleError(w, 403, "Forbidden", "You can only delete your own posts")
 		return
 	}
 
-	// Delete the post (cascade will handle related data)
-	result, err := database.DB.Exec("DELETE FROM posts WHERE id = ?", postID)
-	if err != nil {
-		utils.HandleError(w, 500, "Database Error", "Failed to delete post")
+	// Delete the post along with its comments and votes
+	if err := Store.Posts.Delete(ctx, postID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to delete post")
 		return
 	}
-
-	// Check how many rows were affected
-	rowsAffected, _ := result.RowsAffected()
-	fmt.Printf("Deleted post %d, rows affected: %d\n", postID, rowsAffected)
+	fmt.Printf("Deleted post %d\n", postID)
+	publishPostDeleted(postID)
 
 	// Redirect back to homepage
 	http.Redirect(w, r, "/", http.StatusSeeOther)
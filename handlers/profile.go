@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"forum/store"
+	"forum/utils"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProfilePost is a post listed on a user's profile
+type ProfilePost struct {
+	ID      int
+	Title   string
+	Created template.HTML
+}
+
+// ProfileHandler handles GET /user/{name}. Former usernames redirect to the current one.
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodGet {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET requests")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/user/")
+	if name == "" || strings.Contains(name, "/") {
+		utils.HandleError(w, 404, "User Not Found", "The user you're looking for doesn't exist")
+		return
+	}
+
+	loc := utils.ViewerLocation(r)
+	profile, err := Store.Users.ByUsername(ctx, name)
+	if err == store.ErrNotFound {
+		// Follow the most recent rename away from this name
+		current, err := Store.Users.RenamedTo(ctx, name)
+		if err == store.ErrNotFound {
+			utils.HandleError(w, 404, "User Not Found", "The user you're looking for doesn't exist")
+			return
+		} else if err != nil {
+			utils.HandleDatabaseError(w, err, "Failed to load user")
+			return
+		}
+		http.Redirect(w, r, "/user/"+url.PathEscape(current), http.StatusMovedPermanently)
+		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load user")
+		return
+	}
+
+	written, err := Store.Posts.List(ctx, store.PostFilter{AuthorID: profile.ID})
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load posts")
+		return
+	}
+	var posts []ProfilePost
+	for _, p := range written {
+		posts = append(posts, ProfilePost{ID: p.ID, Title: p.Title, Created: utils.TimeHTML(p.CreatedAt, loc)})
+	}
+
+	commentCount, err := Store.Comments.CountByUser(ctx, profile.ID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to count comments")
+		return
+	}
+
+	// Privileges unlocked so far, and the next one to aim for
+	reputation, err := Reputation(ctx, profile.ID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load reputation")
+		return
+	}
+	var unlocked []Privilege
+	var next *Privilege
+	for i, p := range Privileges {
+		if reputation >= p.MinReputation {
+			unlocked = append(unlocked, p)
+		} else if next == nil {
+			next = &Privileges[i]
+		}
+	}
+
+	userID, username := utils.GetCurrentUser(r)
+	tmpl, err := template.ParseFiles("templates/user.html")
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to load profile template")
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"LoggedIn":      userID != 0,
+		"UserID":        userID,
+		"Username":      username,
+		"ProfileName":   profile.Username,
+		"Joined":        joinedDate(profile.CreatedAt, loc),
+		"Posts":         posts,
+		"CommentCount":  commentCount,
+		"Reputation":    reputation,
+		"Privileges":    unlocked,
+		"NextPrivilege": next,
+	})
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to render profile page")
+		return
+	}
+}
+
+// joinedDate formats the day a user registered, in the viewer's timezone
+func joinedDate(joined time.Time, loc *time.Location) string {
+	if joined.IsZero() {
+		return "unknown date"
+	}
+	return joined.In(loc).Format("January 2, 2006")
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"forum/store"
+	"forum/utils"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReactionType is one emoji users can react with
+type ReactionType struct {
+	Key   string
+	Emoji string
+}
+
+// voteReactions are the like/dislike reactions; they are always available and
+// a user can hold at most one of them on a post or comment
+var voteReactions = []ReactionType{
+	{"like", "👍"},
+	{"dislike", "👎"},
+}
+
+// ReactionTypes lists every reaction in display order, starting with like and dislike
+var ReactionTypes = append(append([]ReactionType{}, voteReactions...),
+	ReactionType{"heart", "❤️"},
+	ReactionType{"laugh", "😂"},
+	ReactionType{"wow", "😮"},
+	ReactionType{"sad", "😢"},
+)
+
+// reactionKeyPattern keeps keys safe for URLs, CSS classes and the database
+var reactionKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,20}$`)
+
+// maxReactorsShown caps the names listed when hovering over a reaction
+const maxReactorsShown = 20
+
+// LoadReactionTypes replaces the extra reactions with a comma-separated list of
+// key=emoji pairs, e.g. "heart=❤️,fire=🔥". Like and dislike are always kept.
+func LoadReactionTypes(spec string) error {
+	types := append([]ReactionType{}, voteReactions...)
+	seen := map[string]bool{"like": true, "dislike": true}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return fmt.Errorf("reaction %q must look like key=emoji", item)
+		}
+		key := strings.TrimSpace(parts[0])
+		if !reactionKeyPattern.MatchString(key) {
+			return fmt.Errorf("reaction key %q must be 1-20 lowercase letters, digits or underscores", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("reaction %q is listed twice", key)
+		}
+		seen[key] = true
+		types = append(types, ReactionType{key, strings.TrimSpace(parts[1])})
+	}
+	ReactionTypes = types
+	return nil
+}
+
+// isReactionType reports whether key is a configured reaction
+func isReactionType(key string) bool {
+	for _, t := range ReactionTypes {
+		if t.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ReactionSummary is one reaction's count on a post or comment
+type ReactionSummary struct {
+	Key    string   `json:"key"`
+	Emoji  string   `json:"emoji"`
+	Count  int      `json:"count"`
+	Users  []string `json:"users"`            // first reactors, for the hover list
+	Viewer bool     `json:"viewer,omitempty"` // the logged-in user reacted with this
+}
+
+// Who lists the users who reacted, for the hover text
+func (s ReactionSummary) Who() string {
+	if s.Count == 0 {
+		return ""
+	}
+	who := strings.Join(s.Users, ", ")
+	if s.Count > len(s.Users) {
+		who += fmt.Sprintf(" and %d more", s.Count-len(s.Users))
+	}
+	return who
+}
+
+// ReactionBar is everything the reactions template needs for one post or comment
+type ReactionBar struct {
+	PostID    int
+	CommentID int
+	Reactions []ReactionSummary
+	LoggedIn  bool
+	CSRFToken string
+}
+
+// emptyReactions returns a zero-count summary for every configured reaction
+func emptyReactions() []ReactionSummary {
+	summaries := make([]ReactionSummary, len(ReactionTypes))
+	for i, t := range ReactionTypes {
+		summaries[i] = ReactionSummary{Key: t.Key, Emoji: t.Emoji, Users: []string{}}
+	}
+	return summaries
+}
+
+// ReactionsFor summarises every configured reaction on a post or comment (commentID > 0),
+// marking the ones viewerID used
+func ReactionsFor(ctx context.Context, postID, commentID, viewerID int) ([]ReactionSummary, error) {
+	if commentID > 0 {
+		reactions, err := CommentReactions(ctx, []int{commentID}, viewerID)
+		return reactions[commentID], err
+	}
+	reactions, err := PostReactions(ctx, []int{postID}, viewerID)
+	return reactions[postID], err
+}
+
+// PostReactions summarises the reactions on each of the posts
+func PostReactions(ctx context.Context, postIDs []int, viewerID int) (map[int][]ReactionSummary, error) {
+	reactions, err := Store.Votes.OnPosts(ctx, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	return summarise(postIDs, reactions, func(r store.Reaction) int { return r.PostID }, viewerID), nil
+}
+
+// CommentReactions summarises the reactions on each of the comments
+func CommentReactions(ctx context.Context, commentIDs []int, viewerID int) (map[int][]ReactionSummary, error) {
+	reactions, err := Store.Votes.OnComments(ctx, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	return summarise(commentIDs, reactions, func(r store.Reaction) int { return r.CommentID }, viewerID), nil
+}
+
+// summarise counts reactions per target (as picked by targetOf) into a summary of every
+// configured reaction, for each of ids
+func summarise(ids []int, reactions []store.Reaction, targetOf func(store.Reaction) int, viewerID int) map[int][]ReactionSummary {
+	result := make(map[int][]ReactionSummary, len(ids))
+	for _, id := range ids {
+		result[id] = emptyReactions()
+	}
+	index := map[string]int{}
+	for i, t := range ReactionTypes {
+		index[t.Key] = i
+	}
+	for _, r := range reactions {
+		i, ok := index[r.Key]
+		summaries, found := result[targetOf(r)]
+		if !ok || !found {
+			continue // reaction no longer configured
+		}
+		s := &summaries[i]
+		s.Count++
+		if len(s.Users) < maxReactorsShown {
+			s.Users = append(s.Users, r.Username)
+		}
+		if viewerID != 0 && r.UserID == viewerID {
+			s.Viewer = true
+		}
+	}
+	return result
+}
+
+// ViewerVoteIn returns "like", "dislike" or "" for the viewer's vote recorded in summaries
+func ViewerVoteIn(summaries []ReactionSummary) string {
+	for _, s := range summaries {
+		if s.Viewer && (s.Key == "like" || s.Key == "dislike") {
+			return s.Key
+		}
+	}
+	return ""
+}
+
+// toggleReaction adds the reaction if the user hasn't used it on the post or comment yet,
+// and removes it otherwise. Like and dislike go through castVote so only one of them is held.
+// Reports whether a reaction was added.
+func toggleReaction(ctx context.Context, userID, postID, commentID int, key string) (bool, error) {
+	if key == "like" || key == "dislike" {
+		return castVote(ctx, userID, postID, commentID, key == "like")
+	}
+	return Store.Votes.Toggle(ctx, userID, postID, commentID, key)
+}
+
+// reactionOwner checks the post or comment (commentID > 0) exists and returns its
+// author and, for comments, the post it belongs to
+func reactionOwner(ctx context.Context, postID, commentID int) (ownerID int, parentPostID int, err error) {
+	if commentID > 0 {
+		c, err := Store.Comments.Get(ctx, commentID)
+		return c.UserID, c.PostID, err
+	}
+	p, err := Store.Posts.Get(ctx, postID)
+	return p.UserID, postID, err
+}
+
+// ReactHandler handles POST /react, toggling one reaction on a post or comment.
+// Clients sending Accept: application/json get the updated reactions instead of a redirect.
+func ReactHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleErrorJSON(w, r, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	postID, _ := strconv.Atoi(r.FormValue("post_id"))
+	commentID, _ := strconv.Atoi(r.FormValue("comment_id"))
+	key := r.FormValue("reaction")
+	if (postID <= 0 && commentID <= 0) || !isReactionType(key) {
+		utils.HandleErrorJSON(w, r, 400, "Invalid Reaction", "Invalid post/comment ID or reaction")
+		return
+	}
+
+	ownerID, postID, err := reactionOwner(ctx, postID, commentID)
+	if err == store.ErrNotFound {
+		utils.HandleErrorJSON(w, r, 404, "Not Found", "The post or comment you're reacting to doesn't exist")
+		return
+	} else if err != nil {
+		utils.HandleDatabaseErrorJSON(w, r, err, "Failed to load the post or comment")
+		return
+	}
+
+	added, err := toggleReaction(ctx, userID, postID, commentID, key)
+	if err != nil {
+		utils.HandleDatabaseErrorJSON(w, r, err, "Failed to save your reaction")
+		return
+	}
+	// The reaction is saved, so finish the follow-up work even if the client goes away
+	ctx = context.WithoutCancel(ctx)
+	if added && (key == "like" || key == "dislike") {
+		notify(ctx, ownerID, userID, key, postID, commentID)
+	}
+	publishVotes(ctx, postID, commentID)
+
+	if utils.WantsJSON(r) {
+		writeVoteResponse(ctx, w, r, userID, postID, commentID)
+		return
+	}
+	ref := r.Referer()
+	if ref == "" {
+		ref = "/"
+	}
+	http.Redirect(w, r, ref, http.StatusSeeOther)
+}
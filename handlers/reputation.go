@@ -0,0 +1,97 @@
+package handlers
+
+import "context"
+
+// Reputation earned or lost per vote received. Self-votes never count.
+const (
+	repPostLike       = 10
+	repCommentLike    = 5
+	repPostDislike    = 2
+	repCommentDislike = 1
+	// repDailyCap limits how much reputation votes can earn a user in one (UTC) day;
+	// losses are not capped
+	repDailyCap = 200
+)
+
+// Privilege is something users unlock by earning reputation
+type Privilege struct {
+	Key           string
+	Description   string
+	MinReputation int
+}
+
+// Privileges lists every privilege in the order they unlock
+var Privileges = []Privilege{
+	{"create_category", "Create new categories", 100},
+	{"edit_categories", "Edit the categories of other people's posts", 250},
+}
+
+// Reputations computes the reputation of each user in userIDs from the likes and
+// dislikes received on their posts and comments
+func Reputations(ctx context.Context, userIDs []int) (map[int]int, error) {
+	reps := map[int]int{}
+	seen := map[int]bool{}
+	var distinct []int
+	for _, id := range userIDs {
+		if !seen[id] {
+			seen[id] = true
+			distinct = append(distinct, id)
+		}
+	}
+	if len(distinct) == 0 {
+		return reps, nil
+	}
+	received, err := Store.Votes.Received(ctx, distinct)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gains are capped per user and day, across posts and comments
+	type userDay struct {
+		userID int
+		day    string
+	}
+	gains := map[userDay]int{}
+	for _, v := range received {
+		if v.OnComment {
+			gains[userDay{v.UserID, v.Day}] += v.Likes * repCommentLike
+			reps[v.UserID] -= v.Dislikes * repCommentDislike
+		} else {
+			gains[userDay{v.UserID, v.Day}] += v.Likes * repPostLike
+			reps[v.UserID] -= v.Dislikes * repPostDislike
+		}
+	}
+	for d, gain := range gains {
+		if gain > repDailyCap {
+			gain = repDailyCap
+		}
+		reps[d.userID] += gain
+	}
+	for id, rep := range reps {
+		if rep < 0 {
+			reps[id] = 0
+		}
+	}
+	return reps, nil
+}
+
+// Reputation returns one user's reputation
+func Reputation(ctx context.Context, userID int) (int, error) {
+	reps, err := Reputations(ctx, []int{userID})
+	return reps[userID], err
+}
+
+// hasPrivilege reports whether the user has earned enough reputation for the privilege.
+// An error means the reputation couldn't be computed, not that the privilege is missing.
+func hasPrivilege(ctx context.Context, userID int, key string) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	for _, p := range Privileges {
+		if p.Key == key {
+			rep, err := Reputation(ctx, userID)
+			return rep >= p.MinReputation, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"forum/store"
+	"forum/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// accountChangeCooldown is the minimum time between two changes of the same field
+const accountChangeCooldown = 30 * 24 * time.Hour
+
+// checkAccountPassword re-confirms the user's password. Accounts without a
+// password (created through OpenID Connect) always pass.
+func checkAccountPassword(ctx context.Context, userID int, password string) (bool, error) {
+	user, err := Store.Users.Get(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if user.PasswordHash == "" {
+		return true, nil
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil, nil
+}
+
+// usernameTaken reports whether a username belongs to another user, either
+// currently or as a former name that still redirects to their profile
+func usernameTaken(ctx context.Context, username string, userID int) (bool, error) {
+	return Store.Users.UsernameTaken(ctx, username, userID)
+}
+
+// changeCooldownLeft returns how long the user must wait before changing field again
+func changeCooldownLeft(ctx context.Context, userID int, field string) (time.Duration, error) {
+	last, err := Store.Users.LastChange(ctx, userID, field)
+	if err == store.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	left := time.Until(last.Add(accountChangeCooldown))
+	if left < 0 {
+		return 0, nil
+	}
+	return left, nil
+}
+
+// cooldownMessage formats the error shown while a field is still on cooldown
+func cooldownMessage(field string, left time.Duration) string {
+	days := int(left.Hours()/24) + 1
+	return fmt.Sprintf("You can change your %s again in %d day(s).", field, days)
+}
+
+// ChangeUsernameHandler handles POST /account/username
+func ChangeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, username := utils.GetCurrentUser(r)
+	newUsername := strings.TrimSpace(r.FormValue("new_username"))
+
+	if valid, errMsg := utils.ValidateUsername(newUsername); !valid {
+		renderAccountPage(w, r, errMsg)
+		return
+	}
+	if newUsername == username {
+		renderAccountPage(w, r, "That is already your username.")
+		return
+	}
+	if ok, err := checkAccountPassword(ctx, userID, r.FormValue("password")); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account")
+		return
+	} else if !ok {
+		renderAccountPage(w, r, "Incorrect password.")
+		return
+	}
+	if left, err := changeCooldownLeft(ctx, userID, "username"); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account history")
+		return
+	} else if left > 0 {
+		renderAccountPage(w, r, cooldownMessage("username", left))
+		return
+	}
+	if taken, err := usernameTaken(ctx, newUsername, userID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to check username")
+		return
+	} else if taken {
+		renderAccountPage(w, r, "That username is already taken.")
+		return
+	}
+
+	if err := Store.Users.Change(ctx, userID, "username", username, newUsername); err != nil {
+		renderAccountPage(w, r, "Failed to change username.")
+		return
+	}
+	http.Redirect(w, r, "/account?updated=username", http.StatusSeeOther)
+}
+
+// ChangeEmailHandler handles POST /account/email
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	newEmail := strings.TrimSpace(r.FormValue("new_email"))
+
+	if !utils.ValidateEmail(newEmail) {
+		renderAccountPage(w, r, "Please enter a valid email address.")
+		return
+	}
+	user, err := Store.Users.Get(ctx, userID)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account")
+		return
+	}
+	if newEmail == user.Email {
+		renderAccountPage(w, r, "That is already your email address.")
+		return
+	}
+	if ok, err := checkAccountPassword(ctx, userID, r.FormValue("password")); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account")
+		return
+	} else if !ok {
+		renderAccountPage(w, r, "Incorrect password.")
+		return
+	}
+	if left, err := changeCooldownLeft(ctx, userID, "email"); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load account history")
+		return
+	} else if left > 0 {
+		renderAccountPage(w, r, cooldownMessage("email", left))
+		return
+	}
+	if taken, err := Store.Users.EmailTaken(ctx, newEmail, userID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to check email")
+		return
+	} else if taken {
+		renderAccountPage(w, r, "That email address is already in use.")
+		return
+	}
+
+	if err := Store.Users.Change(ctx, userID, "email", user.Email, newEmail); err != nil {
+		renderAccountPage(w, r, "Failed to change email.")
+		return
+	}
+	http.Redirect(w, r, "/account?updated=email", http.StatusSeeOther)
+}
+
+// ChangeTimezoneHandler handles POST /account/timezone. An empty timezone goes back to the forum's default.
+func ChangeTimezoneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	timezone := strings.TrimSpace(r.FormValue("timezone"))
+	if timezone != "" && !utils.ValidTimezone(timezone) {
+		renderAccountPage(w, r, "Unknown timezone. Use a name such as Europe/Berlin or America/New_York.")
+		return
+	}
+	if err := Store.Users.SetTimezone(ctx, userID, timezone); err != nil {
+		renderAccountPage(w, r, "Failed to change timezone.")
+		return
+	}
+	http.Redirect(w, r, "/account?updated=timezone", http.StatusSeeOther)
+}
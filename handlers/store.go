@@ -0,0 +1,8 @@
+package handlers
+
+import "forum/store"
+
+// Store is where the post, comment, vote, category, user and session handlers read
+// and write their data, along with the notifications, mentions and subscriptions they
+// trigger. main sets it to the SQLite or Postgres stores; tests use store.NewMemory().
+var Store *store.Store
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"forum/mailer"
+	"forum/store"
+	"forum/utils"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BaseURL is the public address of the forum, used for links in emails
+var BaseURL = "http://localhost:8080"
+
+// validFrequency reports whether f is a supported digest schedule
+func validFrequency(f string) bool {
+	return f == "immediate" || f == "daily" || f == "weekly"
+}
+
+// subscribe creates or updates a subscription to a post (postID > 0) or a category
+func subscribe(ctx context.Context, userID, postID, categoryID int, frequency string) error {
+	return Store.Subscriptions.Subscribe(ctx, userID, postID, categoryID, frequency, uuid.New().String())
+}
+
+// autoSubscribe follows a post for its author or a commenter, keeping any schedule they already chose
+func autoSubscribe(ctx context.Context, userID, postID int) {
+	if err := Store.Subscriptions.Follow(ctx, userID, postID, uuid.New().String()); err != nil {
+		log.Printf("Failed to subscribe user %d to post %d: %v", userID, postID, err)
+	}
+}
+
+// subscriptionFrequency returns the user's schedule for a post or category subscription, or "" if not subscribed
+func subscriptionFrequency(ctx context.Context, userID, postID, categoryID int) (string, error) {
+	if userID == 0 {
+		return "", nil
+	}
+	return Store.Subscriptions.Frequency(ctx, userID, postID, categoryID)
+}
+
+// CategorySubscription returns the user's digest schedule for a category, or "" if not subscribed
+func CategorySubscription(ctx context.Context, userID, categoryID int) (string, error) {
+	return subscriptionFrequency(ctx, userID, 0, categoryID)
+}
+
+// subscriptionTarget reads post_id or category_id from the form and checks it exists
+func subscriptionTarget(r *http.Request) (postID int, categoryID int, ok bool, err error) {
+	ctx := r.Context()
+	postID, _ = strconv.Atoi(r.FormValue("post_id"))
+	categoryID, _ = strconv.Atoi(r.FormValue("category_id"))
+	if postID > 0 {
+		_, err = Store.Posts.Get(ctx, postID)
+		if err == store.ErrNotFound {
+			return postID, categoryID, false, nil
+		}
+		return postID, categoryID, err == nil, err
+	}
+	if categoryID > 0 {
+		ok, err = Store.Categories.AllExist(ctx, []int{categoryID})
+	}
+	return postID, categoryID, ok, err
+}
+
+// subscriptionRedirect sends the user back to the post or category they (un)subscribed from
+func subscriptionRedirect(w http.ResponseWriter, r *http.Request, postID, categoryID int) {
+	if postID > 0 {
+		http.Redirect(w, r, "/post?id="+strconv.Itoa(postID), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/?category_id="+strconv.Itoa(categoryID), http.StatusSeeOther)
+}
+
+// SubscribeHandler handles POST /subscribe for a post or category
+func SubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	postID, categoryID, ok, err := subscriptionTarget(r)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load the post or category")
+		return
+	} else if !ok {
+		utils.HandleError(w, 404, "Not Found", "The post or category you're trying to follow doesn't exist")
+		return
+	}
+	frequency := r.FormValue("frequency")
+	if !validFrequency(frequency) {
+		utils.HandleError(w, 400, "Invalid Frequency", "Digest frequency must be immediate, daily or weekly")
+		return
+	}
+
+	if err := subscribe(ctx, userID, postID, categoryID, frequency); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to save subscription")
+		return
+	}
+	subscriptionRedirect(w, r, postID, categoryID)
+}
+
+// UnsubscribeHandler handles POST /unsubscribe for a post or category
+func UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method != http.MethodPost {
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts POST requests")
+		return
+	}
+
+	userID, _ := utils.GetCurrentUser(r)
+	postID, categoryID, ok, err := subscriptionTarget(r)
+	if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load the post or category")
+		return
+	} else if !ok {
+		utils.HandleError(w, 404, "Not Found", "The post or category you're trying to unfollow doesn't exist")
+		return
+	}
+
+	if err := Store.Subscriptions.Unsubscribe(ctx, userID, postID, categoryID); err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to remove subscription")
+		return
+	}
+	subscriptionRedirect(w, r, postID, categoryID)
+}
+
+// EmailUnsubscribeHandler handles the unsubscribe link in digest emails.
+// GET shows a confirmation button so link scanners can't unsubscribe anyone;
+// POST (the button, or a mail client's RFC 8058 one-click request) removes the subscription.
+// The secret token authenticates the request, so no login or CSRF token is needed.
+func EmailUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.URL.Query().Get("token")
+
+	sub, err := Store.Subscriptions.ByToken(ctx, token)
+	if token == "" || err == store.ErrNotFound {
+		utils.HandleError(w, 404, "Subscription Not Found", "You are already unsubscribed")
+		return
+	} else if err != nil {
+		utils.HandleDatabaseError(w, err, "Failed to load subscription")
+		return
+	}
+
+	done := false
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := Store.Subscriptions.DeleteByToken(ctx, token); err != nil {
+			utils.HandleDatabaseError(w, err, "Failed to remove subscription")
+			return
+		}
+		done = true
+	default:
+		utils.HandleError(w, 405, "Method Not Allowed", "This endpoint only accepts GET and POST requests")
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/unsubscribe.html")
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to load unsubscribe template")
+		return
+	}
+	err = tmpl.Execute(w, map[string]interface{}{
+		"Target": sub.Target,
+		"Token":  token,
+		"Done":   done,
+	})
+	if err != nil {
+		utils.HandleError(w, 500, "Template Error", "Failed to render unsubscribe page")
+		return
+	}
+}
+
+// SendDigests emails new activity for every subscription whose schedule is due
+func SendDigests(ctx context.Context, m mailer.Mailer) {
+	// Whole seconds, the precision SQLite stores
+	now := time.Now().Truncate(time.Second)
+
+	due, err := Store.Subscriptions.Due(ctx, now)
+	if err != nil {
+		log.Printf("Failed to load due subscriptions: %v", err)
+		return
+	}
+
+	ids := make([]int, len(due))
+	for i, s := range due {
+		ids[i] = s.ID
+	}
+	activity, err := Store.Subscriptions.Activity(ctx, ids, now)
+	if err != nil {
+		log.Printf("Failed to load digest activity: %v", err)
+		return
+	}
+
+	for _, s := range due {
+		// A subscription with nothing new is still marked sent, so a quiet daily or
+		// weekly one waits for its next period instead of being checked every run
+		if items := activity[s.ID]; len(items) > 0 {
+			if err := m.Send(buildDigest(s, items)); err != nil {
+				log.Printf("Failed to send digest for subscription %d: %v", s.ID, err)
+				continue
+			}
+		}
+		if err := Store.Subscriptions.MarkSent(ctx, s.ID, now); err != nil {
+			log.Printf("Failed to mark digest sent for subscription %d: %v", s.ID, err)
+		}
+	}
+}
+
+// buildDigest writes the email for a subscription's new activity
+func buildDigest(s store.Subscription, items []store.DigestItem) mailer.Message {
+
+	unsubscribeURL := BaseURL + "/email_unsubscribe?token=" + url.QueryEscape(s.Token)
+	var b strings.Builder
+	var subject string
+	if s.PostID > 0 {
+		for _, item := range items {
+			fmt.Fprintf(&b, "%s wrote:\n%s\n\n", item.Author, html.UnescapeString(item.Content))
+		}
+		subject = fmt.Sprintf("%d new comment(s) on \"%s\"", len(items), html.UnescapeString(s.Target))
+		fmt.Fprintf(&b, "Read the discussion: %s/post?id=%d\n", BaseURL, s.PostID)
+	} else {
+		for _, item := range items {
+			fmt.Fprintf(&b, "%s by %s\n%s/post?id=%d\n\n", html.UnescapeString(item.Title), item.Author, BaseURL, item.PostID)
+		}
+		subject = fmt.Sprintf("%d new post(s) in %s", len(items), s.Target)
+	}
+	fmt.Fprintf(&b, "\n--\nYou receive this %s email because you follow this on DinoForum.\nUnsubscribe: %s\n", s.Frequency, unsubscribeURL)
+
+	return mailer.Message{
+		To:      s.Email,
+		Subject: "[DinoForum] " + subject,
+		Body:    b.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+}
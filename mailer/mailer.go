@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	Headers map[string]string // extra headers such as List-Unsubscribe
+}
+
+// Mailer delivers email. Implementations must be safe for use from a background goroutine.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them; used when SMTP isn't configured
+type LogMailer struct{}
+
+// Send logs the message
+func (LogMailer) Send(msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server
+type SMTPMailer struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message over SMTP, authenticating when a username is set
+func (m SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := strings.Split(m.Addr, ":")[0]
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	// The envelope sender must be a bare address, without any display name
+	envelopeFrom := m.From
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		envelopeFrom = addr.Address
+	}
+	return smtp.SendMail(m.Addr, auth, envelopeFrom, []string{msg.To}, m.build(msg))
+}
+
+// build renders the RFC 5322 message
+func (m SMTPMailer) build(msg Message) []byte {
+	headers := map[string]string{
+		"From":                      m.From,
+		"To":                        msg.To,
+		"Subject":                   msg.Subject,
+		"Date":                      time.Now().Format(time.RFC1123Z),
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "8bit",
+	}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		// Header values never contain user-controlled newlines, but be safe anyway
+		v := strings.NewReplacer("\r", " ", "\n", " ").Replace(headers[k])
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// FromEnv returns an SMTPMailer when SMTP_HOST is set, otherwise a LogMailer.
+// Reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM.
+func FromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogMailer{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "DinoForum <noreply@" + host + ">"
+	}
+	return SMTPMailer{
+		Addr:     host + ":" + port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RandomString returns a URL-safe random string suitable for state, nonce and PKCE verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge derives the S256 PKCE challenge from a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL builds the authorization request URL the browser is redirected to
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	doc, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the verified ID token claims
+func (p *Provider) Exchange(code, verifier, nonce string) (*Claims, error) {
+	doc, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tok struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", tok.Error, tok.ErrorDescription)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return p.verifyIDToken(tok.IDToken, nonce)
+}
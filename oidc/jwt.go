@@ -0,0 +1,242 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clockSkew is the tolerance applied to exp and iat checks
+const clockSkew = 2 * time.Minute
+
+// Claims are the ID token claims the forum cares about
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Name              string   `json:"name"`
+}
+
+// audience accepts both the string and array forms of the aud claim
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// flexBool accepts both true and "true", since some providers send email_verified as a string
+type flexBool bool
+
+func (f *flexBool) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	*f = flexBool(s == "true")
+	return nil
+}
+
+// jwk is a single JSON Web Key as served by the jwks_uri
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts an RSA or EC P-256 JWK into a Go public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// getKey returns the signing key with the given kid, refreshing the JWKS when the kid is unknown
+func (p *Provider) getKey(kid string) (crypto.PublicKey, error) {
+	doc, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// Don't let a stream of bogus kids hammer the provider
+	if time.Since(p.keysAt) < 30*time.Second && p.keys != nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	resp, err := httpClient.Get(doc.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: status %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	p.keys = map[string]crypto.PublicKey{}
+	p.keysAt = time.Now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		p.keys[k.Kid] = key
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verifyIDToken checks the signature and standard claims of an ID token and returns its claims
+func (p *Provider) verifyIDToken(token string, nonce string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil {
+		return nil, errors.New("malformed ID token header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed ID token signature")
+	}
+
+	key, err := p.getKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errors.New("invalid ID token signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return nil, errors.New("invalid ID token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return nil, errors.New("invalid ID token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed ID token payload")
+	}
+	var claims Claims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, errors.New("malformed ID token payload")
+	}
+
+	now := time.Now()
+	if strings.TrimSuffix(claims.Issuer, "/") != p.Issuer {
+		return nil, errors.New("ID token issuer mismatch")
+	}
+	if !containsString(claims.Audience, p.ClientID) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, errors.New("ID token authorized party mismatch")
+	}
+	if claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return nil, errors.New("ID token has expired")
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return nil, errors.New("ID token issued in the future")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	return &claims, nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIdP is a local identity provider serving discovery, JWKS and token endpoints.
+// authorize stands in for the browser's visit to the authorization endpoint.
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// signer signs ID tokens; set it to another key to issue bad signatures
+	signer *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is what the provider remembers about an issued authorization code
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{key: key, signer: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discoveryDoc{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		grant, ok := m.codes[r.FormValue("code")]
+		delete(m.codes, r.FormValue("code"))
+		m.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken(t, grant.nonce)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// provider returns a Provider configured for the mock
+func (m *mockIdP) provider() *Provider {
+	return &Provider{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    "forum",
+		RedirectURL: "http://forum.test/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	}
+}
+
+// authorize checks an authorization request URL and returns the code the provider redirects back with
+func (m *mockIdP) authorize(t *testing.T, authURL, state string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != state {
+		t.Fatalf("state = %q, want %q", q.Get("state"), state)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization request has no S256 PKCE challenge: %s", authURL)
+	}
+	if q.Get("nonce") == "" {
+		t.Fatalf("authorization request has no nonce: %s", authURL)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + state
+	m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code
+}
+
+// idToken returns an RS256 ID token for a verified test user
+func (m *mockIdP) idToken(t *testing.T, nonce string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":            m.server.URL,
+		"sub":            "user-1",
+		"aud":            "forum",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "rex@example.com",
+		"email_verified": true,
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockIdP(t)
+	p := m.provider()
+
+	authURL, err := p.AuthCodeURL("state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") {
+		t.Fatalf("authorization URL %q doesn't use the discovered endpoint", authURL)
+	}
+	code := m.authorize(t, authURL, "state-1")
+
+	claims, err := p.Exchange(code, "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "rex@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		badKey   bool
+	}{
+		{name: "wrong PKCE verifier", verifier: "another-verifier", nonce: "nonce-1"},
+		{name: "nonce mismatch", verifier: "verifier-1", nonce: "another-nonce"},
+		{name: "bad signature", verifier: "verifier-1", nonce: "nonce-1", badKey: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIdP(t)
+			if tt.badKey {
+				other, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatal(err)
+				}
+				m.signer = other
+			}
+			p := m.provider()
+
+			authURL, err := p.AuthCodeURL("state-1", "nonce-1", "verifier-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := m.authorize(t, authURL, "state-1")
+			if claims, err := p.Exchange(code, tt.verifier, tt.nonce); err == nil {
+				t.Fatalf("Exchange accepted the sign-in: %+v", claims)
+			}
+		})
+	}
+}
@@ -5,4 +5,10 @@ document.querySelector('form').addEventListener('submit', function(e) {
         alert('Please select at least one category');
         return false;
     }
+    const max = Number(document.querySelector('.category-checkboxes').dataset.max);
+    if (checkboxes.length > max) {
+        e.preventDefault();
+        alert('Please select at most ' + max + ' categories');
+        return false;
+    }
 }); 
\ No newline at end of file
@@ -1,19 +1,3 @@
-// Save scroll position before submitting like/dislike forms
-const likeForms = document.querySelectorAll('form[action="/like"]');
-likeForms.forEach(form => {
-    form.addEventListener('submit', function() {
-        sessionStorage.setItem('scrollPos', window.scrollY);
-    });
-});
-// Restore scroll position after reload
-window.addEventListener('load', function() {
-    const scrollPos = sessionStorage.getItem('scrollPos');
-    if (scrollPos) {
-        window.scrollTo(0, parseInt(scrollPos));
-        sessionStorage.removeItem('scrollPos');
-    }
-});
-
 // Function to navigate to post page
 function goToPost(postId) {
     window.location.href = '/post?id=' + postId;
@@ -24,4 +8,27 @@ document.addEventListener('click', function(e) {
     if (e.target.tagName === 'BUTTON' || e.target.tagName === 'FORM' || e.target.closest('form') || e.target.closest('button')) {
         e.stopPropagation();
     }
-}); 
\ No newline at end of file
+}); 
+// Live updates: reaction counts, deleted posts and a notice about new posts
+if (window.EventSource) {
+    const stream = new EventSource('/events');
+
+    stream.addEventListener('votes', function(e) {
+        applyReactions(JSON.parse(e.data), false);
+    });
+
+    stream.addEventListener('post_deleted', function(e) {
+        const d = JSON.parse(e.data);
+        const card = document.querySelector('.post-card[data-post-id="' + d.id + '"]');
+        if (card) {
+            card.remove();
+        }
+    });
+
+    stream.addEventListener('post', function() {
+        const banner = document.getElementById('new-posts');
+        if (banner) {
+            banner.hidden = false;
+        }
+    });
+}
@@ -1,15 +1,146 @@
-// Save scroll position before submitting like/dislike forms
-const likeForms = document.querySelectorAll('form[action="/like"]');
-likeForms.forEach(form => {
-    form.addEventListener('submit', function() {
-        sessionStorage.setItem('scrollPos', window.scrollY);
-    });
-});
-// Restore scroll position after reload
-window.addEventListener('load', function() {
-    const scrollPos = sessionStorage.getItem('scrollPos');
-    if (scrollPos) {
-        window.scrollTo(0, parseInt(scrollPos));
-        sessionStorage.removeItem('scrollPos');
+// Live updates: new comments, reaction counts and deletions pushed by the server
+const commentsBox = document.getElementById('comments');
+if (commentsBox && window.EventSource) {
+    const postId = commentsBox.dataset.postId;
+    const userId = commentsBox.dataset.userId;
+    const timezone = commentsBox.dataset.timezone;
+    const stream = new EventSource('/events/post?id=' + postId);
+
+    stream.addEventListener('comment', function(e) {
+        const c = JSON.parse(e.data);
+        if (commentsBox.querySelector('.comment[data-comment-id="' + c.id + '"]')) {
+            return;
+        }
+        const placeholder = document.getElementById('no-comments');
+        if (placeholder) {
+            placeholder.remove();
+        }
+        commentsBox.appendChild(buildComment(c));
+    });
+
+    stream.addEventListener('votes', function(e) {
+        applyReactions(JSON.parse(e.data), false);
+    });
+
+    stream.addEventListener('comment_deleted', function(e) {
+        const d = JSON.parse(e.data);
+        const el = commentsBox.querySelector('.comment[data-comment-id="' + d.id + '"]');
+        if (el) {
+            el.remove();
+        }
+    });
+
+    stream.addEventListener('post_deleted', function() {
+        stream.close();
+        alert('This post has been deleted.');
+        window.location.href = '/';
+    });
+
+    // A <time> like the server renders, for a comment that was just posted
+    function buildTime(iso) {
+        const time = document.createElement('time');
+        time.dateTime = iso;
+        time.title = new Date(iso).toLocaleString('en-US', {
+            timeZone: timezone, year: 'numeric', month: 'long', day: 'numeric',
+            hour: '2-digit', minute: '2-digit', hourCycle: 'h23', timeZoneName: 'short'
+        });
+        time.textContent = 'just now';
+        return time;
+    }
+
+    // Build the same markup the template renders for a comment
+    function buildComment(c) {
+        const csrfInput = document.querySelector('input[name="csrf_token"]');
+        const loggedIn = userId !== '0' && csrfInput;
+        const div = document.createElement('div');
+        div.className = 'comment';
+        div.dataset.commentId = c.id;
+
+        const meta = document.createElement('div');
+        meta.className = 'comment-meta';
+        const strong = document.createElement('strong');
+        const author = document.createElement('a');
+        author.href = '/user/' + encodeURIComponent(c.author);
+        author.textContent = c.author;
+        strong.appendChild(author);
+        meta.appendChild(strong);
+        const reputation = document.createElement('span');
+        reputation.className = 'reputation';
+        reputation.title = 'Reputation';
+        reputation.textContent = '⭐ ' + c.reputation;
+        meta.append(' ', reputation, ' · ', buildTime(c.created_at));
+        div.appendChild(meta);
+
+        const content = document.createElement('div');
+        content.className = 'comment-content';
+        content.innerHTML = c.content_html; // escaped and linked by the server
+        div.appendChild(content);
+
+        const actions = document.createElement('div');
+        actions.className = 'post-actions';
+        const left = document.createElement('div');
+        left.className = 'post-actions-left';
+        const votes = document.createElement('div');
+        votes.className = 'like-buttons';
+        votes.dataset.commentId = c.id;
+        (c.reactions || []).forEach(function(r) {
+            const count = document.createElement('span');
+            count.textContent = r.count;
+            const base = (r.key === 'like' || r.key === 'dislike') ? r.key + '-button' : 'reaction';
+            const classes = base + (r.count ? '' : ' empty');
+            if (!loggedIn) {
+                const label = document.createElement('span');
+                label.className = classes;
+                label.dataset.reaction = r.key;
+                label.append(r.emoji + ' ', count);
+                votes.appendChild(label);
+                return;
+            }
+            const form = voteForm('/react', csrfInput.value, {comment_id: c.id, reaction: r.key});
+            const button = document.createElement('button');
+            button.type = 'submit';
+            button.className = classes;
+            button.dataset.reaction = r.key;
+            button.title = reactorsText(r);
+            button.append(r.emoji + ' ', count);
+            form.appendChild(button);
+            votes.appendChild(form);
+        });
+        left.appendChild(votes);
+        actions.appendChild(left);
+
+        const right = document.createElement('div');
+        right.className = 'post-actions-right';
+        if (loggedIn && String(c.user_id) === userId) {
+            const form = voteForm('/delete_comment', csrfInput.value, {comment_id: c.id});
+            const button = document.createElement('button');
+            button.type = 'submit';
+            button.className = 'delete-button';
+            button.textContent = 'Delete';
+            button.onclick = function() {
+                return confirm('Are you sure you want to delete this comment?');
+            };
+            form.appendChild(button);
+            right.appendChild(form);
+        }
+        actions.appendChild(right);
+        div.appendChild(actions);
+        return div;
+    }
+
+    function voteForm(action, csrf, fields) {
+        const form = document.createElement('form');
+        form.action = action;
+        form.method = 'POST';
+        form.style.display = 'inline';
+        fields.csrf_token = csrf;
+        Object.keys(fields).forEach(function(name) {
+            const input = document.createElement('input');
+            input.type = 'hidden';
+            input.name = name;
+            input.value = fields[name];
+            form.appendChild(input);
+        });
+        return form;
     }
-}); 
\ No newline at end of file
+}
@@ -53,14 +53,52 @@ function validateForm() {
         return false;
     }
 
-    if (password.length < 8) {
-        alert('Password must be at least 8 characters long.');
+    const passwordInput = document.getElementById('password');
+    const minLength = passwordInput.minLength;
+    const maxLength = passwordInput.maxLength;
+    if ([...password].length < minLength) {
+        alert('Password must be at least ' + minLength + ' characters long.');
         return false;
     }
-    if (password.length > 50) {
-        alert('Password must be no more than 50 characters long.');
+    if (new TextEncoder().encode(password).length > maxLength) {
+        alert('Password must be no more than ' + maxLength + ' bytes long.');
+        return false;
+    }
+    if (password.toLowerCase().includes(username.toLowerCase())) {
+        alert('Password must not contain your username.');
         return false;
     }
 
     return true;
-} 
\ No newline at end of file
+}
+
+// Rough password strength estimate: length plus variety of character classes
+function passwordStrength(password) {
+    let score = 0;
+    if (password.length >= 8) score++;
+    if (password.length >= 12) score++;
+    if (password.length >= 16) score++;
+    if (/[a-z]/.test(password) && /[A-Z]/.test(password)) score++;
+    if (/[0-9]/.test(password)) score++;
+    if (/[^a-zA-Z0-9]/.test(password)) score++;
+    if (/^(.)\1+$/.test(password) || /^(0123|1234|abcd|qwer)/i.test(password)) score = Math.min(score, 1);
+    return Math.min(score, 5);
+}
+
+const strengthLabels = ['Very weak', 'Weak', 'Fair', 'Good', 'Strong', 'Very strong'];
+const strengthColors = ['#d32f2f', '#d32f2f', '#f57c00', '#fbc02d', '#7cb342', '#388e3c'];
+
+// Live strength feedback under the password field
+document.getElementById('password').addEventListener('input', function() {
+    const fill = document.getElementById('password-strength-fill');
+    const label = document.getElementById('password-strength-label');
+    if (this.value === '') {
+        fill.style.width = '0';
+        label.textContent = '';
+        return;
+    }
+    const score = passwordStrength(this.value);
+    fill.style.width = ((score + 1) * 100 / 6) + '%';
+    fill.style.background = strengthColors[score];
+    label.textContent = 'Strength: ' + strengthLabels[score];
+});
@@ -0,0 +1,86 @@
+// Reactions (including like/dislike) without reloading the page; clicking an
+// active reaction again removes it. Without JavaScript, or if the request
+// can't be sent at all, the forms still submit normally.
+document.addEventListener('submit', function(e) {
+    const form = e.target;
+    const action = form.getAttribute('action');
+    if ((action !== '/react' && action !== '/like') || !window.fetch) {
+        return;
+    }
+    e.preventDefault();
+
+    fetch(action, {
+        method: 'POST',
+        headers: {'Accept': 'application/json'},
+        body: new URLSearchParams(new FormData(form)),
+        credentials: 'same-origin'
+    }).then(function(res) {
+        const type = res.headers.get('Content-Type') || '';
+        if (res.ok && type.indexOf('application/json') !== -1) {
+            return res.json().then(function(v) {
+                applyReactions(v, true);
+            });
+        }
+        if (res.status === 401) {
+            window.location.href = '/login';
+            return;
+        }
+        // The server answered, so the reaction may already be saved: submitting
+        // again would toggle it back off. Report the error instead.
+        return res.json().catch(function() {
+            return {};
+        }).then(function(body) {
+            alert(body.details || body.error || 'Your reaction could not be saved. Please reload the page and try again.');
+        });
+    }, function() {
+        // The request never reached the server: fall back to a normal
+        // submission, keeping our place on the page
+        sessionStorage.setItem('scrollPos', window.scrollY);
+        form.submit();
+    }).catch(function(err) {
+        console.error('Updating reactions failed:', err);
+    });
+});
+
+// Update the reaction bar of a post or comment from a /react response or a live
+// update. Only responses to our own requests carry the viewer's reactions.
+function applyReactions(v, withViewer) {
+    const selector = v.comment_id
+        ? '.like-buttons[data-comment-id="' + v.comment_id + '"]'
+        : '.like-buttons[data-post-id="' + v.post_id + '"]';
+    document.querySelectorAll(selector).forEach(function(box) {
+        (v.reactions || []).forEach(function(r) {
+            const button = box.querySelector('[data-reaction="' + r.key + '"]');
+            if (!button) {
+                return;
+            }
+            button.querySelector('span').textContent = r.count;
+            button.title = reactorsText(r);
+            button.classList.toggle('empty', r.count === 0);
+            if (withViewer) {
+                button.classList.toggle('active', !!r.viewer);
+            }
+        });
+    });
+}
+
+// Hover text listing who reacted
+function reactorsText(r) {
+    if (!r.count) {
+        return '';
+    }
+    let text = r.users.join(', ');
+    if (r.count > r.users.length) {
+        text += ' and ' + (r.count - r.users.length) + ' more';
+    }
+    return text;
+}
+
+// Restore scroll position after a fallback reload
+window.addEventListener('load', function() {
+    const scrollPos = sessionStorage.getItem('scrollPos');
+    if (scrollPos) {
+        window.scrollTo(0, parseInt(scrollPos));
+        sessionStorage.removeItem('scrollPos');
+    }
+});
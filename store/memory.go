@@ -0,0 +1,1426 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memory holds every table of the in-memory store behind one lock
+type memory struct {
+	mu         sync.Mutex
+	nextID     int
+	users      map[int]*User
+	sessions   map[string]memorySession
+	posts      map[int]*Post
+	comments   map[int]*Comment
+	categories map[int]*Category
+	postCats   map[int]map[int]bool // post ID -> category IDs
+	reactions  []memoryReaction
+
+	changes    []memoryChange
+	identities []memoryIdentity
+	deletions  map[int]AccountDeletion // user ID -> scheduled deletion
+
+	notifications []memoryNotification
+	prefs         map[int]map[string]bool // user ID -> notification type -> enabled
+	mentions      []memoryMention
+	subscriptions []Subscription // Email and Target are filled in when read
+}
+
+type memorySession struct {
+	id        int
+	userID    int
+	expiresAt time.Time
+}
+
+type memoryChange struct {
+	userID int
+	AccountChange
+}
+
+type memoryIdentity struct {
+	userID int
+	Identity
+}
+
+type memoryReaction struct {
+	id int
+	Reaction
+	createdAt time.Time
+}
+
+type memoryNotification struct {
+	id                int
+	userID, actorID   int
+	notifType         string
+	postID, commentID int
+	read              bool
+	createdAt         time.Time
+}
+
+type memoryMention struct {
+	Mention
+	notified bool
+}
+
+// NewMemory returns empty stores that keep everything in memory, for tests. They
+// behave like the SQLite stores, including counters and cascading deletes.
+func NewMemory() *Store {
+	m := &memory{
+		users:      map[int]*User{},
+		sessions:   map[string]memorySession{},
+		posts:      map[int]*Post{},
+		comments:   map[int]*Comment{},
+		categories: map[int]*Category{},
+		postCats:   map[int]map[int]bool{},
+		deletions:  map[int]AccountDeletion{},
+		prefs:      map[int]map[string]bool{},
+	}
+	return &Store{
+		Users:         memoryUsers{m},
+		Sessions:      memorySessions{m},
+		Posts:         memoryPosts{m},
+		Comments:      memoryComments{m},
+		Votes:         memoryVotes{m},
+		Categories:    memoryCategories{m},
+		Notifications: memoryNotifications{m},
+		Mentions:      memoryMentions{m},
+		Subscriptions: memorySubscriptions{m},
+	}
+}
+
+// id hands out the next ID; IDs are unique across tables, which the schema doesn't
+// promise but nothing relies on either way
+func (m *memory) id() int {
+	m.nextID++
+	return m.nextID
+}
+
+// Constraint failures, worded like SQLite's
+var (
+	errForeignKey = errors.New("FOREIGN KEY constraint failed")
+	errUnique     = errors.New("UNIQUE constraint failed")
+)
+
+type memoryUsers struct{ m *memory }
+
+func (s memoryUsers) Create(ctx context.Context, email, username, passwordHash string) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if u.Email == email || u.Username == username {
+			return 0, errUnique
+		}
+	}
+	id := s.m.id()
+	s.m.users[id] = &User{ID: id, Email: email, Username: username, PasswordHash: passwordHash, CreatedAt: time.Now().UTC()}
+	return id, nil
+}
+
+func (s memoryUsers) ByEmail(ctx context.Context, email string) (User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if u.Email == email {
+			return *u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s memoryUsers) ByUsername(ctx context.Context, username string) (User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if u.Username == username {
+			return *u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s memoryUsers) Exists(ctx context.Context, email, username string) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if u.Email == email || u.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s memoryUsers) SetPasswordHash(ctx context.Context, userID int, hash string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if u, ok := s.m.users[userID]; ok {
+		u.PasswordHash = hash
+	}
+	return nil
+}
+
+func (s memoryUsers) SetTimezone(ctx context.Context, userID int, timezone string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if u, ok := s.m.users[userID]; ok {
+		u.Timezone = timezone
+	}
+	return nil
+}
+
+func (s memoryUsers) Get(ctx context.Context, id int) (User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	u, ok := s.m.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return *u, nil
+}
+
+func (s memoryUsers) ByEmailFold(ctx context.Context, email string) (User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if strings.EqualFold(u.Email, email) {
+			return *u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s memoryUsers) EmailTaken(ctx context.Context, email string, exceptID int) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if u.Email == email && u.ID != exceptID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s memoryUsers) UsernameTaken(ctx context.Context, username string, exceptID int) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if u.Username == username && u.ID != exceptID {
+			return true, nil
+		}
+	}
+	for _, c := range s.m.changes {
+		if c.Field == "username" && c.OldValue == username && c.userID != exceptID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s memoryUsers) RenamedTo(ctx context.Context, oldUsername string) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	// Changes are kept in order, so the last match is the latest
+	current, found := "", false
+	for _, c := range s.m.changes {
+		if c.Field == "username" && c.OldValue == oldUsername {
+			if u, ok := s.m.users[c.userID]; ok {
+				current, found = u.Username, true
+			}
+		}
+	}
+	if !found {
+		return "", ErrNotFound
+	}
+	return current, nil
+}
+
+func (s memoryUsers) Change(ctx context.Context, userID int, field, oldValue, newValue string) error {
+	if err := checkAccountField(field); err != nil {
+		return err
+	}
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	u, ok := s.m.users[userID]
+	if !ok {
+		return errForeignKey
+	}
+	for _, other := range s.m.users {
+		if other.ID != userID && ((field == "email" && other.Email == newValue) || (field == "username" && other.Username == newValue)) {
+			return errUnique
+		}
+	}
+	if field == "email" {
+		u.Email = newValue
+	} else {
+		u.Username = newValue
+	}
+	s.m.changes = append(s.m.changes, memoryChange{
+		userID:        userID,
+		AccountChange: AccountChange{Field: field, OldValue: oldValue, NewValue: newValue, ChangedAt: time.Now().UTC()},
+	})
+	return nil
+}
+
+func (s memoryUsers) LastChange(ctx context.Context, userID int, field string) (time.Time, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for i := len(s.m.changes) - 1; i >= 0; i-- {
+		if c := s.m.changes[i]; c.userID == userID && c.Field == field {
+			return c.ChangedAt, nil
+		}
+	}
+	return time.Time{}, ErrNotFound
+}
+
+func (s memoryUsers) Changes(ctx context.Context, userID, limit int) ([]AccountChange, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var changes []AccountChange
+	for i := len(s.m.changes) - 1; i >= 0 && len(changes) < limit; i-- {
+		if c := s.m.changes[i]; c.userID == userID {
+			changes = append(changes, c.AccountChange)
+		}
+	}
+	return changes, nil
+}
+
+func (s memoryUsers) ByIdentity(ctx context.Context, provider, subject string) (User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, i := range s.m.identities {
+		if i.Provider == provider && i.Subject == subject {
+			if u, ok := s.m.users[i.userID]; ok {
+				return *u, nil
+			}
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s memoryUsers) LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	return s.m.linkIdentity(userID, provider, subject, email)
+}
+
+// linkIdentity records an external identity for a user. The caller holds the lock.
+func (m *memory) linkIdentity(userID int, provider, subject, email string) error {
+	if _, ok := m.users[userID]; !ok {
+		return errForeignKey
+	}
+	for _, i := range m.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return errUnique
+		}
+	}
+	m.identities = append(m.identities, memoryIdentity{
+		userID:   userID,
+		Identity: Identity{Provider: provider, Subject: subject, Email: email, CreatedAt: time.Now().UTC()},
+	})
+	return nil
+}
+
+func (s memoryUsers) CreateWithIdentity(ctx context.Context, email, username, provider, subject string) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, u := range s.m.users {
+		if u.Email == email || u.Username == username {
+			return 0, errUnique
+		}
+	}
+	for _, i := range s.m.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return 0, errUnique
+		}
+	}
+	id := s.m.id()
+	s.m.users[id] = &User{ID: id, Email: email, Username: username, CreatedAt: time.Now().UTC()}
+	return id, s.m.linkIdentity(id, provider, subject, email)
+}
+
+func (s memoryUsers) Identities(ctx context.Context, userID int) ([]Identity, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var identities []Identity
+	for _, i := range s.m.identities {
+		if i.userID == userID {
+			identities = append(identities, i.Identity)
+		}
+	}
+	return identities, nil
+}
+
+func (s memoryUsers) ScheduleDeletion(ctx context.Context, d AccountDeletion) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.users[d.UserID]; !ok {
+		return errForeignKey
+	}
+	// Asking again changes the mode but keeps the original date
+	if existing, ok := s.m.deletions[d.UserID]; ok {
+		d.ExecuteAfter = existing.ExecuteAfter
+	}
+	s.m.deletions[d.UserID] = d
+	return nil
+}
+
+func (s memoryUsers) Deletion(ctx context.Context, userID int) (AccountDeletion, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	d, ok := s.m.deletions[userID]
+	if !ok {
+		return AccountDeletion{UserID: userID}, ErrNotFound
+	}
+	return d, nil
+}
+
+func (s memoryUsers) CancelDeletion(ctx context.Context, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	delete(s.m.deletions, userID)
+	return nil
+}
+
+func (s memoryUsers) DueDeletions(ctx context.Context, now time.Time) ([]AccountDeletion, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var due []AccountDeletion
+	for _, d := range s.m.deletions {
+		if !d.ExecuteAfter.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].ExecuteAfter.Equal(due[j].ExecuteAfter) {
+			return due[i].ExecuteAfter.Before(due[j].ExecuteAfter)
+		}
+		return due[i].UserID < due[j].UserID
+	})
+	return due, nil
+}
+
+func (s memoryUsers) Delete(ctx context.Context, userID int, placeholder *User) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.users[userID]; !ok {
+		return nil
+	}
+
+	if placeholder != nil {
+		var keeper *User
+		for _, u := range s.m.users {
+			if u.Username == placeholder.Username {
+				keeper = u
+			}
+		}
+		if keeper == nil {
+			id := s.m.id()
+			keeper = &User{ID: id, Email: placeholder.Email, Username: placeholder.Username, CreatedAt: time.Now().UTC()}
+			s.m.users[id] = keeper
+		}
+		for _, p := range s.m.posts {
+			if p.UserID == userID {
+				p.UserID, p.Author = keeper.ID, keeper.Username
+			}
+		}
+		for _, c := range s.m.comments {
+			if c.UserID == userID {
+				c.UserID, c.Author = keeper.ID, keeper.Username
+			}
+		}
+	}
+
+	// Cascade as the schema's foreign keys do
+	for token, sess := range s.m.sessions {
+		if sess.userID == userID {
+			delete(s.m.sessions, token)
+		}
+	}
+	s.m.removeReactions(func(r memoryReaction) bool { return r.UserID == userID })
+	for id, c := range s.m.comments {
+		if c.UserID == userID {
+			s.m.deleteComment(id)
+		}
+	}
+	for id, p := range s.m.posts {
+		if p.UserID == userID {
+			s.m.deletePost(id)
+		}
+	}
+	notifications := s.m.notifications[:0]
+	for _, n := range s.m.notifications {
+		if n.userID != userID && n.actorID != userID {
+			notifications = append(notifications, n)
+		}
+	}
+	s.m.notifications = notifications
+	mentions := s.m.mentions[:0]
+	for _, mention := range s.m.mentions {
+		if mention.UserID != userID {
+			mentions = append(mentions, mention)
+		}
+	}
+	s.m.mentions = mentions
+	s.m.removeSubscriptions(func(sub Subscription) bool { return sub.UserID == userID })
+	changes := s.m.changes[:0]
+	for _, c := range s.m.changes {
+		if c.userID != userID {
+			changes = append(changes, c)
+		}
+	}
+	s.m.changes = changes
+	identities := s.m.identities[:0]
+	for _, i := range s.m.identities {
+		if i.userID != userID {
+			identities = append(identities, i)
+		}
+	}
+	s.m.identities = identities
+	delete(s.m.prefs, userID)
+	delete(s.m.deletions, userID)
+	delete(s.m.users, userID)
+	return nil
+}
+
+type memorySessions struct{ m *memory }
+
+func (s memorySessions) Create(ctx context.Context, userID int, token string, expiresAt time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.users[userID]; !ok {
+		return errForeignKey
+	}
+	for t, sess := range s.m.sessions {
+		if sess.userID == userID {
+			delete(s.m.sessions, t)
+		}
+	}
+	s.m.sessions[token] = memorySession{s.m.id(), userID, expiresAt}
+	return nil
+}
+
+func (s memorySessions) User(ctx context.Context, token string) (User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	sess, ok := s.m.sessions[token]
+	if !ok || !sess.expiresAt.After(time.Now()) {
+		return User{}, ErrNotFound
+	}
+	u, ok := s.m.users[sess.userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return *u, nil
+}
+
+func (s memorySessions) Delete(ctx context.Context, token string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	delete(s.m.sessions, token)
+	return nil
+}
+
+func (s memorySessions) ForUser(ctx context.Context, userID int) ([]Session, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var sessions []Session
+	for _, sess := range s.m.sessions {
+		if sess.userID == userID {
+			sessions = append(sessions, Session{ID: sess.id, ExpiresAt: sess.expiresAt})
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions, nil
+}
+
+type memoryPosts struct{ m *memory }
+
+func (s memoryPosts) Create(ctx context.Context, userID int, title, content string, categoryIDs []int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	u, ok := s.m.users[userID]
+	if !ok {
+		return 0, errForeignKey
+	}
+	// Check everything before adding anything, as the SQL stores roll back
+	for _, catID := range categoryIDs {
+		if _, ok := s.m.categories[catID]; !ok {
+			return 0, errForeignKey
+		}
+	}
+	id := s.m.id()
+	s.m.posts[id] = &Post{ID: id, UserID: userID, Author: u.Username, Title: title, Content: content, CreatedAt: time.Now().UTC()}
+	s.m.postCats[id] = map[int]bool{}
+	for _, catID := range categoryIDs {
+		s.m.postCats[id][catID] = true
+	}
+	return id, nil
+}
+
+func (s memoryPosts) Get(ctx context.Context, id int) (Post, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	p, ok := s.m.posts[id]
+	if !ok {
+		return Post{}, ErrNotFound
+	}
+	return *p, nil
+}
+
+func (s memoryPosts) List(ctx context.Context, filter PostFilter) ([]Post, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var posts []Post
+	for _, p := range s.m.posts {
+		if filter.AuthorID != 0 && p.UserID != filter.AuthorID {
+			continue
+		}
+		if filter.CategoryID != 0 && !s.m.postCats[p.ID][filter.CategoryID] {
+			continue
+		}
+		if filter.LikedBy != 0 && !s.m.hasReaction(filter.LikedBy, p.ID, 0, "like") {
+			continue
+		}
+		posts = append(posts, *p)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+	if filter.Limit > 0 {
+		posts = posts[min(filter.Offset, len(posts)):]
+		posts = posts[:min(filter.Limit, len(posts))]
+	}
+	return posts, nil
+}
+
+func (s memoryPosts) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	s.m.deletePost(id)
+	return nil
+}
+
+// deletePost removes a post with its comments, reactions, activity and subscriptions.
+// The caller holds the lock.
+func (m *memory) deletePost(id int) {
+	for cid, c := range m.comments {
+		if c.PostID == id {
+			m.deleteComment(cid)
+		}
+	}
+	m.removeReactions(func(r memoryReaction) bool { return r.CommentID == 0 && r.PostID == id })
+	m.removeActivity(func(postID, commentID int) bool { return postID == id })
+	m.removeSubscriptions(func(sub Subscription) bool { return sub.PostID == id })
+	delete(m.posts, id)
+	delete(m.postCats, id)
+}
+
+func (s memoryPosts) Categories(ctx context.Context, postIDs []int) (map[int][]Category, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	cats := make(map[int][]Category, len(postIDs))
+	for _, postID := range postIDs {
+		for catID := range s.m.postCats[postID] {
+			cats[postID] = append(cats[postID], *s.m.categories[catID])
+		}
+		sort.Slice(cats[postID], func(i, j int) bool { return cats[postID][i].Name < cats[postID][j].Name })
+	}
+	return cats, nil
+}
+
+func (s memoryPosts) SetCategories(ctx context.Context, postID int, categoryIDs []int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.posts[postID]; !ok {
+		return ErrNotFound
+	}
+	for _, catID := range categoryIDs {
+		if _, ok := s.m.categories[catID]; !ok {
+			return errForeignKey
+		}
+	}
+	s.m.postCats[postID] = map[int]bool{}
+	for _, catID := range categoryIDs {
+		s.m.postCats[postID][catID] = true
+	}
+	return nil
+}
+
+type memoryComments struct{ m *memory }
+
+func (s memoryComments) Create(ctx context.Context, postID, userID int, content string) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	u, ok := s.m.users[userID]
+	if !ok {
+		return 0, errForeignKey
+	}
+	p, ok := s.m.posts[postID]
+	if !ok {
+		return 0, errForeignKey
+	}
+	id := s.m.id()
+	s.m.comments[id] = &Comment{ID: id, PostID: postID, UserID: userID, Author: u.Username, Content: content, CreatedAt: time.Now().UTC()}
+	p.CommentCount++
+	return id, nil
+}
+
+func (s memoryComments) Get(ctx context.Context, id int) (Comment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.comments[id]
+	if !ok {
+		return Comment{}, ErrNotFound
+	}
+	return *c, nil
+}
+
+func (s memoryComments) ForPost(ctx context.Context, postID int) ([]Comment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var comments []Comment
+	for _, c := range s.m.comments {
+		if c.PostID == postID {
+			comments = append(comments, *c)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		}
+		return comments[i].ID < comments[j].ID
+	})
+	return comments, nil
+}
+
+func (s memoryComments) Commenters(ctx context.Context, postID int) ([]int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	seen := map[int]bool{}
+	var ids []int
+	for _, c := range s.m.comments {
+		if c.PostID == postID && !seen[c.UserID] {
+			seen[c.UserID] = true
+			ids = append(ids, c.UserID)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s memoryComments) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	s.m.deleteComment(id)
+	return nil
+}
+
+func (s memoryComments) ByUser(ctx context.Context, userID int) ([]Comment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var comments []Comment
+	for _, c := range s.m.comments {
+		if c.UserID == userID {
+			comments = append(comments, *c)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+	return comments, nil
+}
+
+func (s memoryComments) CountByUser(ctx context.Context, userID int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	n := 0
+	for _, c := range s.m.comments {
+		if c.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// deleteComment removes a comment and its reactions and updates the post's counter.
+// The caller holds the lock.
+func (m *memory) deleteComment(id int) {
+	c, ok := m.comments[id]
+	if !ok {
+		return
+	}
+	m.removeReactions(func(r memoryReaction) bool { return r.CommentID == id })
+	m.removeActivity(func(postID, commentID int) bool { return commentID == id })
+	if p, ok := m.posts[c.PostID]; ok {
+		p.CommentCount--
+	}
+	delete(m.comments, id)
+}
+
+type memoryVotes struct{ m *memory }
+
+func (s memoryVotes) Cast(ctx context.Context, userID, postID, commentID int, isLike bool) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	key := "dislike"
+	if isLike {
+		key = "like"
+	}
+	if err := s.m.checkTarget(userID, postID, commentID); err != nil {
+		return false, err
+	}
+	for i, r := range s.m.reactions {
+		if r.UserID != userID || !r.targets(postID, commentID) || (r.Key != "like" && r.Key != "dislike") {
+			continue
+		}
+		if r.Key == key {
+			s.m.removeReactions(func(x memoryReaction) bool { return x.id == r.id })
+			return false, nil
+		}
+		s.m.count(r.Reaction, -1)
+		s.m.reactions[i].Key = key
+		s.m.reactions[i].createdAt = time.Now().UTC()
+		s.m.count(s.m.reactions[i].Reaction, 1)
+		return true, nil
+	}
+	s.m.addReaction(userID, postID, commentID, key)
+	return true, nil
+}
+
+func (s memoryVotes) Toggle(ctx context.Context, userID, postID, commentID int, key string) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if err := s.m.checkTarget(userID, postID, commentID); err != nil {
+		return false, err
+	}
+	if s.m.hasReaction(userID, postID, commentID, key) {
+		s.m.removeReactions(func(r memoryReaction) bool {
+			return r.UserID == userID && r.Key == key && r.targets(postID, commentID)
+		})
+		return false, nil
+	}
+	s.m.addReaction(userID, postID, commentID, key)
+	return true, nil
+}
+
+func (s memoryVotes) Counts(ctx context.Context, postID, commentID int) (int, int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if commentID > 0 {
+		c, ok := s.m.comments[commentID]
+		if !ok {
+			return 0, 0, ErrNotFound
+		}
+		return c.LikeCount, c.DislikeCount, nil
+	}
+	p, ok := s.m.posts[postID]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+	return p.LikeCount, p.DislikeCount, nil
+}
+
+func (s memoryVotes) OnPosts(ctx context.Context, postIDs []int) ([]Reaction, error) {
+	return s.on(postIDs, func(r memoryReaction) int {
+		if r.CommentID != 0 {
+			return 0
+		}
+		return r.PostID
+	})
+}
+
+func (s memoryVotes) OnComments(ctx context.Context, commentIDs []int) ([]Reaction, error) {
+	return s.on(commentIDs, func(r memoryReaction) int { return r.CommentID })
+}
+
+// on returns the reactions whose key (as picked by keyOf) is one of ids, oldest first
+func (s memoryVotes) on(ids []int, keyOf func(memoryReaction) int) ([]Reaction, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	want := map[int]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+	var reactions []Reaction
+	for _, r := range s.m.reactions {
+		if id := keyOf(r); id != 0 && want[id] {
+			reactions = append(reactions, r.withTime())
+		}
+	}
+	return reactions, nil
+}
+
+func (s memoryVotes) ByUser(ctx context.Context, userID int) ([]Reaction, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var reactions []Reaction
+	for _, r := range s.m.reactions {
+		if r.UserID == userID {
+			reactions = append(reactions, r.withTime())
+		}
+	}
+	return reactions, nil
+}
+
+// withTime returns the reaction with its creation time filled in
+func (r memoryReaction) withTime() Reaction {
+	reaction := r.Reaction
+	reaction.CreatedAt = r.createdAt
+	return reaction
+}
+
+// targets reports whether the reaction is on the post or comment (commentID > 0)
+func (r memoryReaction) targets(postID, commentID int) bool {
+	if commentID > 0 {
+		return r.CommentID == commentID
+	}
+	return r.CommentID == 0 && r.PostID == postID
+}
+
+// checkTarget verifies the user and the post or comment exist. The caller holds the lock.
+func (m *memory) checkTarget(userID, postID, commentID int) error {
+	if _, ok := m.users[userID]; !ok {
+		return errForeignKey
+	}
+	if commentID > 0 {
+		if _, ok := m.comments[commentID]; !ok {
+			return errForeignKey
+		}
+	} else if _, ok := m.posts[postID]; !ok {
+		return errForeignKey
+	}
+	return nil
+}
+
+// hasReaction reports whether the user reacted with key. The caller holds the lock.
+func (m *memory) hasReaction(userID, postID, commentID int, key string) bool {
+	for _, r := range m.reactions {
+		if r.UserID == userID && r.Key == key && r.targets(postID, commentID) {
+			return true
+		}
+	}
+	return false
+}
+
+// addReaction stores a reaction and bumps the counters. The caller holds the lock.
+func (m *memory) addReaction(userID, postID, commentID int, key string) {
+	r := Reaction{UserID: userID, Username: m.users[userID].Username, Key: key}
+	if commentID > 0 {
+		r.CommentID = commentID
+	} else {
+		r.PostID = postID
+	}
+	m.reactions = append(m.reactions, memoryReaction{id: m.id(), Reaction: r, createdAt: time.Now().UTC()})
+	m.count(r, 1)
+}
+
+// removeReactions deletes the matching reactions and updates the counters. The caller holds the lock.
+func (m *memory) removeReactions(match func(memoryReaction) bool) {
+	kept := m.reactions[:0]
+	for _, r := range m.reactions {
+		if match(r) {
+			m.count(r.Reaction, -1)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	m.reactions = kept
+}
+
+// count adjusts the like or dislike counter of the reaction's target by delta, as the
+// SQLite triggers do. The caller holds the lock.
+func (m *memory) count(r Reaction, delta int) {
+	var likes, dislikes *int
+	if r.CommentID > 0 {
+		c, ok := m.comments[r.CommentID]
+		if !ok {
+			return
+		}
+		likes, dislikes = &c.LikeCount, &c.DislikeCount
+	} else {
+		p, ok := m.posts[r.PostID]
+		if !ok {
+			return
+		}
+		likes, dislikes = &p.LikeCount, &p.DislikeCount
+	}
+	switch r.Key {
+	case "like":
+		*likes += delta
+	case "dislike":
+		*dislikes += delta
+	}
+}
+
+func (s memoryVotes) Received(ctx context.Context, userIDs []int) ([]ReceivedVotes, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	want := map[int]bool{}
+	for _, id := range userIDs {
+		want[id] = true
+	}
+	type key struct {
+		userID    int
+		day       string
+		onComment bool
+	}
+	counts := map[key]*ReceivedVotes{}
+	var order []key
+	for _, r := range s.m.reactions {
+		if r.Key != "like" && r.Key != "dislike" {
+			continue
+		}
+		k := key{day: r.createdAt.UTC().Format("2006-01-02"), onComment: r.CommentID > 0}
+		if k.onComment {
+			k.userID = s.m.comments[r.CommentID].UserID
+		} else {
+			k.userID = s.m.posts[r.PostID].UserID
+		}
+		if !want[k.userID] || r.UserID == k.userID {
+			continue
+		}
+		if counts[k] == nil {
+			counts[k] = &ReceivedVotes{UserID: k.userID, Day: k.day, OnComment: k.onComment}
+			order = append(order, k)
+		}
+		if r.Key == "like" {
+			counts[k].Likes++
+		} else {
+			counts[k].Dislikes++
+		}
+	}
+	var received []ReceivedVotes
+	for _, k := range order {
+		received = append(received, *counts[k])
+	}
+	return received, nil
+}
+
+type memoryCategories struct{ m *memory }
+
+func (s memoryCategories) All(ctx context.Context) ([]Category, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var cats []Category
+	for _, c := range s.m.categories {
+		cats = append(cats, *c)
+	}
+	sort.Slice(cats, func(i, j int) bool { return cats[i].Name < cats[j].Name })
+	return cats, nil
+}
+
+func (s memoryCategories) AllExist(ctx context.Context, ids []int) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := s.m.categories[id]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s memoryCategories) NameExists(ctx context.Context, name string) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, c := range s.m.categories {
+		if strings.EqualFold(c.Name, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s memoryCategories) Create(ctx context.Context, name string) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, c := range s.m.categories {
+		if c.Name == name {
+			return 0, errUnique
+		}
+	}
+	id := s.m.id()
+	s.m.categories[id] = &Category{ID: id, Name: name}
+	return id, nil
+}
+
+// removeActivity deletes the notifications and mentions about the matching posts or
+// comments. The caller holds the lock.
+func (m *memory) removeActivity(match func(postID, commentID int) bool) {
+	notifications := m.notifications[:0]
+	for _, n := range m.notifications {
+		if !match(n.postID, n.commentID) {
+			notifications = append(notifications, n)
+		}
+	}
+	m.notifications = notifications
+	mentions := m.mentions[:0]
+	for _, mention := range m.mentions {
+		if !match(mention.PostID, mention.CommentID) {
+			mentions = append(mentions, mention)
+		}
+	}
+	m.mentions = mentions
+}
+
+type memoryNotifications struct{ m *memory }
+
+// Enabled is true unless the user turned the type off
+func (s memoryNotifications) Enabled(ctx context.Context, userID int, notifType string) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	enabled, ok := s.m.prefs[userID][notifType]
+	return enabled || !ok, nil
+}
+
+func (s memoryNotifications) Create(ctx context.Context, userID, actorID int, notifType string, postID, commentID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.users[userID]; !ok {
+		return errForeignKey
+	}
+	if _, ok := s.m.users[actorID]; !ok {
+		return errForeignKey
+	}
+	s.m.notifications = append(s.m.notifications, memoryNotification{
+		id: s.m.id(), userID: userID, actorID: actorID, notifType: notifType, postID: postID, commentID: commentID, createdAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+func (s memoryNotifications) SentSince(ctx context.Context, actorID int, notifType string, since time.Time) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	n := 0
+	for _, notif := range s.m.notifications {
+		if notif.actorID == actorID && notif.notifType == notifType && notif.createdAt.After(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s memoryNotifications) Unread(ctx context.Context, userID int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	n := 0
+	for _, notif := range s.m.notifications {
+		if notif.userID == userID && !notif.read {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s memoryNotifications) List(ctx context.Context, userID, limit int) ([]Notification, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	// Notifications are kept in order, so walking back gives the newest first
+	var notifications []Notification
+	for i := len(s.m.notifications) - 1; i >= 0 && len(notifications) < limit; i-- {
+		n := s.m.notifications[i]
+		actor, ok := s.m.users[n.actorID]
+		post, ok2 := s.m.posts[n.postID]
+		if n.userID != userID || !ok || !ok2 {
+			continue
+		}
+		notifications = append(notifications, Notification{
+			ID: n.id, Type: n.notifType, Actor: actor.Username, PostID: n.postID, PostTitle: post.Title,
+			CommentID: n.commentID, Read: n.read, CreatedAt: n.createdAt,
+		})
+	}
+	return notifications, nil
+}
+
+func (s memoryNotifications) MarkRead(ctx context.Context, userID, id int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for i, n := range s.m.notifications {
+		if n.id == id && n.userID == userID {
+			s.m.notifications[i].read = true
+			return n.postID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (s memoryNotifications) MarkAllRead(ctx context.Context, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for i, n := range s.m.notifications {
+		if n.userID == userID {
+			s.m.notifications[i].read = true
+		}
+	}
+	return nil
+}
+
+func (s memoryNotifications) Preferences(ctx context.Context, userID int) (map[string]bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	prefs := map[string]bool{}
+	for t, enabled := range s.m.prefs[userID] {
+		prefs[t] = enabled
+	}
+	return prefs, nil
+}
+
+func (s memoryNotifications) SetPreferences(ctx context.Context, userID int, enabled map[string]bool) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.users[userID]; !ok {
+		return errForeignKey
+	}
+	if s.m.prefs[userID] == nil {
+		s.m.prefs[userID] = map[string]bool{}
+	}
+	for t, on := range enabled {
+		s.m.prefs[userID][t] = on
+	}
+	return nil
+}
+
+type memoryMentions struct{ m *memory }
+
+func (s memoryMentions) Add(ctx context.Context, mention Mention) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.users[mention.UserID]; !ok {
+		return false, errForeignKey
+	}
+	if _, ok := s.m.posts[mention.PostID]; !ok {
+		return false, errForeignKey
+	}
+	for _, existing := range s.m.mentions {
+		if existing.PostID == mention.PostID && existing.CommentID == mention.CommentID && existing.UserID == mention.UserID {
+			return false, nil
+		}
+	}
+	s.m.mentions = append(s.m.mentions, memoryMention{Mention: mention})
+	return true, nil
+}
+
+func (s memoryMentions) MarkNotified(ctx context.Context, postID, commentID, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for i, mention := range s.m.mentions {
+		if mention.PostID == postID && mention.CommentID == commentID && mention.UserID == userID {
+			s.m.mentions[i].notified = true
+		}
+	}
+	return nil
+}
+
+func (s memoryMentions) ForPost(ctx context.Context, postID int) ([]Mention, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var mentions []Mention
+	for _, mention := range s.m.mentions {
+		if mention.PostID == postID {
+			mentions = append(mentions, mention.Mention)
+		}
+	}
+	return mentions, nil
+}
+
+type memorySubscriptions struct{ m *memory }
+
+func (s memorySubscriptions) Follow(ctx context.Context, userID, postID int, unsubscribeToken string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if s.m.subscription(userID, postID, 0) >= 0 {
+		return nil
+	}
+	return s.m.addSubscription(userID, postID, 0, "daily", unsubscribeToken)
+}
+
+func (s memorySubscriptions) Subscribe(ctx context.Context, userID, postID, categoryID int, frequency, unsubscribeToken string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if i := s.m.subscription(userID, postID, categoryID); i >= 0 {
+		s.m.subscriptions[i].Frequency = frequency
+		return nil
+	}
+	return s.m.addSubscription(userID, postID, categoryID, frequency, unsubscribeToken)
+}
+
+func (s memorySubscriptions) Frequency(ctx context.Context, userID, postID, categoryID int) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if i := s.m.subscription(userID, postID, categoryID); i >= 0 {
+		return s.m.subscriptions[i].Frequency, nil
+	}
+	return "", nil
+}
+
+func (s memorySubscriptions) Unsubscribe(ctx context.Context, userID, postID, categoryID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	s.m.removeSubscriptions(func(sub Subscription) bool {
+		return sub.UserID == userID && sub.PostID == postID && sub.CategoryID == categoryID
+	})
+	return nil
+}
+
+func (s memorySubscriptions) ByToken(ctx context.Context, token string) (Subscription, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, sub := range s.m.subscriptions {
+		if sub.Token == token {
+			return s.m.fillSubscription(sub), nil
+		}
+	}
+	return Subscription{}, ErrNotFound
+}
+
+func (s memorySubscriptions) DeleteByToken(ctx context.Context, token string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	s.m.removeSubscriptions(func(sub Subscription) bool { return sub.Token == token })
+	return nil
+}
+
+func (s memorySubscriptions) Due(ctx context.Context, now time.Time) ([]Subscription, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var due []Subscription
+	for _, sub := range s.m.subscriptions {
+		if sub.Frequency == "immediate" ||
+			(sub.Frequency == "daily" && !sub.LastSentAt.After(now.AddDate(0, 0, -1))) ||
+			(sub.Frequency == "weekly" && !sub.LastSentAt.After(now.AddDate(0, 0, -7))) {
+			due = append(due, s.m.fillSubscription(sub))
+		}
+	}
+	return due, nil
+}
+
+func (s memorySubscriptions) Activity(ctx context.Context, ids []int, now time.Time) (map[int][]DigestItem, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	activity := make(map[int][]DigestItem)
+	for _, sub := range s.m.subscriptions {
+		if !wanted[sub.ID] {
+			continue
+		}
+		if items := s.m.digestActivity(sub, now); len(items) > 0 {
+			activity[sub.ID] = items
+		}
+	}
+	return activity, nil
+}
+
+// digestActivity returns what is new for one subscription. The caller holds m.mu.
+func (m *memory) digestActivity(sub Subscription, now time.Time) []DigestItem {
+	fresh := func(userID int, createdAt time.Time) bool {
+		return userID != sub.UserID && createdAt.After(sub.LastSentAt) && !createdAt.After(now)
+	}
+	type dated struct {
+		DigestItem
+		id        int
+		createdAt time.Time
+	}
+	var found []dated
+	if sub.PostID > 0 {
+		for _, c := range m.comments {
+			if c.PostID == sub.PostID && fresh(c.UserID, c.CreatedAt) {
+				found = append(found, dated{DigestItem{PostID: c.PostID, Author: c.Author, Content: c.Content}, c.ID, c.CreatedAt})
+			}
+		}
+	} else {
+		for _, p := range m.posts {
+			if m.postCats[p.ID][sub.CategoryID] && fresh(p.UserID, p.CreatedAt) {
+				found = append(found, dated{DigestItem{PostID: p.ID, Title: p.Title, Author: p.Author}, p.ID, p.CreatedAt})
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].createdAt.Equal(found[j].createdAt) {
+			return found[i].createdAt.Before(found[j].createdAt)
+		}
+		return found[i].id < found[j].id
+	})
+	var items []DigestItem
+	for i := 0; i < len(found) && i < 50; i++ {
+		items = append(items, found[i].DigestItem)
+	}
+	return items
+}
+
+func (s memorySubscriptions) MarkSent(ctx context.Context, id int, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for i, sub := range s.m.subscriptions {
+		if sub.ID == id {
+			s.m.subscriptions[i].LastSentAt = at
+		}
+	}
+	return nil
+}
+
+// subscription returns the index of the user's subscription to a post or category, or
+// -1 without one. The caller holds the lock.
+func (m *memory) subscription(userID, postID, categoryID int) int {
+	for i, sub := range m.subscriptions {
+		if sub.UserID == userID && sub.PostID == postID && sub.CategoryID == categoryID {
+			return i
+		}
+	}
+	return -1
+}
+
+// addSubscription stores a new subscription. The caller holds the lock.
+func (m *memory) addSubscription(userID, postID, categoryID int, frequency, token string) error {
+	if _, ok := m.users[userID]; !ok {
+		return errForeignKey
+	}
+	if _, ok := m.posts[postID]; postID > 0 && !ok {
+		return errForeignKey
+	}
+	if _, ok := m.categories[categoryID]; categoryID > 0 && !ok {
+		return errForeignKey
+	}
+	for _, sub := range m.subscriptions {
+		if sub.Token == token {
+			return errUnique
+		}
+	}
+	m.subscriptions = append(m.subscriptions, Subscription{
+		ID: m.id(), UserID: userID, PostID: postID, CategoryID: categoryID,
+		Frequency: frequency, Token: token, LastSentAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+// fillSubscription adds the subscriber's email and the target's name, as the SQL
+// stores' joins do. The caller holds the lock.
+func (m *memory) fillSubscription(sub Subscription) Subscription {
+	if u, ok := m.users[sub.UserID]; ok {
+		sub.Email = u.Email
+	}
+	if p, ok := m.posts[sub.PostID]; ok {
+		sub.Target = p.Title
+	} else if c, ok := m.categories[sub.CategoryID]; ok {
+		sub.Target = c.Name
+	}
+	return sub
+}
+
+// removeSubscriptions deletes the matching subscriptions. The caller holds the lock.
+func (m *memory) removeSubscriptions(match func(Subscription) bool) {
+	kept := m.subscriptions[:0]
+	for _, sub := range m.subscriptions {
+		if !match(sub) {
+			kept = append(kept, sub)
+		}
+	}
+	m.subscriptions = kept
+}
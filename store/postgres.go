@@ -0,0 +1,751 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"forum/database"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// NewPostgres returns stores backed by a Postgres database using the forum schema
+func NewPostgres(db *sql.DB) *Store {
+	return &Store{
+		Users:         postgresUsers{db},
+		Sessions:      postgresSessions{db},
+		Posts:         postgresPosts{db},
+		Comments:      postgresComments{db},
+		Votes:         postgresVotes{db},
+		Categories:    postgresCategories{db},
+		Notifications: postgresNotifications{db},
+		Mentions:      postgresMentions{db},
+		Subscriptions: postgresSubscriptions{db},
+	}
+}
+
+// pgReactionTarget returns the WHERE clause selecting reactions on a post or comment
+// (commentID > 0), with its argument as placeholder $n
+func pgReactionTarget(n int, postID, commentID int) (string, int) {
+	p := "$" + strconv.Itoa(n)
+	if commentID > 0 {
+		return "reactions.comment_id = " + p, commentID
+	}
+	return "reactions.post_id = " + p + " AND reactions.comment_id IS NULL", postID
+}
+
+type postgresUsers struct{ db *sql.DB }
+
+func (s postgresUsers) Create(ctx context.Context, email, username, passwordHash string) (int, error) {
+	var id int
+	err := database.QueryRow(ctx, s.db, "INSERT INTO users (email, username, password_hash) VALUES ($1, $2, $3) RETURNING id", email, username, passwordHash).Scan(&id)
+	return id, err
+}
+
+func (s postgresUsers) ByEmail(ctx context.Context, email string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE email = $1", email))
+}
+
+func (s postgresUsers) ByUsername(ctx context.Context, username string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE username = $1", username))
+}
+
+func (s postgresUsers) Exists(ctx context.Context, email, username string) (bool, error) {
+	var exists bool
+	err := database.QueryRow(ctx, s.db, "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 OR username = $2)", email, username).Scan(&exists)
+	return exists, err
+}
+
+func (s postgresUsers) SetPasswordHash(ctx context.Context, userID int, hash string) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE users SET password_hash = $1 WHERE id = $2", hash, userID)
+	return err
+}
+
+func (s postgresUsers) SetTimezone(ctx context.Context, userID int, timezone string) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE users SET timezone = $1 WHERE id = $2", timezone, userID)
+	return err
+}
+
+func (s postgresUsers) Get(ctx context.Context, id int) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+func (s postgresUsers) ByEmailFold(ctx context.Context, email string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE LOWER(email) = LOWER($1)", email))
+}
+
+func (s postgresUsers) EmailTaken(ctx context.Context, email string, exceptID int) (bool, error) {
+	var taken bool
+	err := database.QueryRow(ctx, s.db, "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id != $2)", email, exceptID).Scan(&taken)
+	return taken, err
+}
+
+func (s postgresUsers) UsernameTaken(ctx context.Context, username string, exceptID int) (bool, error) {
+	var taken bool
+	err := database.QueryRow(ctx, s.db, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE username = $1 AND id != $2)
+		    OR EXISTS (SELECT 1 FROM account_changes WHERE field = 'username' AND old_value = $1 AND user_id != $2)
+	`, username, exceptID).Scan(&taken)
+	return taken, err
+}
+
+func (s postgresUsers) RenamedTo(ctx context.Context, oldUsername string) (string, error) {
+	var current string
+	err := database.QueryRow(ctx, s.db, `
+		SELECT users.username
+		FROM account_changes
+		JOIN users ON account_changes.user_id = users.id
+		WHERE account_changes.field = 'username' AND account_changes.old_value = $1
+		ORDER BY account_changes.changed_at DESC, account_changes.id DESC
+		LIMIT 1
+	`, oldUsername).Scan(&current)
+	return current, notFound(err)
+}
+
+func (s postgresUsers) Change(ctx context.Context, userID int, field, oldValue, newValue string) error {
+	if err := checkAccountField(field); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := database.Exec(ctx, tx, "UPDATE users SET "+field+" = $1 WHERE id = $2", newValue, userID); err != nil {
+		return err
+	}
+	_, err = database.Exec(ctx, tx, "INSERT INTO account_changes (user_id, field, old_value, new_value) VALUES ($1, $2, $3, $4)", userID, field, oldValue, newValue)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s postgresUsers) LastChange(ctx context.Context, userID int, field string) (time.Time, error) {
+	var last time.Time
+	err := database.QueryRow(ctx, s.db, "SELECT changed_at FROM account_changes WHERE user_id = $1 AND field = $2 ORDER BY changed_at DESC LIMIT 1", userID, field).
+		Scan(database.ScanTime(&last))
+	return last, notFound(err)
+}
+
+func (s postgresUsers) Changes(ctx context.Context, userID, limit int) ([]AccountChange, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT field, old_value, new_value, changed_at FROM account_changes WHERE user_id = $1 ORDER BY changed_at DESC, id DESC LIMIT $2", userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []AccountChange
+	for rows.Next() {
+		var c AccountChange
+		if err := rows.Scan(&c.Field, &c.OldValue, &c.NewValue, database.ScanTime(&c.ChangedAt)); err != nil {
+			return changes, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func (s postgresUsers) ByIdentity(ctx context.Context, provider, subject string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM user_identities JOIN users ON user_identities.user_id = users.id WHERE user_identities.provider = $1 AND user_identities.subject = $2", provider, subject))
+}
+
+func (s postgresUsers) LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error {
+	_, err := database.Exec(ctx, s.db, "INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)", userID, provider, subject, email)
+	return err
+}
+
+func (s postgresUsers) CreateWithIdentity(ctx context.Context, email, username, provider, subject string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var id int
+	if err := database.QueryRow(ctx, tx, "INSERT INTO users (email, username, password_hash) VALUES ($1, $2, '') RETURNING id", email, username).Scan(&id); err != nil {
+		return 0, err
+	}
+	_, err = database.Exec(ctx, tx, "INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)", id, provider, subject, email)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (s postgresUsers) Identities(ctx context.Context, userID int) ([]Identity, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT provider, subject, COALESCE(email, ''), created_at FROM user_identities WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var identities []Identity
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Email, database.ScanTime(&i.CreatedAt)); err != nil {
+			return identities, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (s postgresUsers) ScheduleDeletion(ctx context.Context, d AccountDeletion) error {
+	_, err := database.Exec(ctx, s.db, `
+		INSERT INTO account_deletions (user_id, mode, execute_after) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET mode = excluded.mode
+	`, d.UserID, d.Mode, database.Timestamp(d.ExecuteAfter))
+	return err
+}
+
+func (s postgresUsers) Deletion(ctx context.Context, userID int) (AccountDeletion, error) {
+	d := AccountDeletion{UserID: userID}
+	err := database.QueryRow(ctx, s.db, "SELECT mode, execute_after FROM account_deletions WHERE user_id = $1", userID).Scan(&d.Mode, database.ScanTime(&d.ExecuteAfter))
+	return d, notFound(err)
+}
+
+func (s postgresUsers) CancelDeletion(ctx context.Context, userID int) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM account_deletions WHERE user_id = $1", userID)
+	return err
+}
+
+func (s postgresUsers) DueDeletions(ctx context.Context, now time.Time) ([]AccountDeletion, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT user_id, mode, execute_after FROM account_deletions WHERE execute_after <= $1 ORDER BY execute_after", database.Timestamp(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []AccountDeletion
+	for rows.Next() {
+		var d AccountDeletion
+		if err := rows.Scan(&d.UserID, &d.Mode, database.ScanTime(&d.ExecuteAfter)); err != nil {
+			return due, err
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+func (s postgresUsers) Delete(ctx context.Context, userID int, placeholder *User) error {
+	return deleteUser(ctx, s.db, userID, placeholder)
+}
+
+type postgresSessions struct{ db *sql.DB }
+
+func (s postgresSessions) Create(ctx context.Context, userID int, token string, expiresAt time.Time) error {
+	// One session per user
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := database.Exec(ctx, tx, "DELETE FROM sessions WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := database.Exec(ctx, tx, "INSERT INTO sessions (user_id, session_token, expires_at) VALUES ($1, $2, $3)", userID, token, database.Timestamp(expiresAt)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s postgresSessions) User(ctx context.Context, token string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, `
+		SELECT `+userColumns+`
+		FROM sessions
+		JOIN users ON sessions.user_id = users.id
+		WHERE sessions.session_token = $1 AND sessions.expires_at > now()
+	`, token))
+}
+
+func (s postgresSessions) Delete(ctx context.Context, token string) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM sessions WHERE session_token = $1", token)
+	return err
+}
+
+func (s postgresSessions) ForUser(ctx context.Context, userID int) ([]Session, error) {
+	return userSessions(ctx, s.db, userID)
+}
+
+type postgresPosts struct{ db *sql.DB }
+
+func (s postgresPosts) Create(ctx context.Context, userID int, title, content string, categoryIDs []int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var id int
+	err = database.QueryRow(ctx, tx, "INSERT INTO posts (user_id, title, content) VALUES ($1, $2, $3) RETURNING id", userID, title, content).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	for _, catID := range categoryIDs {
+		if _, err := database.Exec(ctx, tx, "INSERT INTO post_categories (post_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, catID); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+func (s postgresPosts) Get(ctx context.Context, id int) (Post, error) {
+	p, err := scanPost(database.QueryRow(ctx, s.db, "SELECT "+postColumns+" FROM posts JOIN users ON posts.user_id = users.id WHERE posts.id = $1", id))
+	return p, notFound(err)
+}
+
+func (s postgresPosts) List(ctx context.Context, filter PostFilter) ([]Post, error) {
+	query := "SELECT " + postColumns + " FROM posts JOIN users ON posts.user_id = users.id"
+	var where []string
+	var args []interface{}
+	// arg adds a query argument and returns its placeholder
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if filter.LikedBy != 0 {
+		query += " JOIN reactions ON posts.id = reactions.post_id"
+		where = append(where, "reactions.user_id = "+arg(filter.LikedBy)+" AND reactions.reaction = 'like'")
+	}
+	if filter.CategoryID != 0 {
+		query += " JOIN post_categories ON posts.id = post_categories.post_id"
+		where = append(where, "post_categories.category_id = "+arg(filter.CategoryID))
+	}
+	if filter.AuthorID != 0 {
+		where = append(where, "posts.user_id = "+arg(filter.AuthorID))
+	}
+	for i, w := range where {
+		if i == 0 {
+			query += " WHERE " + w
+		} else {
+			query += " AND " + w
+		}
+	}
+	query += " ORDER BY posts.created_at DESC, posts.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit) + " OFFSET " + arg(filter.Offset)
+	}
+
+	rows, err := database.Query(ctx, s.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			continue
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func (s postgresPosts) Delete(ctx context.Context, id int) error {
+	// Comments, reactions and category links go with it through ON DELETE CASCADE
+	_, err := database.Exec(ctx, s.db, "DELETE FROM posts WHERE id = $1", id)
+	return err
+}
+
+func (s postgresPosts) Categories(ctx context.Context, postIDs []int) (map[int][]Category, error) {
+	cats := make(map[int][]Category, len(postIDs))
+	rows, err := database.Query(ctx, s.db, `
+		SELECT post_categories.post_id, categories.id, categories.name
+		FROM post_categories
+		JOIN categories ON categories.id = post_categories.category_id
+		WHERE post_categories.post_id = ANY($1)
+		ORDER BY categories.name ASC
+	`, pq.Array(postIDs))
+	if err != nil {
+		return cats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID int
+		var c Category
+		if err := rows.Scan(&postID, &c.ID, &c.Name); err != nil {
+			continue
+		}
+		cats[postID] = append(cats[postID], c)
+	}
+	return cats, rows.Err()
+}
+
+func (s postgresPosts) SetCategories(ctx context.Context, postID int, categoryIDs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := database.Exec(ctx, tx, "DELETE FROM post_categories WHERE post_id = $1", postID); err != nil {
+		return err
+	}
+	for _, id := range categoryIDs {
+		if _, err := database.Exec(ctx, tx, "INSERT INTO post_categories (post_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", postID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type postgresComments struct{ db *sql.DB }
+
+func (s postgresComments) Create(ctx context.Context, postID, userID int, content string) (int, error) {
+	var id int
+	err := database.QueryRow(ctx, s.db, "INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) RETURNING id", postID, userID, content).Scan(&id)
+	return id, err
+}
+
+func (s postgresComments) Get(ctx context.Context, id int) (Comment, error) {
+	c, err := scanComment(database.QueryRow(ctx, s.db, "SELECT "+commentColumns+" FROM comments JOIN users ON comments.user_id = users.id WHERE comments.id = $1", id))
+	return c, notFound(err)
+}
+
+func (s postgresComments) ForPost(ctx context.Context, postID int) ([]Comment, error) {
+	rows, err := database.Query(ctx, s.db, `
+		SELECT `+commentColumns+`
+		FROM comments
+		JOIN users ON comments.user_id = users.id
+		WHERE comments.post_id = $1
+		ORDER BY comments.created_at ASC, comments.id ASC
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comments []Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s postgresComments) Commenters(ctx context.Context, postID int) ([]int, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT DISTINCT user_id FROM comments WHERE post_id = $1", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+func (s postgresComments) Delete(ctx context.Context, id int) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM comments WHERE id = $1", id)
+	return err
+}
+
+func (s postgresComments) ByUser(ctx context.Context, userID int) ([]Comment, error) {
+	return userComments(ctx, s.db, userID)
+}
+
+func (s postgresComments) CountByUser(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM comments WHERE user_id = $1", userID).Scan(&n)
+	return n, err
+}
+
+type postgresVotes struct{ db *sql.DB }
+
+func (s postgresVotes) Cast(ctx context.Context, userID, postID, commentID int, isLike bool) (bool, error) {
+	key := "dislike"
+	if isLike {
+		key = "like"
+	}
+	// Repeating the current vote retracts it
+	target, targetID := pgReactionTarget(3, postID, commentID)
+	res, err := database.Exec(ctx, s.db, "DELETE FROM reactions WHERE user_id = $1 AND reaction = $2 AND "+target, userID, key, targetID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+	// Otherwise add the vote or switch the opposite one in a single upsert
+	postArg, commentArg := nullableTarget(postID, commentID)
+	_, err = database.Exec(ctx, s.db, "INSERT INTO reactions (user_id, post_id, comment_id, reaction) VALUES ($1, $2, $3, $4) "+voteConflict(commentID)+
+		" DO UPDATE SET reaction = excluded.reaction, created_at = CURRENT_TIMESTAMP", userID, postArg, commentArg, key)
+	return err == nil, err
+}
+
+func (s postgresVotes) Toggle(ctx context.Context, userID, postID, commentID int, key string) (bool, error) {
+	target, targetID := pgReactionTarget(3, postID, commentID)
+	res, err := database.Exec(ctx, s.db, "DELETE FROM reactions WHERE user_id = $1 AND reaction = $2 AND "+target, userID, key, targetID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+	postArg, commentArg := nullableTarget(postID, commentID)
+	_, err = database.Exec(ctx, s.db, "INSERT INTO reactions (user_id, post_id, comment_id, reaction) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING", userID, postArg, commentArg, key)
+	return err == nil, err
+}
+
+func (s postgresVotes) Counts(ctx context.Context, postID, commentID int) (int, int, error) {
+	var likes, dislikes int
+	var err error
+	if commentID > 0 {
+		err = database.QueryRow(ctx, s.db, "SELECT like_count, dislike_count FROM comments WHERE id = $1", commentID).Scan(&likes, &dislikes)
+	} else {
+		err = database.QueryRow(ctx, s.db, "SELECT like_count, dislike_count FROM posts WHERE id = $1", postID).Scan(&likes, &dislikes)
+	}
+	return likes, dislikes, notFound(err)
+}
+
+func (s postgresVotes) OnPosts(ctx context.Context, postIDs []int) ([]Reaction, error) {
+	return s.on(ctx, "post_id", postIDs)
+}
+
+func (s postgresVotes) OnComments(ctx context.Context, commentIDs []int) ([]Reaction, error) {
+	return s.on(ctx, "comment_id", commentIDs)
+}
+
+// on loads reactions keyed by column ("post_id" or "comment_id"). A reaction targets
+// either a post or a comment, so post_id only matches reactions on the post itself.
+func (s postgresVotes) on(ctx context.Context, column string, ids []int) ([]Reaction, error) {
+	rows, err := database.Query(ctx, s.db, `
+		SELECT `+reactionColumns+`
+		FROM reactions
+		JOIN users ON reactions.user_id = users.id
+		WHERE reactions.`+column+` = ANY($1)
+		ORDER BY reactions.id ASC
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reactions []Reaction
+	for rows.Next() {
+		r, err := scanReaction(rows)
+		if err != nil {
+			continue
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+func (s postgresVotes) ByUser(ctx context.Context, userID int) ([]Reaction, error) {
+	return userReactions(ctx, s.db, userID)
+}
+
+func (s postgresVotes) Received(ctx context.Context, userIDs []int) ([]ReceivedVotes, error) {
+	rows, err := database.Query(ctx, s.db, `
+		SELECT posts.user_id, to_char(reactions.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, FALSE,
+		       COUNT(*) FILTER (WHERE reactions.reaction = 'like'), COUNT(*) FILTER (WHERE reactions.reaction = 'dislike')
+		FROM reactions
+		JOIN posts ON reactions.post_id = posts.id
+		WHERE posts.user_id = ANY($1)
+		  AND reactions.user_id != posts.user_id
+		  AND reactions.reaction IN ('like', 'dislike')
+		GROUP BY posts.user_id, day
+		UNION ALL
+		SELECT comments.user_id, to_char(reactions.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, TRUE,
+		       COUNT(*) FILTER (WHERE reactions.reaction = 'like'), COUNT(*) FILTER (WHERE reactions.reaction = 'dislike')
+		FROM reactions
+		JOIN comments ON reactions.comment_id = comments.id
+		WHERE comments.user_id = ANY($1)
+		  AND reactions.user_id != comments.user_id
+		  AND reactions.reaction IN ('like', 'dislike')
+		GROUP BY comments.user_id, day
+	`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var received []ReceivedVotes
+	for rows.Next() {
+		var v ReceivedVotes
+		var day sql.NullString
+		if err := rows.Scan(&v.UserID, &day, &v.OnComment, &v.Likes, &v.Dislikes); err != nil {
+			return received, err
+		}
+		v.Day = day.String
+		received = append(received, v)
+	}
+	return received, rows.Err()
+}
+
+type postgresCategories struct{ db *sql.DB }
+
+func (s postgresCategories) All(ctx context.Context) ([]Category, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT id, name FROM categories ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cats []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			continue
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+func (s postgresCategories) AllExist(ctx context.Context, ids []int) (bool, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM categories WHERE id = ANY($1)", pq.Array(ids)).Scan(&n)
+	return n == len(ids), err
+}
+
+func (s postgresCategories) NameExists(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := database.QueryRow(ctx, s.db, "SELECT EXISTS (SELECT 1 FROM categories WHERE lower(name) = lower($1))", name).Scan(&exists)
+	return exists, err
+}
+
+func (s postgresCategories) Create(ctx context.Context, name string) (int, error) {
+	var id int
+	err := database.QueryRow(ctx, s.db, "INSERT INTO categories (name) VALUES ($1) RETURNING id", name).Scan(&id)
+	return id, err
+}
+
+type postgresNotifications struct{ db *sql.DB }
+
+func (s postgresNotifications) Enabled(ctx context.Context, userID int, notifType string) (bool, error) {
+	var enabled bool
+	err := database.QueryRow(ctx, s.db, "SELECT enabled FROM notification_preferences WHERE user_id = $1 AND type = $2", userID, notifType).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return enabled, err
+}
+
+func (s postgresNotifications) Create(ctx context.Context, userID, actorID int, notifType string, postID, commentID int) error {
+	var commentArg interface{}
+	if commentID > 0 {
+		commentArg = commentID
+	}
+	_, err := database.Exec(ctx, s.db, "INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id) VALUES ($1, $2, $3, $4, $5)",
+		userID, actorID, notifType, postID, commentArg)
+	return err
+}
+
+func (s postgresNotifications) SentSince(ctx context.Context, actorID int, notifType string, since time.Time) (int, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM notifications WHERE actor_id = $1 AND type = $2 AND created_at > $3", actorID, notifType, since).Scan(&n)
+	return n, err
+}
+
+func (s postgresNotifications) Unread(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = FALSE", userID).Scan(&n)
+	return n, err
+}
+
+func (s postgresNotifications) List(ctx context.Context, userID, limit int) ([]Notification, error) {
+	return listNotifications(ctx, s.db, userID, limit)
+}
+
+func (s postgresNotifications) MarkRead(ctx context.Context, userID, id int) (int, error) {
+	var postID int
+	err := database.QueryRow(ctx, s.db, "UPDATE notifications SET is_read = TRUE WHERE id = $1 AND user_id = $2 RETURNING post_id", id, userID).Scan(&postID)
+	return postID, notFound(err)
+}
+
+func (s postgresNotifications) MarkAllRead(ctx context.Context, userID int) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE notifications SET is_read = TRUE WHERE user_id = $1 AND is_read = FALSE", userID)
+	return err
+}
+
+func (s postgresNotifications) Preferences(ctx context.Context, userID int) (map[string]bool, error) {
+	return notificationPreferences(ctx, s.db, userID)
+}
+
+func (s postgresNotifications) SetPreferences(ctx context.Context, userID int, enabled map[string]bool) error {
+	return setNotificationPreferences(ctx, s.db, userID, enabled)
+}
+
+type postgresMentions struct{ db *sql.DB }
+
+func (s postgresMentions) Add(ctx context.Context, m Mention) (bool, error) {
+	var commentArg interface{}
+	if m.CommentID > 0 {
+		commentArg = m.CommentID
+	}
+	res, err := database.Exec(ctx, s.db, "INSERT INTO mentions (post_id, comment_id, user_id, username) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		m.PostID, commentArg, m.UserID, m.Username)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s postgresMentions) MarkNotified(ctx context.Context, postID, commentID, userID int) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE mentions SET notified = TRUE WHERE post_id = $1 AND COALESCE(comment_id, 0) = $2 AND user_id = $3", postID, commentID, userID)
+	return err
+}
+
+func (s postgresMentions) ForPost(ctx context.Context, postID int) ([]Mention, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT post_id, COALESCE(comment_id, 0), user_id, username FROM mentions WHERE post_id = $1 ORDER BY id", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var mentions []Mention
+	for rows.Next() {
+		var m Mention
+		if err := rows.Scan(&m.PostID, &m.CommentID, &m.UserID, &m.Username); err != nil {
+			return mentions, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+type postgresSubscriptions struct{ db *sql.DB }
+
+func (s postgresSubscriptions) Follow(ctx context.Context, userID, postID int, unsubscribeToken string) error {
+	_, err := database.Exec(ctx, s.db, "INSERT INTO subscriptions (user_id, post_id, unsubscribe_token) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		userID, postID, unsubscribeToken)
+	return err
+}
+
+func (s postgresSubscriptions) Subscribe(ctx context.Context, userID, postID, categoryID int, frequency, unsubscribeToken string) error {
+	return subscribe(ctx, s.db, userID, postID, categoryID, frequency, unsubscribeToken)
+}
+
+func (s postgresSubscriptions) Frequency(ctx context.Context, userID, postID, categoryID int) (string, error) {
+	return subscriptionFrequency(ctx, s.db, userID, postID, categoryID)
+}
+
+func (s postgresSubscriptions) Unsubscribe(ctx context.Context, userID, postID, categoryID int) error {
+	return unsubscribe(ctx, s.db, userID, postID, categoryID)
+}
+
+func (s postgresSubscriptions) ByToken(ctx context.Context, token string) (Subscription, error) {
+	return scanSubscription(database.QueryRow(ctx, s.db, "SELECT "+subscriptionColumns+" FROM "+subscriptionTables+" WHERE subscriptions.unsubscribe_token = $1", token))
+}
+
+func (s postgresSubscriptions) DeleteByToken(ctx context.Context, token string) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM subscriptions WHERE unsubscribe_token = $1", token)
+	return err
+}
+
+func (s postgresSubscriptions) Due(ctx context.Context, now time.Time) ([]Subscription, error) {
+	return dueSubscriptions(ctx, s.db, now)
+}
+
+func (s postgresSubscriptions) Activity(ctx context.Context, ids []int, now time.Time) (map[int][]DigestItem, error) {
+	activity := make(map[int][]DigestItem)
+	err := digestActivity(ctx, s.db, "= ANY(?)", []interface{}{pq.Array(ids)}, now, activity)
+	return activity, err
+}
+
+func (s postgresSubscriptions) MarkSent(ctx context.Context, id int, at time.Time) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE subscriptions SET last_sent_at = $1 WHERE id = $2", database.Timestamp(at), id)
+	return err
+}
@@ -0,0 +1,1152 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"forum/database"
+	"time"
+)
+
+// NewSQLite returns stores backed by a SQLite database using the forum schema
+func NewSQLite(db *sql.DB) *Store {
+	return &Store{
+		Users:         sqliteUsers{db},
+		Sessions:      sqliteSessions{db},
+		Posts:         sqlitePosts{db},
+		Comments:      sqliteComments{db},
+		Votes:         sqliteVotes{db},
+		Categories:    sqliteCategories{db},
+		Notifications: sqliteNotifications{db},
+		Mentions:      sqliteMentions{db},
+		Subscriptions: sqliteSubscriptions{db},
+	}
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// nullableTarget returns the post_id and comment_id column values for a post or comment (commentID > 0)
+func nullableTarget(postID, commentID int) (postArg interface{}, commentArg interface{}) {
+	if commentID > 0 {
+		return nil, commentID
+	}
+	return postID, nil
+}
+
+// reactionTarget returns the WHERE clause and argument selecting reactions on a post or comment (commentID > 0)
+func reactionTarget(postID, commentID int) (string, int) {
+	if commentID > 0 {
+		return "reactions.comment_id = ?", commentID
+	}
+	return "reactions.post_id = ? AND reactions.comment_id IS NULL", postID
+}
+
+// voteConflict is the ON CONFLICT target matching the index that allows one like or
+// dislike per user on a post or comment (commentID > 0)
+func voteConflict(commentID int) string {
+	if commentID > 0 {
+		return "ON CONFLICT (user_id, comment_id) WHERE comment_id IS NOT NULL AND reaction IN ('like', 'dislike')"
+	}
+	return "ON CONFLICT (user_id, post_id) WHERE comment_id IS NULL AND reaction IN ('like', 'dislike')"
+}
+
+// userColumns are the columns scanned by scanUser
+const userColumns = "users.id, users.email, users.username, users.password_hash, users.created_at, users.timezone"
+
+func scanUser(row interface{ Scan(...interface{}) error }) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Email, &u.Username, &u.PasswordHash, database.ScanTime(&u.CreatedAt), &u.Timezone)
+	return u, notFound(err)
+}
+
+// checkAccountField guards the column name Change writes, which can't be a placeholder
+func checkAccountField(field string) error {
+	if field != "username" && field != "email" {
+		return fmt.Errorf("unknown account field %q", field)
+	}
+	return nil
+}
+
+type sqliteUsers struct{ db *sql.DB }
+
+func (s sqliteUsers) Create(ctx context.Context, email, username, passwordHash string) (int, error) {
+	res, err := database.Exec(ctx, s.db, "INSERT INTO users (email, username, password_hash) VALUES (?, ?, ?)", email, username, passwordHash)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s sqliteUsers) ByEmail(ctx context.Context, email string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
+
+func (s sqliteUsers) ByUsername(ctx context.Context, username string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE username = ?", username))
+}
+
+func (s sqliteUsers) Exists(ctx context.Context, email, username string) (bool, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM users WHERE email = ? OR username = ?", email, username).Scan(&n)
+	return n > 0, err
+}
+
+func (s sqliteUsers) SetPasswordHash(ctx context.Context, userID int, hash string) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE users SET password_hash = ? WHERE id = ?", hash, userID)
+	return err
+}
+
+func (s sqliteUsers) SetTimezone(ctx context.Context, userID int, timezone string) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE users SET timezone = ? WHERE id = ?", timezone, userID)
+	return err
+}
+
+func (s sqliteUsers) Get(ctx context.Context, id int) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (s sqliteUsers) ByEmailFold(ctx context.Context, email string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM users WHERE LOWER(email) = LOWER(?)", email))
+}
+
+func (s sqliteUsers) EmailTaken(ctx context.Context, email string, exceptID int) (bool, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM users WHERE email = ? AND id != ?", email, exceptID).Scan(&n)
+	return n > 0, err
+}
+
+func (s sqliteUsers) UsernameTaken(ctx context.Context, username string, exceptID int) (bool, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, `
+		SELECT (SELECT COUNT(*) FROM users WHERE username = ? AND id != ?)
+		     + (SELECT COUNT(*) FROM account_changes WHERE field = 'username' AND old_value = ? AND user_id != ?)
+	`, username, exceptID, username, exceptID).Scan(&n)
+	return n > 0, err
+}
+
+func (s sqliteUsers) RenamedTo(ctx context.Context, oldUsername string) (string, error) {
+	var current string
+	err := database.QueryRow(ctx, s.db, `
+		SELECT users.username
+		FROM account_changes
+		JOIN users ON account_changes.user_id = users.id
+		WHERE account_changes.field = 'username' AND account_changes.old_value = ?
+		ORDER BY account_changes.changed_at DESC, account_changes.id DESC
+		LIMIT 1
+	`, oldUsername).Scan(&current)
+	return current, notFound(err)
+}
+
+func (s sqliteUsers) Change(ctx context.Context, userID int, field, oldValue, newValue string) error {
+	if err := checkAccountField(field); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := database.Exec(ctx, tx, "UPDATE users SET "+field+" = ? WHERE id = ?", newValue, userID); err != nil {
+		return err
+	}
+	_, err = database.Exec(ctx, tx, "INSERT INTO account_changes (user_id, field, old_value, new_value) VALUES (?, ?, ?, ?)", userID, field, oldValue, newValue)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s sqliteUsers) LastChange(ctx context.Context, userID int, field string) (time.Time, error) {
+	var last time.Time
+	err := database.QueryRow(ctx, s.db, "SELECT changed_at FROM account_changes WHERE user_id = ? AND field = ? ORDER BY changed_at DESC LIMIT 1", userID, field).
+		Scan(database.ScanTime(&last))
+	return last, notFound(err)
+}
+
+func (s sqliteUsers) Changes(ctx context.Context, userID, limit int) ([]AccountChange, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT field, old_value, new_value, changed_at FROM account_changes WHERE user_id = ? ORDER BY changed_at DESC, id DESC LIMIT ?", userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []AccountChange
+	for rows.Next() {
+		var c AccountChange
+		if err := rows.Scan(&c.Field, &c.OldValue, &c.NewValue, database.ScanTime(&c.ChangedAt)); err != nil {
+			return changes, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func (s sqliteUsers) ByIdentity(ctx context.Context, provider, subject string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, "SELECT "+userColumns+" FROM user_identities JOIN users ON user_identities.user_id = users.id WHERE user_identities.provider = ? AND user_identities.subject = ?", provider, subject))
+}
+
+func (s sqliteUsers) LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error {
+	_, err := database.Exec(ctx, s.db, "INSERT INTO user_identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?)", userID, provider, subject, email)
+	return err
+}
+
+func (s sqliteUsers) CreateWithIdentity(ctx context.Context, email, username, provider, subject string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := database.Exec(ctx, tx, "INSERT INTO users (email, username, password_hash) VALUES (?, ?, '')", email, username)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = database.Exec(ctx, tx, "INSERT INTO user_identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?)", id, provider, subject, email)
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+func (s sqliteUsers) Identities(ctx context.Context, userID int) ([]Identity, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT provider, subject, IFNULL(email, ''), created_at FROM user_identities WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var identities []Identity
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Email, database.ScanTime(&i.CreatedAt)); err != nil {
+			return identities, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (s sqliteUsers) ScheduleDeletion(ctx context.Context, d AccountDeletion) error {
+	_, err := database.Exec(ctx, s.db, `
+		INSERT INTO account_deletions (user_id, mode, execute_after) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET mode = excluded.mode
+	`, d.UserID, d.Mode, database.Timestamp(d.ExecuteAfter))
+	return err
+}
+
+func (s sqliteUsers) Deletion(ctx context.Context, userID int) (AccountDeletion, error) {
+	d := AccountDeletion{UserID: userID}
+	err := database.QueryRow(ctx, s.db, "SELECT mode, execute_after FROM account_deletions WHERE user_id = ?", userID).Scan(&d.Mode, database.ScanTime(&d.ExecuteAfter))
+	return d, notFound(err)
+}
+
+func (s sqliteUsers) CancelDeletion(ctx context.Context, userID int) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM account_deletions WHERE user_id = ?", userID)
+	return err
+}
+
+func (s sqliteUsers) DueDeletions(ctx context.Context, now time.Time) ([]AccountDeletion, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT user_id, mode, execute_after FROM account_deletions WHERE execute_after <= ? ORDER BY execute_after", database.Timestamp(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []AccountDeletion
+	for rows.Next() {
+		var d AccountDeletion
+		if err := rows.Scan(&d.UserID, &d.Mode, database.ScanTime(&d.ExecuteAfter)); err != nil {
+			return due, err
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+func (s sqliteUsers) Delete(ctx context.Context, userID int, placeholder *User) error {
+	return deleteUser(ctx, s.db, userID, placeholder)
+}
+
+// deleteUser removes an account in one transaction, for the SQLite and Postgres stores
+func deleteUser(ctx context.Context, db *sql.DB, userID int, placeholder *User) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if placeholder != nil {
+		_, err = database.Exec(ctx, tx, "INSERT INTO users (email, username, password_hash) VALUES (?, ?, '') ON CONFLICT DO NOTHING", placeholder.Email, placeholder.Username)
+		if err != nil {
+			return err
+		}
+		var placeholderID int
+		if err := database.QueryRow(ctx, tx, "SELECT id FROM users WHERE username = ?", placeholder.Username).Scan(&placeholderID); err != nil {
+			return err
+		}
+		if _, err := database.Exec(ctx, tx, "UPDATE posts SET user_id = ? WHERE user_id = ?", placeholderID, userID); err != nil {
+			return err
+		}
+		if _, err := database.Exec(ctx, tx, "UPDATE comments SET user_id = ? WHERE user_id = ?", placeholderID, userID); err != nil {
+			return err
+		}
+	}
+
+	// Foreign keys cascade the user's sessions, identities, reactions and any remaining content
+	if _, err := database.Exec(ctx, tx, "DELETE FROM users WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := database.Exec(ctx, tx, "DELETE FROM account_deletions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqliteSessions struct{ db *sql.DB }
+
+func (s sqliteSessions) Create(ctx context.Context, userID int, token string, expiresAt time.Time) error {
+	// One session per user
+	if _, err := database.Exec(ctx, s.db, "DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	_, err := database.Exec(ctx, s.db, "INSERT INTO sessions (user_id, session_token, expires_at) VALUES (?, ?, ?)", userID, token, database.Timestamp(expiresAt))
+	return err
+}
+
+func (s sqliteSessions) User(ctx context.Context, token string) (User, error) {
+	return scanUser(database.QueryRow(ctx, s.db, `
+		SELECT `+userColumns+`
+		FROM sessions
+		JOIN users ON sessions.user_id = users.id
+		WHERE sessions.session_token = ? AND sessions.expires_at > CURRENT_TIMESTAMP
+	`, token))
+}
+
+func (s sqliteSessions) Delete(ctx context.Context, token string) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM sessions WHERE session_token = ?", token)
+	return err
+}
+
+func (s sqliteSessions) ForUser(ctx context.Context, userID int) ([]Session, error) {
+	return userSessions(ctx, s.db, userID)
+}
+
+// userSessions lists a user's sessions, for the SQLite and Postgres stores
+func userSessions(ctx context.Context, db *sql.DB, userID int) ([]Session, error) {
+	rows, err := database.Query(ctx, db, "SELECT id, expires_at FROM sessions WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []Session
+	for rows.Next() {
+		var sess Session
+		if err := rows.Scan(&sess.ID, database.ScanTime(&sess.ExpiresAt)); err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+type sqlitePosts struct{ db *sql.DB }
+
+// postColumns are the columns scanned by scanPost
+const postColumns = `posts.id, posts.user_id, users.username, posts.title, posts.content, posts.created_at,
+	posts.like_count, posts.dislike_count, posts.comment_count`
+
+func scanPost(row interface{ Scan(...interface{}) error }) (Post, error) {
+	var p Post
+	err := row.Scan(&p.ID, &p.UserID, &p.Author, &p.Title, &p.Content, database.ScanTime(&p.CreatedAt), &p.LikeCount, &p.DislikeCount, &p.CommentCount)
+	return p, err
+}
+
+func (s sqlitePosts) Create(ctx context.Context, userID int, title, content string, categoryIDs []int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := database.Exec(ctx, tx, "INSERT INTO posts (user_id, title, content) VALUES (?, ?, ?)", userID, title, content)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, catID := range categoryIDs {
+		if _, err := database.Exec(ctx, tx, "INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)", id, catID); err != nil {
+			return 0, err
+		}
+	}
+	return int(id), tx.Commit()
+}
+
+func (s sqlitePosts) Get(ctx context.Context, id int) (Post, error) {
+	p, err := scanPost(database.QueryRow(ctx, s.db, "SELECT "+postColumns+" FROM posts JOIN users ON posts.user_id = users.id WHERE posts.id = ?", id))
+	return p, notFound(err)
+}
+
+func (s sqlitePosts) List(ctx context.Context, filter PostFilter) ([]Post, error) {
+	query := "SELECT " + postColumns + " FROM posts JOIN users ON posts.user_id = users.id"
+	var where []string
+	var args []interface{}
+	if filter.LikedBy != 0 {
+		query += " JOIN reactions ON posts.id = reactions.post_id"
+		where = append(where, "reactions.user_id = ? AND reactions.reaction = 'like'")
+		args = append(args, filter.LikedBy)
+	}
+	if filter.CategoryID != 0 {
+		query += " JOIN post_categories ON posts.id = post_categories.post_id"
+		where = append(where, "post_categories.category_id = ?")
+		args = append(args, filter.CategoryID)
+	}
+	if filter.AuthorID != 0 {
+		where = append(where, "posts.user_id = ?")
+		args = append(args, filter.AuthorID)
+	}
+	for i, w := range where {
+		if i == 0 {
+			query += " WHERE " + w
+		} else {
+			query += " AND " + w
+		}
+	}
+	query += " ORDER BY posts.created_at DESC, posts.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := database.Query(ctx, s.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			continue
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func (s sqlitePosts) Delete(ctx context.Context, id int) error {
+	// Comments, reactions and category links go with it through ON DELETE CASCADE
+	_, err := database.Exec(ctx, s.db, "DELETE FROM posts WHERE id = ?", id)
+	return err
+}
+
+func (s sqlitePosts) Categories(ctx context.Context, postIDs []int) (map[int][]Category, error) {
+	cats := make(map[int][]Category, len(postIDs))
+	for _, batch := range database.Batches(postIDs) {
+		placeholders, args := database.InClause(batch)
+		rows, err := database.Query(ctx, s.db, `
+			SELECT post_categories.post_id, categories.id, categories.name
+			FROM post_categories
+			JOIN categories ON categories.id = post_categories.category_id
+			WHERE post_categories.post_id IN (`+placeholders+`)
+			ORDER BY categories.name ASC
+		`, args...)
+		if err != nil {
+			return cats, err
+		}
+		for rows.Next() {
+			var postID int
+			var c Category
+			if err := rows.Scan(&postID, &c.ID, &c.Name); err != nil {
+				continue
+			}
+			cats[postID] = append(cats[postID], c)
+		}
+		rows.Close()
+	}
+	return cats, nil
+}
+
+func (s sqlitePosts) SetCategories(ctx context.Context, postID int, categoryIDs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := database.Exec(ctx, tx, "DELETE FROM post_categories WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	for _, id := range categoryIDs {
+		if _, err := database.Exec(ctx, tx, "INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqliteComments struct{ db *sql.DB }
+
+// commentColumns are the columns scanned by scanComment
+const commentColumns = `comments.id, comments.post_id, comments.user_id, users.username, comments.content,
+	comments.created_at, comments.like_count, comments.dislike_count`
+
+func scanComment(row interface{ Scan(...interface{}) error }) (Comment, error) {
+	var c Comment
+	err := row.Scan(&c.ID, &c.PostID, &c.UserID, &c.Author, &c.Content, database.ScanTime(&c.CreatedAt), &c.LikeCount, &c.DislikeCount)
+	return c, err
+}
+
+func (s sqliteComments) Create(ctx context.Context, postID, userID int, content string) (int, error) {
+	res, err := database.Exec(ctx, s.db, "INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)", postID, userID, content)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s sqliteComments) Get(ctx context.Context, id int) (Comment, error) {
+	c, err := scanComment(database.QueryRow(ctx, s.db, "SELECT "+commentColumns+" FROM comments JOIN users ON comments.user_id = users.id WHERE comments.id = ?", id))
+	return c, notFound(err)
+}
+
+func (s sqliteComments) ForPost(ctx context.Context, postID int) ([]Comment, error) {
+	rows, err := database.Query(ctx, s.db, `
+		SELECT `+commentColumns+`
+		FROM comments
+		JOIN users ON comments.user_id = users.id
+		WHERE comments.post_id = ?
+		ORDER BY comments.created_at ASC, comments.id ASC
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comments []Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			continue
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s sqliteComments) Commenters(ctx context.Context, postID int) ([]int, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT DISTINCT user_id FROM comments WHERE post_id = ?", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+func (s sqliteComments) Delete(ctx context.Context, id int) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM comments WHERE id = ?", id)
+	return err
+}
+
+func (s sqliteComments) ByUser(ctx context.Context, userID int) ([]Comment, error) {
+	return userComments(ctx, s.db, userID)
+}
+
+func (s sqliteComments) CountByUser(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM comments WHERE user_id = ?", userID).Scan(&n)
+	return n, err
+}
+
+// userComments lists the comments a user wrote, for the SQLite and Postgres stores
+func userComments(ctx context.Context, db *sql.DB, userID int) ([]Comment, error) {
+	rows, err := database.Query(ctx, db, "SELECT "+commentColumns+" FROM comments JOIN users ON comments.user_id = users.id WHERE comments.user_id = ? ORDER BY comments.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comments []Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return comments, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+type sqliteVotes struct{ db *sql.DB }
+
+func (s sqliteVotes) Cast(ctx context.Context, userID, postID, commentID int, isLike bool) (bool, error) {
+	key := "dislike"
+	if isLike {
+		key = "like"
+	}
+	// Repeating the current vote retracts it
+	target, targetID := reactionTarget(postID, commentID)
+	res, err := database.Exec(ctx, s.db, "DELETE FROM reactions WHERE user_id = ? AND reaction = ? AND "+target, userID, key, targetID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+	// Otherwise add the vote or switch the opposite one. A single upsert, so a double
+	// click or a like racing a dislike still leaves one vote rather than failing.
+	postArg, commentArg := nullableTarget(postID, commentID)
+	_, err = database.Exec(ctx, s.db, "INSERT INTO reactions (user_id, post_id, comment_id, reaction) VALUES (?, ?, ?, ?) "+voteConflict(commentID)+
+		" DO UPDATE SET reaction = excluded.reaction, created_at = CURRENT_TIMESTAMP", userID, postArg, commentArg, key)
+	return err == nil, err
+}
+
+func (s sqliteVotes) Toggle(ctx context.Context, userID, postID, commentID int, key string) (bool, error) {
+	target, targetID := reactionTarget(postID, commentID)
+	res, err := database.Exec(ctx, s.db, "DELETE FROM reactions WHERE user_id = ? AND reaction = ? AND "+target, userID, key, targetID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return false, nil
+	}
+	postArg, commentArg := nullableTarget(postID, commentID)
+	_, err = database.Exec(ctx, s.db, "INSERT INTO reactions (user_id, post_id, comment_id, reaction) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING", userID, postArg, commentArg, key)
+	return err == nil, err
+}
+
+func (s sqliteVotes) Counts(ctx context.Context, postID, commentID int) (int, int, error) {
+	var likes, dislikes int
+	var err error
+	if commentID > 0 {
+		err = database.QueryRow(ctx, s.db, "SELECT like_count, dislike_count FROM comments WHERE id = ?", commentID).Scan(&likes, &dislikes)
+	} else {
+		err = database.QueryRow(ctx, s.db, "SELECT like_count, dislike_count FROM posts WHERE id = ?", postID).Scan(&likes, &dislikes)
+	}
+	return likes, dislikes, notFound(err)
+}
+
+func (s sqliteVotes) OnPosts(ctx context.Context, postIDs []int) ([]Reaction, error) {
+	return s.on(ctx, "post_id", postIDs)
+}
+
+func (s sqliteVotes) OnComments(ctx context.Context, commentIDs []int) ([]Reaction, error) {
+	return s.on(ctx, "comment_id", commentIDs)
+}
+
+// on loads reactions keyed by column ("post_id" or "comment_id"). A reaction targets
+// either a post or a comment, so post_id only matches reactions on the post itself.
+func (s sqliteVotes) on(ctx context.Context, column string, ids []int) ([]Reaction, error) {
+	var reactions []Reaction
+	for _, batch := range database.Batches(ids) {
+		placeholders, args := database.InClause(batch)
+		rows, err := database.Query(ctx, s.db, `
+			SELECT `+reactionColumns+`
+			FROM reactions
+			JOIN users ON reactions.user_id = users.id
+			WHERE reactions.`+column+` IN (`+placeholders+`)
+			ORDER BY reactions.id ASC
+		`, args...)
+		if err != nil {
+			return reactions, err
+		}
+		for rows.Next() {
+			r, err := scanReaction(rows)
+			if err != nil {
+				continue
+			}
+			reactions = append(reactions, r)
+		}
+		rows.Close()
+	}
+	return reactions, nil
+}
+
+// reactionColumns are the columns scanned by scanReaction
+const reactionColumns = `COALESCE(reactions.post_id, 0), COALESCE(reactions.comment_id, 0), reactions.user_id, users.username,
+	reactions.reaction, reactions.created_at`
+
+func scanReaction(row interface{ Scan(...interface{}) error }) (Reaction, error) {
+	var r Reaction
+	err := row.Scan(&r.PostID, &r.CommentID, &r.UserID, &r.Username, &r.Key, database.ScanTime(&r.CreatedAt))
+	return r, err
+}
+
+func (s sqliteVotes) ByUser(ctx context.Context, userID int) ([]Reaction, error) {
+	return userReactions(ctx, s.db, userID)
+}
+
+// userReactions lists the reactions a user left, for the SQLite and Postgres stores
+func userReactions(ctx context.Context, db *sql.DB, userID int) ([]Reaction, error) {
+	rows, err := database.Query(ctx, db, "SELECT "+reactionColumns+" FROM reactions JOIN users ON reactions.user_id = users.id WHERE reactions.user_id = ? ORDER BY reactions.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reactions []Reaction
+	for rows.Next() {
+		r, err := scanReaction(rows)
+		if err != nil {
+			return reactions, err
+		}
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+func (s sqliteVotes) Received(ctx context.Context, userIDs []int) ([]ReceivedVotes, error) {
+	var received []ReceivedVotes
+	for _, batch := range database.Batches(userIDs) {
+		placeholders, ids := database.InClause(batch)
+		rows, err := database.Query(ctx, s.db, `
+			SELECT posts.user_id, date(reactions.created_at), 0,
+			       SUM(reactions.reaction = 'like'), SUM(reactions.reaction = 'dislike')
+			FROM reactions
+			JOIN posts ON reactions.post_id = posts.id
+			WHERE posts.user_id IN (`+placeholders+`)
+			  AND reactions.user_id != posts.user_id
+			  AND reactions.reaction IN ('like', 'dislike')
+			GROUP BY posts.user_id, date(reactions.created_at)
+			UNION ALL
+			SELECT comments.user_id, date(reactions.created_at), 1,
+			       SUM(reactions.reaction = 'like'), SUM(reactions.reaction = 'dislike')
+			FROM reactions
+			JOIN comments ON reactions.comment_id = comments.id
+			WHERE comments.user_id IN (`+placeholders+`)
+			  AND reactions.user_id != comments.user_id
+			  AND reactions.reaction IN ('like', 'dislike')
+			GROUP BY comments.user_id, date(reactions.created_at)
+		`, append(ids, ids...)...)
+		if err != nil {
+			return received, err
+		}
+		for rows.Next() {
+			var v ReceivedVotes
+			var day sql.NullString
+			if err := rows.Scan(&v.UserID, &day, &v.OnComment, &v.Likes, &v.Dislikes); err != nil {
+				rows.Close()
+				return received, err
+			}
+			v.Day = day.String
+			received = append(received, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return received, err
+		}
+	}
+	return received, nil
+}
+
+type sqliteCategories struct{ db *sql.DB }
+
+func (s sqliteCategories) All(ctx context.Context) ([]Category, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT id, name FROM categories ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cats []Category
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			continue
+		}
+		cats = append(cats, c)
+	}
+	return cats, rows.Err()
+}
+
+func (s sqliteCategories) AllExist(ctx context.Context, ids []int) (bool, error) {
+	if len(ids) == 0 {
+		return true, nil
+	}
+	placeholders, args := database.InClause(ids)
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM categories WHERE id IN ("+placeholders+")", args...).Scan(&n)
+	return n == len(ids), err
+}
+
+func (s sqliteCategories) NameExists(ctx context.Context, name string) (bool, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM categories WHERE name = ? COLLATE NOCASE", name).Scan(&n)
+	return n > 0, err
+}
+
+func (s sqliteCategories) Create(ctx context.Context, name string) (int, error) {
+	res, err := database.Exec(ctx, s.db, "INSERT INTO categories (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+type sqliteNotifications struct{ db *sql.DB }
+
+func (s sqliteNotifications) Enabled(ctx context.Context, userID int, notifType string) (bool, error) {
+	var enabled bool
+	err := database.QueryRow(ctx, s.db, "SELECT enabled FROM notification_preferences WHERE user_id = ? AND type = ?", userID, notifType).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return enabled, err
+}
+
+func (s sqliteNotifications) Create(ctx context.Context, userID, actorID int, notifType string, postID, commentID int) error {
+	var commentArg interface{}
+	if commentID > 0 {
+		commentArg = commentID
+	}
+	_, err := database.Exec(ctx, s.db, "INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id) VALUES (?, ?, ?, ?, ?)",
+		userID, actorID, notifType, postID, commentArg)
+	return err
+}
+
+func (s sqliteNotifications) SentSince(ctx context.Context, actorID int, notifType string, since time.Time) (int, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM notifications WHERE actor_id = ? AND type = ? AND created_at > ?", actorID, notifType, database.Timestamp(since)).Scan(&n)
+	return n, err
+}
+
+func (s sqliteNotifications) Unread(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := database.QueryRow(ctx, s.db, "SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = FALSE", userID).Scan(&n)
+	return n, err
+}
+
+func (s sqliteNotifications) List(ctx context.Context, userID, limit int) ([]Notification, error) {
+	return listNotifications(ctx, s.db, userID, limit)
+}
+
+// listNotifications returns a user's latest notifications, for the SQLite and Postgres stores
+func listNotifications(ctx context.Context, db *sql.DB, userID, limit int) ([]Notification, error) {
+	rows, err := database.Query(ctx, db, `
+		SELECT notifications.id, notifications.type, users.username, notifications.post_id, posts.title,
+		       COALESCE(notifications.comment_id, 0), notifications.is_read, notifications.created_at
+		FROM notifications
+		JOIN users ON notifications.actor_id = users.id
+		JOIN posts ON notifications.post_id = posts.id
+		WHERE notifications.user_id = ?
+		ORDER BY notifications.created_at DESC, notifications.id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Type, &n.Actor, &n.PostID, &n.PostTitle, &n.CommentID, &n.Read, database.ScanTime(&n.CreatedAt)); err != nil {
+			return notifications, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (s sqliteNotifications) MarkRead(ctx context.Context, userID, id int) (int, error) {
+	var postID int
+	err := database.QueryRow(ctx, s.db, "SELECT post_id FROM notifications WHERE id = ? AND user_id = ?", id, userID).Scan(&postID)
+	if err != nil {
+		return 0, notFound(err)
+	}
+	_, err = database.Exec(ctx, s.db, "UPDATE notifications SET is_read = TRUE WHERE id = ? AND user_id = ?", id, userID)
+	return postID, err
+}
+
+func (s sqliteNotifications) MarkAllRead(ctx context.Context, userID int) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE notifications SET is_read = TRUE WHERE user_id = ? AND is_read = FALSE", userID)
+	return err
+}
+
+func (s sqliteNotifications) Preferences(ctx context.Context, userID int) (map[string]bool, error) {
+	return notificationPreferences(ctx, s.db, userID)
+}
+
+// notificationPreferences returns the types a user set, for the SQLite and Postgres stores
+func notificationPreferences(ctx context.Context, db *sql.DB, userID int) (map[string]bool, error) {
+	rows, err := database.Query(ctx, db, "SELECT type, enabled FROM notification_preferences WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	prefs := map[string]bool{}
+	for rows.Next() {
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return prefs, err
+		}
+		prefs[t] = enabled
+	}
+	return prefs, rows.Err()
+}
+
+func (s sqliteNotifications) SetPreferences(ctx context.Context, userID int, enabled map[string]bool) error {
+	return setNotificationPreferences(ctx, s.db, userID, enabled)
+}
+
+// setNotificationPreferences saves a user's preferences in one transaction, for the
+// SQLite and Postgres stores
+func setNotificationPreferences(ctx context.Context, db *sql.DB, userID int, enabled map[string]bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for t, on := range enabled {
+		_, err := database.Exec(ctx, tx, `
+			INSERT INTO notification_preferences (user_id, type, enabled) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, type) DO UPDATE SET enabled = excluded.enabled
+		`, userID, t, on)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqliteMentions struct{ db *sql.DB }
+
+func (s sqliteMentions) Add(ctx context.Context, m Mention) (bool, error) {
+	var commentArg interface{}
+	if m.CommentID > 0 {
+		commentArg = m.CommentID
+	}
+	res, err := database.Exec(ctx, s.db, "INSERT INTO mentions (post_id, comment_id, user_id, username) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		m.PostID, commentArg, m.UserID, m.Username)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s sqliteMentions) MarkNotified(ctx context.Context, postID, commentID, userID int) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE mentions SET notified = TRUE WHERE post_id = ? AND IFNULL(comment_id, 0) = ? AND user_id = ?", postID, commentID, userID)
+	return err
+}
+
+func (s sqliteMentions) ForPost(ctx context.Context, postID int) ([]Mention, error) {
+	rows, err := database.Query(ctx, s.db, "SELECT post_id, IFNULL(comment_id, 0), user_id, username FROM mentions WHERE post_id = ? ORDER BY id", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var mentions []Mention
+	for rows.Next() {
+		var m Mention
+		if err := rows.Scan(&m.PostID, &m.CommentID, &m.UserID, &m.Username); err != nil {
+			return mentions, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+type sqliteSubscriptions struct{ db *sql.DB }
+
+func (s sqliteSubscriptions) Follow(ctx context.Context, userID, postID int, unsubscribeToken string) error {
+	_, err := database.Exec(ctx, s.db, "INSERT INTO subscriptions (user_id, post_id, unsubscribe_token) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		userID, postID, unsubscribeToken)
+	return err
+}
+
+func (s sqliteSubscriptions) Subscribe(ctx context.Context, userID, postID, categoryID int, frequency, unsubscribeToken string) error {
+	return subscribe(ctx, s.db, userID, postID, categoryID, frequency, unsubscribeToken)
+}
+
+func (s sqliteSubscriptions) Frequency(ctx context.Context, userID, postID, categoryID int) (string, error) {
+	return subscriptionFrequency(ctx, s.db, userID, postID, categoryID)
+}
+
+func (s sqliteSubscriptions) Unsubscribe(ctx context.Context, userID, postID, categoryID int) error {
+	return unsubscribe(ctx, s.db, userID, postID, categoryID)
+}
+
+func (s sqliteSubscriptions) ByToken(ctx context.Context, token string) (Subscription, error) {
+	return scanSubscription(database.QueryRow(ctx, s.db, "SELECT "+subscriptionColumns+" FROM "+subscriptionTables+" WHERE subscriptions.unsubscribe_token = ?", token))
+}
+
+func (s sqliteSubscriptions) DeleteByToken(ctx context.Context, token string) error {
+	_, err := database.Exec(ctx, s.db, "DELETE FROM subscriptions WHERE unsubscribe_token = ?", token)
+	return err
+}
+
+func (s sqliteSubscriptions) Due(ctx context.Context, now time.Time) ([]Subscription, error) {
+	return dueSubscriptions(ctx, s.db, now)
+}
+
+func (s sqliteSubscriptions) Activity(ctx context.Context, ids []int, now time.Time) (map[int][]DigestItem, error) {
+	activity := make(map[int][]DigestItem)
+	for _, batch := range database.Batches(ids) {
+		placeholders, args := database.InClause(batch)
+		if err := digestActivity(ctx, s.db, "IN ("+placeholders+")", args, now, activity); err != nil {
+			return activity, err
+		}
+	}
+	return activity, nil
+}
+
+func (s sqliteSubscriptions) MarkSent(ctx context.Context, id int, at time.Time) error {
+	_, err := database.Exec(ctx, s.db, "UPDATE subscriptions SET last_sent_at = ? WHERE id = ?", database.Timestamp(at), id)
+	return err
+}
+
+// subscriptionColumns, from subscriptionTables, are the columns scanned by scanSubscription
+const (
+	subscriptionColumns = `subscriptions.id, subscriptions.user_id, users.email, COALESCE(subscriptions.post_id, 0),
+		COALESCE(subscriptions.category_id, 0), COALESCE(posts.title, categories.name, ''), subscriptions.frequency,
+		subscriptions.unsubscribe_token, subscriptions.last_sent_at`
+	subscriptionTables = `subscriptions
+		JOIN users ON subscriptions.user_id = users.id
+		LEFT JOIN posts ON subscriptions.post_id = posts.id
+		LEFT JOIN categories ON subscriptions.category_id = categories.id`
+)
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (Subscription, error) {
+	var sub Subscription
+	err := row.Scan(&sub.ID, &sub.UserID, &sub.Email, &sub.PostID, &sub.CategoryID, &sub.Target, &sub.Frequency, &sub.Token, database.ScanTime(&sub.LastSentAt))
+	return sub, notFound(err)
+}
+
+// The subscription queries below are shared by the SQLite and Postgres stores; both
+// understand the partial-index ON CONFLICT targets.
+
+// subscribe adds a subscription to a post or category, or changes its schedule
+func subscribe(ctx context.Context, db *sql.DB, userID, postID, categoryID int, frequency, unsubscribeToken string) error {
+	if postID > 0 {
+		_, err := database.Exec(ctx, db, `
+			INSERT INTO subscriptions (user_id, post_id, frequency, unsubscribe_token) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id, post_id) WHERE post_id IS NOT NULL DO UPDATE SET frequency = excluded.frequency
+		`, userID, postID, frequency, unsubscribeToken)
+		return err
+	}
+	_, err := database.Exec(ctx, db, `
+		INSERT INTO subscriptions (user_id, category_id, frequency, unsubscribe_token) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, category_id) WHERE category_id IS NOT NULL DO UPDATE SET frequency = excluded.frequency
+	`, userID, categoryID, frequency, unsubscribeToken)
+	return err
+}
+
+// subscriptionFrequency returns the schedule of a subscription, or "" without one
+func subscriptionFrequency(ctx context.Context, db *sql.DB, userID, postID, categoryID int) (string, error) {
+	var frequency string
+	var err error
+	if postID > 0 {
+		err = database.QueryRow(ctx, db, "SELECT frequency FROM subscriptions WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&frequency)
+	} else {
+		err = database.QueryRow(ctx, db, "SELECT frequency FROM subscriptions WHERE user_id = ? AND category_id = ?", userID, categoryID).Scan(&frequency)
+	}
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return frequency, err
+}
+
+// unsubscribe removes a subscription to a post or category
+func unsubscribe(ctx context.Context, db *sql.DB, userID, postID, categoryID int) error {
+	var err error
+	if postID > 0 {
+		_, err = database.Exec(ctx, db, "DELETE FROM subscriptions WHERE user_id = ? AND post_id = ?", userID, postID)
+	} else {
+		_, err = database.Exec(ctx, db, "DELETE FROM subscriptions WHERE user_id = ? AND category_id = ?", userID, categoryID)
+	}
+	return err
+}
+
+// dueSubscriptions returns the subscriptions whose digest is due
+func dueSubscriptions(ctx context.Context, db *sql.DB, now time.Time) ([]Subscription, error) {
+	rows, err := database.Query(ctx, db, `
+		SELECT `+subscriptionColumns+`
+		FROM `+subscriptionTables+`
+		WHERE subscriptions.frequency = 'immediate'
+		   OR (subscriptions.frequency = 'daily' AND subscriptions.last_sent_at <= ?)
+		   OR (subscriptions.frequency = 'weekly' AND subscriptions.last_sent_at <= ?)
+		ORDER BY subscriptions.id
+	`, database.Timestamp(now.AddDate(0, 0, -1)), database.Timestamp(now.AddDate(0, 0, -7)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return due, err
+		}
+		due = append(due, sub)
+	}
+	return due, rows.Err()
+}
+
+// digestActivity adds to activity what is new up to now for the subscriptions whose ID
+// matches idCondition, in two queries however many subscriptions there are: one for the
+// comments on followed posts, one for the posts in followed categories
+func digestActivity(ctx context.Context, db *sql.DB, idCondition string, idArgs []interface{}, now time.Time, activity map[int][]DigestItem) error {
+	queries := []string{`
+		SELECT subscription_id, post_id, title, author, content FROM (
+			SELECT subscriptions.id AS subscription_id, comments.post_id AS post_id, '' AS title,
+				users.username AS author, comments.content AS content,
+				ROW_NUMBER() OVER (PARTITION BY subscriptions.id ORDER BY comments.created_at, comments.id) AS n
+			FROM subscriptions
+			JOIN comments ON comments.post_id = subscriptions.post_id
+			JOIN users ON comments.user_id = users.id
+			WHERE subscriptions.id ` + idCondition + ` AND comments.user_id != subscriptions.user_id
+			  AND comments.created_at > subscriptions.last_sent_at AND comments.created_at <= ?
+		) activity
+		WHERE n <= 50
+		ORDER BY subscription_id, n
+	`, `
+		SELECT subscription_id, post_id, title, author, content FROM (
+			SELECT subscriptions.id AS subscription_id, posts.id AS post_id, posts.title AS title,
+				users.username AS author, '' AS content,
+				ROW_NUMBER() OVER (PARTITION BY subscriptions.id ORDER BY posts.created_at, posts.id) AS n
+			FROM subscriptions
+			JOIN post_categories ON post_categories.category_id = subscriptions.category_id
+			JOIN posts ON posts.id = post_categories.post_id
+			JOIN users ON posts.user_id = users.id
+			WHERE subscriptions.id ` + idCondition + ` AND posts.user_id != subscriptions.user_id
+			  AND posts.created_at > subscriptions.last_sent_at AND posts.created_at <= ?
+		) activity
+		WHERE n <= 50
+		ORDER BY subscription_id, n
+	`}
+	args := append(append([]interface{}{}, idArgs...), database.Timestamp(now))
+	for _, query := range queries {
+		rows, err := database.Query(ctx, db, query, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			var item DigestItem
+			if err := rows.Scan(&id, &item.PostID, &item.Title, &item.Author, &item.Content); err != nil {
+				rows.Close()
+				return err
+			}
+			activity[id] = append(activity[id], item)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+// Package store defines the data access interfaces used by the handlers, with SQLite
+// and Postgres implementations for the running forum and an in-memory one for tests.
+// Every method takes the caller's context, usually the request's; the SQL stores cancel
+// a query when it ends or after database.QueryTimeout.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested row doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// User is a registered account
+type User struct {
+	ID           int
+	Email        string
+	Username     string
+	PasswordHash string
+	CreatedAt    time.Time
+	Timezone     string // IANA name, or empty for the server's default
+}
+
+// Post is a forum post with its author's username and denormalised counters
+type Post struct {
+	ID           int
+	UserID       int
+	Author       string
+	Title        string
+	Content      string
+	CreatedAt    time.Time
+	LikeCount    int
+	DislikeCount int
+	CommentCount int
+}
+
+// Comment is a comment on a post with its author's username and vote counters
+type Comment struct {
+	ID           int
+	PostID       int
+	UserID       int
+	Author       string
+	Content      string
+	CreatedAt    time.Time
+	LikeCount    int
+	DislikeCount int
+}
+
+// Category is a topic posts are filed under
+type Category struct {
+	ID   int
+	Name string
+}
+
+// Reaction is one user's reaction on a post or, when CommentID is set, a comment
+type Reaction struct {
+	PostID    int
+	CommentID int
+	UserID    int
+	Username  string
+	Key       string
+	CreatedAt time.Time
+}
+
+// Mention is a user @mentioned in a post or, when CommentID is set, one of its comments
+type Mention struct {
+	PostID    int
+	CommentID int
+	UserID    int
+	Username  string
+}
+
+// ReceivedVotes counts the likes and dislikes other users gave someone's posts, or
+// their comments when OnComment is set, on one UTC day
+type ReceivedVotes struct {
+	UserID    int
+	Day       string // YYYY-MM-DD
+	OnComment bool
+	Likes     int
+	Dislikes  int
+}
+
+// AccountChange is a past change of a user's username or email
+type AccountChange struct {
+	Field     string // "username" or "email"
+	OldValue  string
+	NewValue  string
+	ChangedAt time.Time
+}
+
+// AccountDeletion is a requested deletion of an account, carried out once
+// ExecuteAfter has passed
+type AccountDeletion struct {
+	UserID       int
+	Mode         string // "anonymise" keeps the user's posts and comments, "remove" deletes them
+	ExecuteAfter time.Time
+}
+
+// Identity is an external OpenID Connect identity linked to an account
+type Identity struct {
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// Session is a login session without its token
+type Session struct {
+	ID        int
+	ExpiresAt time.Time
+}
+
+// Notification is a notification with the username of the user who caused it and
+// the title of the post it is about
+type Notification struct {
+	ID        int
+	Type      string
+	Actor     string
+	PostID    int
+	PostTitle string
+	CommentID int // set when it is about a comment on the post
+	Read      bool
+	CreatedAt time.Time
+}
+
+// Subscription is a user's subscription to a post or, when CategoryID is set, a
+// category, with its email digest schedule
+type Subscription struct {
+	ID         int
+	UserID     int
+	Email      string // the subscriber's
+	PostID     int
+	CategoryID int
+	Target     string // the post's title or the category's name
+	Frequency  string // "immediate", "daily" or "weekly"
+	Token      string // authenticates unsubscribe links
+	LastSentAt time.Time
+}
+
+// DigestItem is a new comment on a followed post, or a new post in a followed
+// category, as listed in a digest email
+type DigestItem struct {
+	PostID  int
+	Title   string // the new post's
+	Author  string
+	Content string // the new comment's
+}
+
+// PostFilter narrows a post listing; zero fields don't filter
+type PostFilter struct {
+	AuthorID   int // posts written by this user
+	LikedBy    int // posts this user liked
+	CategoryID int // posts filed under this category
+	Limit      int // at most this many posts, or all of them when 0
+	Offset     int // skip this many of the newest posts first
+}
+
+// UserStore manages accounts
+type UserStore interface {
+	Create(ctx context.Context, email, username, passwordHash string) (int, error)
+	ByEmail(ctx context.Context, email string) (User, error)
+	ByUsername(ctx context.Context, username string) (User, error)
+	// Exists reports whether the email or the username is already used by an account
+	Exists(ctx context.Context, email, username string) (bool, error)
+	SetPasswordHash(ctx context.Context, userID int, hash string) error
+	SetTimezone(ctx context.Context, userID int, timezone string) error
+	Get(ctx context.Context, id int) (User, error)
+	// ByEmailFold looks a user up by email, ignoring case
+	ByEmailFold(ctx context.Context, email string) (User, error)
+	// EmailTaken reports whether an account other than exceptID uses the email
+	EmailTaken(ctx context.Context, email string, exceptID int) (bool, error)
+	// UsernameTaken reports whether the username belongs to an account other than
+	// exceptID, either currently or as a former name that still redirects to it
+	UsernameTaken(ctx context.Context, username string, exceptID int) (bool, error)
+	// RenamedTo returns the current username of the account that most recently gave
+	// up a username
+	RenamedTo(ctx context.Context, oldUsername string) (string, error)
+	// Change sets the user's "username" or "email" and records the change
+	Change(ctx context.Context, userID int, field, oldValue, newValue string) error
+	// LastChange returns when the user last changed the field
+	LastChange(ctx context.Context, userID int, field string) (time.Time, error)
+	// Changes returns the user's latest username and email changes, newest first
+	Changes(ctx context.Context, userID, limit int) ([]AccountChange, error)
+
+	// ByIdentity returns the user an external identity is linked to
+	ByIdentity(ctx context.Context, provider, subject string) (User, error)
+	LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error
+	// CreateWithIdentity adds an account without a password, linked to an external identity
+	CreateWithIdentity(ctx context.Context, email, username, provider, subject string) (int, error)
+	Identities(ctx context.Context, userID int) ([]Identity, error)
+
+	// ScheduleDeletion requests the account's deletion. A repeated request changes the
+	// mode but keeps the original date.
+	ScheduleDeletion(ctx context.Context, d AccountDeletion) error
+	// Deletion returns the account's pending deletion
+	Deletion(ctx context.Context, userID int) (AccountDeletion, error)
+	CancelDeletion(ctx context.Context, userID int) error
+	// DueDeletions returns the deletions whose date has passed
+	DueDeletions(ctx context.Context, now time.Time) ([]AccountDeletion, error)
+	// Delete removes an account with everything that belongs to it. When placeholder
+	// is set, the user's posts and comments are first credited to the account with its
+	// username, which is created with its email if needed.
+	Delete(ctx context.Context, userID int, placeholder *User) error
+}
+
+// SessionStore manages login sessions
+type SessionStore interface {
+	// Create starts a session for the user, ending any other session they had
+	Create(ctx context.Context, userID int, token string, expiresAt time.Time) error
+	// User returns the owner of an unexpired session
+	User(ctx context.Context, token string) (User, error)
+	Delete(ctx context.Context, token string) error
+	// ForUser returns the user's sessions, expired or not
+	ForUser(ctx context.Context, userID int) ([]Session, error)
+}
+
+// PostStore manages posts and the categories they are filed under
+type PostStore interface {
+	// Create adds a post filed under the categories. Nothing is saved if any category doesn't exist.
+	Create(ctx context.Context, userID int, title, content string, categoryIDs []int) (int, error)
+	Get(ctx context.Context, id int) (Post, error)
+	// List returns matching posts, newest first
+	List(ctx context.Context, filter PostFilter) ([]Post, error)
+	// Delete removes a post with its comments and reactions
+	Delete(ctx context.Context, id int) error
+	// Categories returns the categories of each post, sorted by name
+	Categories(ctx context.Context, postIDs []int) (map[int][]Category, error)
+	// SetCategories replaces the categories of a post
+	SetCategories(ctx context.Context, postID int, categoryIDs []int) error
+}
+
+// CommentStore manages comments
+type CommentStore interface {
+	Create(ctx context.Context, postID, userID int, content string) (int, error)
+	Get(ctx context.Context, id int) (Comment, error)
+	// ForPost returns the comments on a post, oldest first
+	ForPost(ctx context.Context, postID int) ([]Comment, error)
+	// Commenters returns the distinct users who commented on a post
+	Commenters(ctx context.Context, postID int) ([]int, error)
+	// Delete removes a comment with its reactions
+	Delete(ctx context.Context, id int) error
+	// ByUser returns the comments a user wrote, oldest first
+	ByUser(ctx context.Context, userID int) ([]Comment, error)
+	CountByUser(ctx context.Context, userID int) (int, error)
+}
+
+// VoteStore manages likes, dislikes and the other reactions on posts and comments.
+// Methods taking postID and commentID target the comment when commentID > 0.
+type VoteStore interface {
+	// Cast applies a like or dislike, replacing the opposite one. Repeating the current
+	// vote retracts it. Reports whether a vote was added or switched.
+	Cast(ctx context.Context, userID, postID, commentID int, isLike bool) (bool, error)
+	// Toggle adds a reaction the user hasn't used on the target yet, and removes it
+	// otherwise. Reports whether it was added.
+	Toggle(ctx context.Context, userID, postID, commentID int, key string) (bool, error)
+	Counts(ctx context.Context, postID, commentID int) (likes int, dislikes int, err error)
+	// OnPosts and OnComments return every reaction on the given targets, oldest first
+	OnPosts(ctx context.Context, postIDs []int) ([]Reaction, error)
+	OnComments(ctx context.Context, commentIDs []int) ([]Reaction, error)
+	// Received counts the votes cast on the users' posts and comments per day, leaving
+	// out votes on their own content
+	Received(ctx context.Context, userIDs []int) ([]ReceivedVotes, error)
+	// ByUser returns every reaction the user left, oldest first
+	ByUser(ctx context.Context, userID int) ([]Reaction, error)
+}
+
+// CategoryStore manages categories
+type CategoryStore interface {
+	// All returns every category sorted by name
+	All(ctx context.Context) ([]Category, error)
+	// AllExist reports whether every one of ids, which must not repeat, is a category
+	AllExist(ctx context.Context, ids []int) (bool, error)
+	// NameExists reports whether a category has this name, ignoring case
+	NameExists(ctx context.Context, name string) (bool, error)
+	Create(ctx context.Context, name string) (int, error)
+}
+
+// NotificationStore manages the notifications users get about activity on their content
+type NotificationStore interface {
+	// Enabled reports whether the user wants notifications of this type; types they
+	// never set are on
+	Enabled(ctx context.Context, userID int, notifType string) (bool, error)
+	// Create records a notification about a post or, when commentID > 0, a comment
+	Create(ctx context.Context, userID, actorID int, notifType string, postID, commentID int) error
+	// SentSince counts the notifications of a type the actor caused since a time
+	SentSince(ctx context.Context, actorID int, notifType string, since time.Time) (int, error)
+	// Unread counts the user's unread notifications
+	Unread(ctx context.Context, userID int) (int, error)
+	// List returns the user's latest notifications, newest first
+	List(ctx context.Context, userID, limit int) ([]Notification, error)
+	// MarkRead marks one of the user's notifications read and returns its post
+	MarkRead(ctx context.Context, userID, id int) (postID int, err error)
+	MarkAllRead(ctx context.Context, userID int) error
+	// Preferences returns the types the user turned on or off; others are on
+	Preferences(ctx context.Context, userID int) (map[string]bool, error)
+	// SetPreferences saves whether each type is on, all together
+	SetPreferences(ctx context.Context, userID int, enabled map[string]bool) error
+}
+
+// MentionStore manages @mentions in posts and comments
+type MentionStore interface {
+	// Add records a mention. Reports false when the user was already mentioned there.
+	Add(ctx context.Context, m Mention) (bool, error)
+	// MarkNotified records that the mentioned user was told about the mention
+	MarkNotified(ctx context.Context, postID, commentID, userID int) error
+	// ForPost returns the mentions in a post and in its comments
+	ForPost(ctx context.Context, postID int) ([]Mention, error)
+}
+
+// SubscriptionStore manages subscriptions to posts
+type SubscriptionStore interface {
+	// Follow subscribes the user to a post unless they already are, keeping the
+	// schedule they chose
+	Follow(ctx context.Context, userID, postID int, unsubscribeToken string) error
+	// Subscribe subscribes the user to a post or, when postID is 0, a category, or
+	// changes the schedule of their subscription
+	Subscribe(ctx context.Context, userID, postID, categoryID int, frequency, unsubscribeToken string) error
+	// Frequency returns the user's schedule for a post or category, or "" when they
+	// aren't subscribed
+	Frequency(ctx context.Context, userID, postID, categoryID int) (string, error)
+	Unsubscribe(ctx context.Context, userID, postID, categoryID int) error
+	// ByToken returns the subscription an unsubscribe token belongs to
+	ByToken(ctx context.Context, token string) (Subscription, error)
+	DeleteByToken(ctx context.Context, token string) error
+	// Due returns the subscriptions whose digest is due at now: immediate ones, and
+	// daily and weekly ones last sent a day or a week ago
+	Due(ctx context.Context, now time.Time) ([]Subscription, error)
+	// Activity returns, by subscription ID, the comments on each subscribed post or the
+	// posts in each subscribed category that others added after the subscription's
+	// last digest and up to now, oldest first and at most 50 each. Subscriptions with
+	// nothing new are left out.
+	Activity(ctx context.Context, ids []int, now time.Time) (map[int][]DigestItem, error)
+	// MarkSent records that the subscription's digest covers everything up to at
+	MarkSent(ctx context.Context, id int, at time.Time) error
+}
+
+// Store groups the stores the handlers need
+type Store struct {
+	Users         UserStore
+	Sessions      SessionStore
+	Posts         PostStore
+	Comments      CommentStore
+	Votes         VoteStore
+	Categories    CategoryStore
+	Notifications NotificationStore
+	Mentions      MentionStore
+	Subscriptions SubscriptionStore
+}
@@ -0,0 +1,948 @@
+package store
+
+import (
+	"context"
+	"forum/database"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The same suite runs against every implementation. The SQL stores get a freshly
+// migrated database per test. Postgres runs only when TEST_DATABASE_URL names a
+// server; its forum tables are emptied before each test, so never point it at a
+// database you want to keep.
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) *Store { return NewMemory() })
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) *Store {
+		database.InitDB(database.SQLite, filepath.Join(t.TempDir(), "forum.db"))
+		t.Cleanup(func() { database.DB.Close() })
+		if _, err := database.MigrateUp(0); err != nil {
+			t.Fatalf("migrating: %v", err)
+		}
+		return NewSQLite(database.DB)
+	})
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	database.InitDB(database.Postgres, dsn)
+	defer database.DB.Close()
+	if _, err := database.MigrateUp(0); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	runStoreTests(t, func(t *testing.T) *Store {
+		_, err := database.DB.Exec(`TRUNCATE users, sessions, posts, comments, categories, post_categories, reactions,
+			notifications, notification_preferences, mentions, subscriptions, account_changes, user_identities,
+			account_deletions RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatalf("emptying tables: %v", err)
+		}
+		return NewPostgres(database.DB)
+	})
+}
+
+// runStoreTests runs every store test, each against a new, empty store from open
+func runStoreTests(t *testing.T, open func(t *testing.T) *Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s *Store)
+	}{
+		{"Users", testUsers},
+		{"AccountChanges", testAccountChanges},
+		{"Identities", testIdentities},
+		{"AccountDeletion", testAccountDeletion},
+		{"UserContent", testUserContent},
+		{"Sessions", testSessions},
+		{"Posts", testPosts},
+		{"PostCategories", testPostCategories},
+		{"Comments", testComments},
+		{"Votes", testVotes},
+		{"ConcurrentVotes", testConcurrentVotes},
+		{"Reactions", testReactions},
+		{"ReceivedVotes", testReceivedVotes},
+		{"Categories", testCategories},
+		{"Notifications", testNotifications},
+		{"Mentions", testMentions},
+		{"Subscriptions", testSubscriptions},
+		{"Digests", testDigests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+// check stops the test on an unexpected error
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addUser(t *testing.T, s *Store, username string) int {
+	t.Helper()
+	id, err := s.Users.Create(context.Background(), username+"@example.com", username, "hash")
+	check(t, err)
+	return id
+}
+
+func addPost(t *testing.T, s *Store, userID int, title string, categoryIDs ...int) int {
+	t.Helper()
+	id, err := s.Posts.Create(context.Background(), userID, title, "content", categoryIDs)
+	check(t, err)
+	return id
+}
+
+func addComment(t *testing.T, s *Store, postID, userID int, content string) int {
+	t.Helper()
+	id, err := s.Comments.Create(context.Background(), postID, userID, content)
+	check(t, err)
+	return id
+}
+
+func addCategory(t *testing.T, s *Store, name string) int {
+	t.Helper()
+	id, err := s.Categories.Create(context.Background(), name)
+	check(t, err)
+	return id
+}
+
+// vote casts a vote and returns whether the user's vote is now set
+func vote(t *testing.T, s *Store, userID, postID, commentID int, isLike bool) bool {
+	t.Helper()
+	set, err := s.Votes.Cast(context.Background(), userID, postID, commentID, isLike)
+	check(t, err)
+	return set
+}
+
+// react toggles a reaction and returns whether it was added
+func react(t *testing.T, s *Store, userID, postID, commentID int, key string) bool {
+	t.Helper()
+	added, err := s.Votes.Toggle(context.Background(), userID, postID, commentID, key)
+	check(t, err)
+	return added
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUsers(t *testing.T, s *Store) {
+	ctx := context.Background()
+	id := addUser(t, s, "alice")
+
+	u, err := s.Users.ByEmail(ctx, "alice@example.com")
+	check(t, err)
+	if u.ID != id || u.Username != "alice" || u.PasswordHash != "hash" || u.Timezone != "" || u.CreatedAt.IsZero() {
+		t.Errorf("ByEmail = %+v", u)
+	}
+	if u, err := s.Users.ByUsername(ctx, "alice"); err != nil || u.ID != id {
+		t.Errorf("ByUsername = %+v (%v)", u, err)
+	}
+	if _, err := s.Users.ByEmail(ctx, "nobody@example.com"); err != ErrNotFound {
+		t.Errorf("ByEmail of a missing user: %v, want ErrNotFound", err)
+	}
+	if _, err := s.Users.ByUsername(ctx, "nobody"); err != ErrNotFound {
+		t.Errorf("ByUsername of a missing user: %v, want ErrNotFound", err)
+	}
+
+	exists := []struct {
+		email, username string
+		want            bool
+	}{
+		{"alice@example.com", "someone", true},
+		{"someone@example.com", "alice", true},
+		{"someone@example.com", "someone", false},
+	}
+	for _, e := range exists {
+		if got, err := s.Users.Exists(ctx, e.email, e.username); err != nil || got != e.want {
+			t.Errorf("Exists(%q, %q) = %v (%v), want %v", e.email, e.username, got, err, e.want)
+		}
+	}
+	if _, err := s.Users.Create(ctx, "alice@example.com", "alice2", "hash"); err == nil {
+		t.Error("a second account with the same email was created")
+	}
+	if _, err := s.Users.Create(ctx, "alice2@example.com", "alice", "hash"); err == nil {
+		t.Error("a second account with the same username was created")
+	}
+
+	check(t, s.Users.SetPasswordHash(ctx, id, "new hash"))
+	check(t, s.Users.SetTimezone(ctx, id, "Europe/Berlin"))
+	if u, err := s.Users.ByEmail(ctx, "alice@example.com"); err != nil || u.PasswordHash != "new hash" || u.Timezone != "Europe/Berlin" {
+		t.Errorf("after updates: %+v (%v)", u, err)
+	}
+}
+
+func testAccountChanges(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+
+	if _, err := s.Users.LastChange(ctx, alice, "username"); err != ErrNotFound {
+		t.Errorf("LastChange without changes: %v, want ErrNotFound", err)
+	}
+	check(t, s.Users.Change(ctx, alice, "username", "alice", "alicia"))
+	check(t, s.Users.Change(ctx, alice, "email", "alice@example.com", "alicia@example.com"))
+	if err := s.Users.Change(ctx, alice, "password_hash", "hash", "x"); err == nil {
+		t.Error("Change accepted a field other than username and email")
+	}
+
+	u, err := s.Users.Get(ctx, alice)
+	check(t, err)
+	if u.Username != "alicia" || u.Email != "alicia@example.com" {
+		t.Errorf("after changes: %+v", u)
+	}
+	if last, err := s.Users.LastChange(ctx, alice, "username"); err != nil || last.IsZero() {
+		t.Errorf("LastChange = %v (%v)", last, err)
+	}
+	changes, err := s.Users.Changes(ctx, alice, 10)
+	check(t, err)
+	if len(changes) != 2 || changes[0].Field != "email" || changes[1].OldValue != "alice" || changes[1].NewValue != "alicia" {
+		t.Errorf("Changes = %+v", changes)
+	}
+	if changes, err := s.Users.Changes(ctx, alice, 1); err != nil || len(changes) != 1 {
+		t.Errorf("Changes with limit 1 = %+v (%v)", changes, err)
+	}
+
+	// The old name stays reserved and leads to the new one
+	if current, err := s.Users.RenamedTo(ctx, "alice"); err != nil || current != "alicia" {
+		t.Errorf("RenamedTo(alice) = %q (%v)", current, err)
+	}
+	if _, err := s.Users.RenamedTo(ctx, "nobody"); err != ErrNotFound {
+		t.Errorf("RenamedTo(nobody): %v, want ErrNotFound", err)
+	}
+	taken := []struct {
+		username string
+		exceptID int
+		want     bool
+	}{
+		{"alice", bob, true},
+		{"alice", alice, false},
+		{"alicia", bob, true},
+		{"bob", alice, true},
+		{"carol", alice, false},
+	}
+	for _, tt := range taken {
+		if got, err := s.Users.UsernameTaken(ctx, tt.username, tt.exceptID); err != nil || got != tt.want {
+			t.Errorf("UsernameTaken(%q, %d) = %v (%v), want %v", tt.username, tt.exceptID, got, err, tt.want)
+		}
+	}
+	if got, err := s.Users.EmailTaken(ctx, "bob@example.com", alice); err != nil || !got {
+		t.Errorf("EmailTaken(bob's email) = %v (%v)", got, err)
+	}
+	if got, err := s.Users.EmailTaken(ctx, "alicia@example.com", alice); err != nil || got {
+		t.Errorf("EmailTaken(own email) = %v (%v)", got, err)
+	}
+	if u, err := s.Users.ByEmailFold(ctx, "ALICIA@Example.com"); err != nil || u.ID != alice {
+		t.Errorf("ByEmailFold = %+v (%v)", u, err)
+	}
+	if _, err := s.Users.Get(ctx, 999); err != ErrNotFound {
+		t.Errorf("Get of a missing user: %v, want ErrNotFound", err)
+	}
+}
+
+func testIdentities(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+
+	if _, err := s.Users.ByIdentity(ctx, "google", "123"); err != ErrNotFound {
+		t.Errorf("ByIdentity before linking: %v, want ErrNotFound", err)
+	}
+	check(t, s.Users.LinkIdentity(ctx, alice, "google", "123", "alice@example.com"))
+	if u, err := s.Users.ByIdentity(ctx, "google", "123"); err != nil || u.ID != alice {
+		t.Errorf("ByIdentity = %+v (%v)", u, err)
+	}
+	if err := s.Users.LinkIdentity(ctx, alice, "google", "123", "alice@example.com"); err == nil {
+		t.Error("the same identity was linked twice")
+	}
+
+	bob, err := s.Users.CreateWithIdentity(ctx, "bob@example.com", "bob", "github", "456")
+	check(t, err)
+	if u, err := s.Users.ByIdentity(ctx, "github", "456"); err != nil || u.ID != bob || u.PasswordHash != "" {
+		t.Errorf("ByIdentity of a new account = %+v (%v)", u, err)
+	}
+	if _, err := s.Users.CreateWithIdentity(ctx, "bob2@example.com", "bob2", "github", "456"); err == nil {
+		t.Error("a second account was created for a linked identity")
+	}
+
+	identities, err := s.Users.Identities(ctx, alice)
+	check(t, err)
+	if len(identities) != 1 || identities[0].Provider != "google" || identities[0].Email != "alice@example.com" || identities[0].CreatedAt.IsZero() {
+		t.Errorf("Identities = %+v", identities)
+	}
+}
+
+func testAccountDeletion(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, alice, "Alice's post")
+	addComment(t, s, post, bob, "Bob's comment")
+	bobsPost := addPost(t, s, bob, "Bob's post")
+	addComment(t, s, bobsPost, alice, "Alice's comment")
+	react(t, s, alice, bobsPost, 0, "heart")
+
+	if _, err := s.Users.Deletion(ctx, alice); err != ErrNotFound {
+		t.Errorf("Deletion before scheduling: %v, want ErrNotFound", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	check(t, s.Users.ScheduleDeletion(ctx, AccountDeletion{UserID: alice, Mode: "remove", ExecuteAfter: now.Add(-time.Hour)}))
+	// Asking again changes the mode but keeps the date
+	check(t, s.Users.ScheduleDeletion(ctx, AccountDeletion{UserID: alice, Mode: "anonymise", ExecuteAfter: now.Add(time.Hour)}))
+	check(t, s.Users.ScheduleDeletion(ctx, AccountDeletion{UserID: bob, Mode: "remove", ExecuteAfter: now.Add(time.Hour)}))
+	if d, err := s.Users.Deletion(ctx, alice); err != nil || d.Mode != "anonymise" || !d.ExecuteAfter.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Deletion = %+v (%v)", d, err)
+	}
+	due, err := s.Users.DueDeletions(ctx, now)
+	check(t, err)
+	if len(due) != 1 || due[0].UserID != alice || due[0].Mode != "anonymise" {
+		t.Errorf("DueDeletions = %+v", due)
+	}
+	check(t, s.Users.CancelDeletion(ctx, bob))
+	if _, err := s.Users.Deletion(ctx, bob); err != ErrNotFound {
+		t.Errorf("Deletion after cancelling: %v, want ErrNotFound", err)
+	}
+
+	// Anonymising keeps the content under the placeholder and drops the rest
+	check(t, s.Users.Delete(ctx, alice, &User{Email: "deleted@invalid", Username: "[deleted]"}))
+	if _, err := s.Users.Get(ctx, alice); err != ErrNotFound {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if _, err := s.Users.Deletion(ctx, alice); err != ErrNotFound {
+		t.Errorf("Deletion after Delete: %v, want ErrNotFound", err)
+	}
+	p, err := s.Posts.Get(ctx, post)
+	check(t, err)
+	if p.Author != "[deleted]" || p.CommentCount != 1 {
+		t.Errorf("anonymised post = %+v", p)
+	}
+	if comments, err := s.Comments.ForPost(ctx, bobsPost); err != nil || len(comments) != 1 || comments[0].Author != "[deleted]" {
+		t.Errorf("anonymised comments = %+v (%v)", comments, err)
+	}
+	if reactions, err := s.Votes.OnPosts(ctx, []int{bobsPost}); err != nil || len(reactions) != 0 {
+		t.Errorf("reactions of a deleted user = %+v (%v)", reactions, err)
+	}
+
+	// Removing deletes the user's content, and comments on it
+	check(t, s.Users.Delete(ctx, bob, nil))
+	if _, err := s.Posts.Get(ctx, bobsPost); err != ErrNotFound {
+		t.Errorf("removed user's post: %v, want ErrNotFound", err)
+	}
+	if p, err := s.Posts.Get(ctx, post); err != nil || p.CommentCount != 0 {
+		t.Errorf("post after its commenter was removed = %+v (%v)", p, err)
+	}
+}
+
+func testUserContent(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, bob, "Post")
+	first := addComment(t, s, post, alice, "First")
+	second := addComment(t, s, post, alice, "Second")
+	addComment(t, s, post, bob, "Reply")
+	vote(t, s, alice, post, 0, true)
+	react(t, s, alice, 0, first, "heart")
+	check(t, s.Sessions.Create(ctx, alice, "token", time.Now().Add(time.Hour)))
+
+	comments, err := s.Comments.ByUser(ctx, alice)
+	check(t, err)
+	if len(comments) != 2 || comments[0].ID != first || comments[1].ID != second || comments[0].Author != "alice" {
+		t.Errorf("Comments.ByUser = %+v", comments)
+	}
+	if n, err := s.Comments.CountByUser(ctx, alice); err != nil || n != 2 {
+		t.Errorf("CountByUser = %d (%v), want 2", n, err)
+	}
+
+	reactions, err := s.Votes.ByUser(ctx, alice)
+	check(t, err)
+	if len(reactions) != 2 || reactions[0].PostID != post || reactions[0].Key != "like" ||
+		reactions[1].CommentID != first || reactions[1].PostID != 0 || reactions[1].CreatedAt.IsZero() {
+		t.Errorf("Votes.ByUser = %+v", reactions)
+	}
+
+	sessions, err := s.Sessions.ForUser(ctx, alice)
+	check(t, err)
+	if len(sessions) != 1 || sessions[0].ID == 0 || sessions[0].ExpiresAt.IsZero() {
+		t.Errorf("Sessions.ForUser = %+v", sessions)
+	}
+	if sessions, err := s.Sessions.ForUser(ctx, bob); err != nil || len(sessions) != 0 {
+		t.Errorf("Sessions.ForUser(bob) = %+v (%v)", sessions, err)
+	}
+}
+
+func testSessions(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+
+	check(t, s.Sessions.Create(ctx, alice, "first", time.Now().Add(time.Hour)))
+	if u, err := s.Sessions.User(ctx, "first"); err != nil || u.ID != alice {
+		t.Errorf("session user = %+v (%v)", u, err)
+	}
+	// A new session ends the old one
+	check(t, s.Sessions.Create(ctx, alice, "second", time.Now().Add(time.Hour)))
+	if _, err := s.Sessions.User(ctx, "first"); err != ErrNotFound {
+		t.Errorf("replaced session: %v, want ErrNotFound", err)
+	}
+	check(t, s.Sessions.Delete(ctx, "second"))
+	if _, err := s.Sessions.User(ctx, "second"); err != ErrNotFound {
+		t.Errorf("deleted session: %v, want ErrNotFound", err)
+	}
+
+	check(t, s.Sessions.Create(ctx, alice, "expired", time.Now().Add(-time.Minute)))
+	if _, err := s.Sessions.User(ctx, "expired"); err != ErrNotFound {
+		t.Errorf("expired session: %v, want ErrNotFound", err)
+	}
+	if err := s.Sessions.Create(ctx, 999, "orphan", time.Now().Add(time.Hour)); err == nil {
+		t.Error("a session was created for a user that doesn't exist")
+	}
+}
+
+func testPosts(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	fossils := addCategory(t, s, "Fossils")
+	first := addPost(t, s, alice, "First", fossils)
+	second := addPost(t, s, bob, "Second")
+
+	p, err := s.Posts.Get(ctx, first)
+	check(t, err)
+	if p.UserID != alice || p.Author != "alice" || p.Title != "First" || p.Content != "content" || p.CreatedAt.IsZero() {
+		t.Errorf("Get = %+v", p)
+	}
+	if _, err := s.Posts.Get(ctx, 999); err != ErrNotFound {
+		t.Errorf("Get of a missing post: %v, want ErrNotFound", err)
+	}
+
+	vote(t, s, bob, first, 0, true)
+	lists := []struct {
+		name   string
+		filter PostFilter
+		want   []int
+	}{
+		{"all", PostFilter{}, []int{second, first}},
+		{"by bob", PostFilter{AuthorID: bob}, []int{second}},
+		{"in Fossils", PostFilter{CategoryID: fossils}, []int{first}},
+		{"liked by bob", PostFilter{LikedBy: bob}, []int{first}},
+		{"liked by alice", PostFilter{LikedBy: alice}, nil},
+		{"first page", PostFilter{Limit: 1}, []int{second}},
+		{"second page", PostFilter{Limit: 1, Offset: 1}, []int{first}},
+		{"past the end", PostFilter{Limit: 1, Offset: 2}, nil},
+	}
+	for _, l := range lists {
+		posts, err := s.Posts.List(ctx, l.filter)
+		check(t, err)
+		var ids []int
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		if !equalInts(ids, l.want) {
+			t.Errorf("List %s = %v, want %v", l.name, ids, l.want)
+		}
+	}
+
+	// Nothing is saved when a category doesn't exist
+	if _, err := s.Posts.Create(ctx, alice, "Third", "content", []int{fossils, 999}); err == nil {
+		t.Error("a post was created with a category that doesn't exist")
+	}
+	if posts, err := s.Posts.List(ctx, PostFilter{}); err != nil || len(posts) != 2 {
+		t.Errorf("%d posts after a failed create (%v), want 2", len(posts), err)
+	}
+
+	// Deleting a post takes its comments and their votes with it
+	comment := addComment(t, s, first, bob, "Nice")
+	vote(t, s, alice, first, comment, true)
+	check(t, s.Posts.Delete(ctx, first))
+	if _, err := s.Posts.Get(ctx, first); err != ErrNotFound {
+		t.Errorf("deleted post: %v, want ErrNotFound", err)
+	}
+	if _, err := s.Comments.Get(ctx, comment); err != ErrNotFound {
+		t.Errorf("comment of a deleted post: %v, want ErrNotFound", err)
+	}
+	if r, err := s.Votes.OnComments(ctx, []int{comment}); err != nil || len(r) != 0 {
+		t.Errorf("reactions on a deleted comment: %+v (%v)", r, err)
+	}
+}
+
+func testPostCategories(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	fossils := addCategory(t, s, "Fossils")
+	art := addCategory(t, s, "Art")
+	news := addCategory(t, s, "News")
+	post := addPost(t, s, alice, "Post", fossils, art)
+	bare := addPost(t, s, alice, "Bare")
+
+	names := func(postID int) []string {
+		t.Helper()
+		cats, err := s.Posts.Categories(ctx, []int{post, bare})
+		check(t, err)
+		var names []string
+		for _, c := range cats[postID] {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+	if got := names(post); len(got) != 2 || got[0] != "Art" || got[1] != "Fossils" {
+		t.Errorf("categories = %v, want [Art Fossils]", got)
+	}
+	if got := names(bare); len(got) != 0 {
+		t.Errorf("post without categories has %v", got)
+	}
+
+	check(t, s.Posts.SetCategories(ctx, post, []int{news}))
+	if got := names(post); len(got) != 1 || got[0] != "News" {
+		t.Errorf("after SetCategories = %v, want [News]", got)
+	}
+	if err := s.Posts.SetCategories(ctx, post, []int{999}); err == nil {
+		t.Error("SetCategories accepted a category that doesn't exist")
+	}
+	if got := names(post); len(got) != 1 || got[0] != "News" {
+		t.Errorf("after a failed SetCategories = %v, want [News]", got)
+	}
+}
+
+func testComments(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, alice, "Post")
+
+	first := addComment(t, s, post, bob, "First")
+	second := addComment(t, s, post, alice, "Second")
+	third := addComment(t, s, post, bob, "Third")
+	if _, err := s.Comments.Create(ctx, 999, bob, "Lost"); err == nil {
+		t.Error("a comment was added to a post that doesn't exist")
+	}
+
+	c, err := s.Comments.Get(ctx, first)
+	check(t, err)
+	if c.PostID != post || c.UserID != bob || c.Author != "bob" || c.Content != "First" {
+		t.Errorf("Get = %+v", c)
+	}
+	comments, err := s.Comments.ForPost(ctx, post)
+	check(t, err)
+	var ids []int
+	for _, c := range comments {
+		ids = append(ids, c.ID)
+	}
+	if want := []int{first, second, third}; !equalInts(ids, want) {
+		t.Errorf("ForPost = %v, want %v", ids, want)
+	}
+	commenters, err := s.Comments.Commenters(ctx, post)
+	check(t, err)
+	sort.Ints(commenters)
+	if want := []int{alice, bob}; !equalInts(commenters, want) {
+		t.Errorf("Commenters = %v, want %v", commenters, want)
+	}
+	if p, err := s.Posts.Get(ctx, post); err != nil || p.CommentCount != 3 {
+		t.Errorf("comment count = %d (%v), want 3", p.CommentCount, err)
+	}
+
+	check(t, s.Comments.Delete(ctx, second))
+	if _, err := s.Comments.Get(ctx, second); err != ErrNotFound {
+		t.Errorf("deleted comment: %v, want ErrNotFound", err)
+	}
+	if p, err := s.Posts.Get(ctx, post); err != nil || p.CommentCount != 2 {
+		t.Errorf("comment count after delete = %d (%v), want 2", p.CommentCount, err)
+	}
+}
+
+// wantCounts checks the like and dislike counters of a post or comment
+func wantCounts(t *testing.T, s *Store, postID, commentID int, wantLikes, wantDislikes int) {
+	t.Helper()
+	likes, dislikes, err := s.Votes.Counts(context.Background(), postID, commentID)
+	if err != nil || likes != wantLikes || dislikes != wantDislikes {
+		t.Errorf("Counts(%d, %d) = %d, %d (%v), want %d, %d", postID, commentID, likes, dislikes, err, wantLikes, wantDislikes)
+	}
+}
+
+func testVotes(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, alice, "Post")
+	comment := addComment(t, s, post, alice, "Comment")
+
+	if !vote(t, s, bob, post, 0, true) {
+		t.Error("a new like isn't set")
+	}
+	vote(t, s, alice, post, 0, true)
+	wantCounts(t, s, post, 0, 2, 0)
+	// Switching replaces the like
+	if !vote(t, s, bob, post, 0, false) {
+		t.Error("switching to dislike left no vote")
+	}
+	wantCounts(t, s, post, 0, 1, 1)
+	// Repeating retracts it
+	if vote(t, s, bob, post, 0, false) {
+		t.Error("repeating a dislike didn't retract it")
+	}
+	wantCounts(t, s, post, 0, 1, 0)
+
+	// Votes on a comment don't count towards its post
+	vote(t, s, bob, post, comment, false)
+	wantCounts(t, s, post, comment, 0, 1)
+	wantCounts(t, s, post, 0, 1, 0)
+
+	if _, _, err := s.Votes.Counts(ctx, 999, 0); err != ErrNotFound {
+		t.Errorf("Counts of a missing post: %v, want ErrNotFound", err)
+	}
+	if _, err := s.Votes.Cast(ctx, bob, 999, 0, true); err == nil {
+		t.Error("a vote was cast on a post that doesn't exist")
+	}
+}
+
+func testConcurrentVotes(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, alice, "Post")
+
+	// Double clicks and likes racing dislikes must neither fail nor leave bob with
+	// more than one vote
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(isLike bool) {
+			defer wg.Done()
+			if _, err := s.Votes.Cast(ctx, bob, post, 0, isLike); err != nil {
+				errs <- err
+			}
+		}(i%3 != 0)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent vote: %v", err)
+	}
+
+	reactions, err := s.Votes.OnPosts(ctx, []int{post})
+	check(t, err)
+	likes, dislikes, err := s.Votes.Counts(ctx, post, 0)
+	check(t, err)
+	if len(reactions) > 1 || likes+dislikes != len(reactions) {
+		t.Errorf("%d votes stored, counters say %d likes and %d dislikes", len(reactions), likes, dislikes)
+	}
+}
+
+func testReactions(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, alice, "Post")
+	comment := addComment(t, s, post, alice, "Comment")
+
+	if !react(t, s, bob, post, 0, "heart") {
+		t.Error("a new reaction wasn't added")
+	}
+	react(t, s, bob, post, 0, "wow")
+	react(t, s, alice, post, comment, "heart")
+	// Reactions sit alongside a vote
+	vote(t, s, bob, post, 0, true)
+
+	onPost, err := s.Votes.OnPosts(ctx, []int{post})
+	check(t, err)
+	var keys []string
+	for _, r := range onPost {
+		keys = append(keys, r.Key)
+	}
+	if len(onPost) != 3 || keys[0] != "heart" || keys[1] != "wow" || keys[2] != "like" || onPost[0].Username != "bob" {
+		t.Errorf("OnPosts = %+v, want heart, wow and like by bob", onPost)
+	}
+	onComment, err := s.Votes.OnComments(ctx, []int{comment})
+	check(t, err)
+	if len(onComment) != 1 || onComment[0].UserID != alice || onComment[0].CommentID != comment {
+		t.Errorf("OnComments = %+v", onComment)
+	}
+
+	if react(t, s, bob, post, 0, "heart") {
+		t.Error("toggling a reaction again added it")
+	}
+	if r, err := s.Votes.OnPosts(ctx, []int{post}); err != nil || len(r) != 2 {
+		t.Errorf("after removing heart: %+v (%v)", r, err)
+	}
+	wantCounts(t, s, post, 0, 1, 0)
+}
+
+func testReceivedVotes(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	carol := addUser(t, s, "carol")
+	post := addPost(t, s, alice, "Post")
+	comment := addComment(t, s, post, alice, "Comment")
+
+	vote(t, s, bob, post, 0, true)
+	vote(t, s, carol, post, 0, false)
+	vote(t, s, bob, post, comment, true)
+	vote(t, s, carol, post, comment, true)
+	// Self-votes and other reactions don't count
+	vote(t, s, alice, post, 0, true)
+	react(t, s, bob, post, 0, "heart")
+
+	received, err := s.Votes.Received(ctx, []int{alice, bob})
+	check(t, err)
+	sort.Slice(received, func(i, j int) bool { return !received[i].OnComment && received[j].OnComment })
+	today := time.Now().UTC().Format("2006-01-02")
+	want := []ReceivedVotes{
+		{UserID: alice, Day: today, Likes: 1, Dislikes: 1},
+		{UserID: alice, Day: today, OnComment: true, Likes: 2},
+	}
+	if len(received) != len(want) {
+		t.Fatalf("Received = %+v, want %+v", received, want)
+	}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Errorf("Received[%d] = %+v, want %+v", i, received[i], want[i])
+		}
+	}
+}
+
+func testCategories(t *testing.T, s *Store) {
+	ctx := context.Background()
+	fossils := addCategory(t, s, "Fossils")
+	art := addCategory(t, s, "Art")
+	if _, err := s.Categories.Create(ctx, "Fossils"); err == nil {
+		t.Error("a second category with the same name was created")
+	}
+
+	all, err := s.Categories.All(ctx)
+	check(t, err)
+	if len(all) != 2 || all[0] != (Category{art, "Art"}) || all[1] != (Category{fossils, "Fossils"}) {
+		t.Errorf("All = %+v, want Art and Fossils sorted by name", all)
+	}
+	allExist := []struct {
+		ids  []int
+		want bool
+	}{
+		{[]int{fossils, art}, true},
+		{[]int{fossils}, true},
+		{[]int{fossils, 999}, false},
+		{[]int{999}, false},
+	}
+	for _, a := range allExist {
+		if ok, err := s.Categories.AllExist(ctx, a.ids); err != nil || ok != a.want {
+			t.Errorf("AllExist(%v) = %v (%v), want %v", a.ids, ok, err, a.want)
+		}
+	}
+	if ok, err := s.Categories.NameExists(ctx, "fOSSILS"); err != nil || !ok {
+		t.Errorf("NameExists ignoring case = %v (%v)", ok, err)
+	}
+	if ok, err := s.Categories.NameExists(ctx, "Music"); err != nil || ok {
+		t.Errorf("NameExists(Music) = %v (%v)", ok, err)
+	}
+}
+
+func testNotifications(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, alice, "Post")
+	comment := addComment(t, s, post, bob, "Comment")
+
+	if ok, err := s.Notifications.Enabled(ctx, alice, "comment"); err != nil || !ok {
+		t.Errorf("Enabled by default = %v (%v)", ok, err)
+	}
+	before := time.Now().Add(-time.Minute)
+	check(t, s.Notifications.Create(ctx, alice, bob, "comment", post, comment))
+	check(t, s.Notifications.Create(ctx, alice, bob, "mention", post, 0))
+
+	counts := []struct {
+		name string
+		get  func() (int, error)
+		want int
+	}{
+		{"Unread(alice)", func() (int, error) { return s.Notifications.Unread(ctx, alice) }, 2},
+		{"Unread(bob)", func() (int, error) { return s.Notifications.Unread(ctx, bob) }, 0},
+		{"SentSince a minute ago", func() (int, error) { return s.Notifications.SentSince(ctx, bob, "mention", before) }, 1},
+		{"SentSince in a minute", func() (int, error) {
+			return s.Notifications.SentSince(ctx, bob, "mention", time.Now().Add(time.Minute))
+		}, 0},
+	}
+	for _, c := range counts {
+		if n, err := c.get(); err != nil || n != c.want {
+			t.Errorf("%s = %d (%v), want %d", c.name, n, err, c.want)
+		}
+	}
+
+	list, err := s.Notifications.List(ctx, alice, 10)
+	check(t, err)
+	if len(list) != 2 || list[0].Type != "mention" || list[1].CommentID != comment ||
+		list[1].Actor != "bob" || list[1].PostTitle != "Post" || list[1].Read {
+		t.Errorf("List = %+v", list)
+	}
+	if list, err := s.Notifications.List(ctx, alice, 1); err != nil || len(list) != 1 {
+		t.Errorf("List with limit 1 = %+v (%v)", list, err)
+	}
+	if _, err := s.Notifications.MarkRead(ctx, bob, list[0].ID); err != ErrNotFound {
+		t.Errorf("MarkRead of someone else's notification: %v, want ErrNotFound", err)
+	}
+	if postID, err := s.Notifications.MarkRead(ctx, alice, list[0].ID); err != nil || postID != post {
+		t.Errorf("MarkRead = %d (%v), want %d", postID, err, post)
+	}
+	if n, err := s.Notifications.Unread(ctx, alice); err != nil || n != 1 {
+		t.Errorf("Unread after MarkRead = %d (%v), want 1", n, err)
+	}
+	check(t, s.Notifications.MarkAllRead(ctx, alice))
+	if n, err := s.Notifications.Unread(ctx, alice); err != nil || n != 0 {
+		t.Errorf("Unread after MarkAllRead = %d (%v), want 0", n, err)
+	}
+
+	check(t, s.Notifications.SetPreferences(ctx, alice, map[string]bool{"comment": false, "like": true}))
+	check(t, s.Notifications.SetPreferences(ctx, alice, map[string]bool{"like": false}))
+	prefs, err := s.Notifications.Preferences(ctx, alice)
+	check(t, err)
+	if len(prefs) != 2 || prefs["comment"] || prefs["like"] {
+		t.Errorf("Preferences = %v", prefs)
+	}
+	if ok, err := s.Notifications.Enabled(ctx, alice, "comment"); err != nil || ok {
+		t.Errorf("Enabled after turning it off = %v (%v)", ok, err)
+	}
+	if ok, err := s.Notifications.Enabled(ctx, alice, "mention"); err != nil || !ok {
+		t.Errorf("Enabled for an unset type = %v (%v)", ok, err)
+	}
+}
+
+func testMentions(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	post := addPost(t, s, alice, "Post")
+	comment := addComment(t, s, post, alice, "Comment")
+
+	adds := []struct {
+		mention Mention
+		want    bool
+	}{
+		{Mention{PostID: post, UserID: bob, Username: "bob"}, true},
+		{Mention{PostID: post, UserID: bob, Username: "bob"}, false},
+		{Mention{PostID: post, CommentID: comment, UserID: bob, Username: "bob"}, true},
+	}
+	for _, a := range adds {
+		if added, err := s.Mentions.Add(ctx, a.mention); err != nil || added != a.want {
+			t.Errorf("Add(%+v) = %v (%v), want %v", a.mention, added, err, a.want)
+		}
+	}
+	check(t, s.Mentions.MarkNotified(ctx, post, comment, bob))
+
+	mentions, err := s.Mentions.ForPost(ctx, post)
+	check(t, err)
+	if len(mentions) != 2 || mentions[0] != adds[0].mention || mentions[1] != adds[2].mention {
+		t.Errorf("ForPost = %+v", mentions)
+	}
+}
+
+func testSubscriptions(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	post := addPost(t, s, alice, "Post")
+
+	check(t, s.Subscriptions.Follow(ctx, alice, post, "token-1"))
+	// Following again keeps the existing subscription
+	check(t, s.Subscriptions.Follow(ctx, alice, post, "token-2"))
+	if err := s.Subscriptions.Follow(ctx, alice, 999, "token-3"); err == nil {
+		t.Error("followed a post that doesn't exist")
+	}
+	if f, err := s.Subscriptions.Frequency(ctx, alice, post, 0); err != nil || f != "daily" {
+		t.Errorf("Frequency after Follow = %q (%v), want daily", f, err)
+	}
+}
+
+func testDigests(t *testing.T, s *Store) {
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	bob := addUser(t, s, "bob")
+	fossils := addCategory(t, s, "Fossils")
+	post := addPost(t, s, alice, "Post", fossils)
+
+	if f, err := s.Subscriptions.Frequency(ctx, alice, 0, fossils); err != nil || f != "" {
+		t.Errorf("Frequency without a subscription = %q (%v)", f, err)
+	}
+	check(t, s.Subscriptions.Subscribe(ctx, alice, post, 0, "weekly", "post-token"))
+	check(t, s.Subscriptions.Subscribe(ctx, alice, post, 0, "immediate", "ignored"))
+	check(t, s.Subscriptions.Subscribe(ctx, alice, 0, fossils, "daily", "category-token"))
+	if f, err := s.Subscriptions.Frequency(ctx, alice, post, 0); err != nil || f != "immediate" {
+		t.Errorf("Frequency after resubscribing = %q (%v), want immediate", f, err)
+	}
+
+	sub, err := s.Subscriptions.ByToken(ctx, "category-token")
+	check(t, err)
+	if sub.UserID != alice || sub.Email != "alice@example.com" || sub.CategoryID != fossils || sub.Target != "Fossils" || sub.Frequency != "daily" {
+		t.Errorf("ByToken = %+v", sub)
+	}
+	if _, err := s.Subscriptions.ByToken(ctx, "ignored"); err != ErrNotFound {
+		t.Errorf("ByToken of a replaced token: %v, want ErrNotFound", err)
+	}
+
+	// Only the immediate subscription is due until a day has passed
+	now := time.Now().Truncate(time.Second)
+	due, err := s.Subscriptions.Due(ctx, now)
+	check(t, err)
+	if len(due) != 1 || due[0].PostID != post || due[0].Target != "Post" {
+		t.Errorf("Due = %+v", due)
+	}
+	check(t, s.Subscriptions.MarkSent(ctx, sub.ID, now.AddDate(0, 0, -2)))
+	due, err = s.Subscriptions.Due(ctx, now)
+	check(t, err)
+	if len(due) != 2 {
+		t.Fatalf("Due after two days = %+v", due)
+	}
+
+	// Activity is what others did since the last digest
+	addComment(t, s, post, bob, "New comment")
+	addComment(t, s, post, alice, "Own comment")
+	addPost(t, s, bob, "New post", fossils)
+	later := now.Add(time.Minute)
+	var ids []int
+	for _, sub := range due {
+		check(t, s.Subscriptions.MarkSent(ctx, sub.ID, now.Add(-time.Hour)))
+		ids = append(ids, sub.ID)
+	}
+	activity, err := s.Subscriptions.Activity(ctx, ids, later)
+	check(t, err)
+	if len(activity) != 2 {
+		t.Errorf("Activity = %+v, want both subscriptions", activity)
+	}
+	for _, sub := range due {
+		items := activity[sub.ID]
+		if sub.PostID > 0 && (len(items) != 1 || items[0].Author != "bob" || items[0].Content != "New comment") {
+			t.Errorf("post Activity = %+v", items)
+		}
+		if sub.CategoryID > 0 && (len(items) != 1 || items[0].Title != "New post" || items[0].Author != "bob") {
+			t.Errorf("category Activity = %+v", items)
+		}
+	}
+	if activity, err := s.Subscriptions.Activity(ctx, ids, now.Add(-time.Minute)); err != nil || len(activity) != 0 {
+		t.Errorf("Activity before anything happened = %+v (%v)", activity, err)
+	}
+
+	check(t, s.Subscriptions.Unsubscribe(ctx, alice, post, 0))
+	check(t, s.Subscriptions.DeleteByToken(ctx, "category-token"))
+	if due, err := s.Subscriptions.Due(ctx, later); err != nil || len(due) != 0 {
+		t.Errorf("Due after unsubscribing = %+v (%v)", due, err)
+	}
+}
@@ -1,38 +1,46 @@
 package utils
 
 import (
-	"forum/database"
+	"forum/store"
 	"net/http"
 )
 
+// Sessions looks up login sessions; main sets it to the same store the handlers use
+var Sessions store.SessionStore
+
 // GetCurrentUser checks the session_token cookie and returns the user's id and username if logged in.
 // Returns (0, "") if not logged in or session is invalid/expired.
 func GetCurrentUser(r *http.Request) (int, string) {
-	cookie, err := r.Cookie("session_token")
+	user, err := sessionUser(r)
 	if err != nil {
 		return 0, ""
 	}
+	return user.ID, user.Username
+}
 
-	var userID int
-	var username string
-	// Join sessions and users to get username
-	err = database.DB.QueryRow(`
-		SELECT users.id, users.username
-		FROM sessions
-		JOIN users ON sessions.user_id = users.id
-		WHERE sessions.session_token = ? AND sessions.expires_at > datetime('now')
-	`, cookie.Value).Scan(&userID, &username)
+// sessionUser returns the owner of the request's session, or store.ErrNotFound if there is none
+func sessionUser(r *http.Request) (store.User, error) {
+	cookie, err := r.Cookie("session_token")
 	if err != nil {
-		return 0, ""
+		return store.User{}, store.ErrNotFound
 	}
-	return userID, username
+	return Sessions.User(r.Context(), cookie.Value)
 }
 
 // RequireAuth middleware ensures user is logged in
 func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, _ := GetCurrentUser(r)
-		if userID == 0 {
+		_, err := sessionUser(r)
+		if err != nil && err != store.ErrNotFound {
+			// Don't send people to the login page just because the database is slow
+			HandleDatabaseErrorJSON(w, r, err, "Failed to check your session")
+			return
+		}
+		if err != nil {
+			if WantsJSON(r) {
+				HandleErrorJSON(w, r, 401, "Unauthorized", "You need to log in first")
+				return
+			}
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+// CSRFCookieName is the cookie holding the double-submit CSRF token
+const CSRFCookieName = "csrf_token"
+
+// CSRFFieldName is the form field (and X-CSRF-Token header) that must echo the cookie
+const CSRFFieldName = "csrf_token"
+
+// IsSecureRequest reports whether the request reached us over HTTPS,
+// either directly or through a TLS-terminating proxy
+func IsSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// newCSRFToken generates a random 32-byte hex token
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CSRFToken returns the CSRF token for this client, issuing a new cookie if there is none yet.
+// It must be called before anything is written to the response body.
+func CSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(CSRFCookieName); err == nil && len(cookie.Value) == 64 {
+		return cookie.Value
+	}
+
+	token, err := newCSRFToken()
+	if err != nil {
+		panic(err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   IsSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// RequireCSRF middleware rejects state-changing requests whose form token
+// (or X-CSRF-Token header) does not match the csrf_token cookie
+func RequireCSRF(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(CSRFCookieName)
+		if err != nil || cookie.Value == "" {
+			HandleErrorJSON(w, r, 403, "Forbidden", "Your form has expired. Please go back, reload the page and try again.")
+			return
+		}
+
+		sent := r.Header.Get("X-CSRF-Token")
+		if sent == "" {
+			sent = r.FormValue(CSRFFieldName)
+		}
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(cookie.Value)) != 1 {
+			HandleErrorJSON(w, r, 403, "Forbidden", "Your form has expired. Please go back, reload the page and try again.")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"forum/database"
 	"html/template"
 	"log"
 	"net/http"
@@ -108,3 +109,24 @@ func HandlePanic(w http.ResponseWriter, r *http.Request) {
 		HandleError(w, 500, "Internal Server Error", "The server encountered an unexpected error")
 	}
 }
+
+// databaseError picks the status for a failed query: 504 when it ran past its deadline,
+// 503 when the database was busy or unreachable, and 500 with details for anything else
+func databaseError(err error, details string) (int, string, string) {
+	log.Printf("Database error: %v", err)
+	switch {
+	case database.IsTimeout(err):
+		return 504, "Database Timeout", "The database took too long to respond. Please try again."
+	case database.IsUnavailable(err):
+		return 503, "Database Unavailable", "The database is busy right now. Please try again in a moment."
+	default:
+		return 500, "Database Error", details
+	}
+}
+
+// HandleDatabaseError renders the error page for a failed query, with details shown
+// unless it timed out or the database was unavailable
+func HandleDatabaseError(w http.ResponseWriter, err error, details string) {
+	statusCode, message, details := databaseError(err, details)
+	HandleError(w, statusCode, message, details)
+}
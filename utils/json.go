@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// WantsJSON reports whether the client asked for a JSON response with an Accept header
+func WantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// WriteJSON sends v as a JSON response with the given status code
+func WriteJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write JSON response: %v", err)
+	}
+}
+
+// HandleErrorJSON sends an error as JSON to clients that asked for it,
+// and renders the usual error page for everyone else
+func HandleErrorJSON(w http.ResponseWriter, r *http.Request, statusCode int, message string, details string) {
+	if !WantsJSON(r) {
+		HandleError(w, statusCode, message, details)
+		return
+	}
+	log.Printf("Error %d: %s - %s", statusCode, message, details)
+	WriteJSON(w, statusCode, map[string]string{"error": message, "details": details})
+}
+
+// HandleDatabaseErrorJSON is HandleDatabaseError for endpoints that may answer in JSON
+func HandleDatabaseErrorJSON(w http.ResponseWriter, r *http.Request, err error, details string) {
+	statusCode, message, details := databaseError(err, details)
+	HandleErrorJSON(w, r, statusCode, message, details)
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// mentionRegex matches @username where the @ isn't part of a word or email address
+var mentionRegex = regexp.MustCompile(`(^|[^a-zA-Z0-9_@.-])@([a-zA-Z0-9_-]+)`)
+
+// ParseMentions returns the distinct usernames mentioned in content, in order of appearance
+func ParseMentions(content string) []string {
+	content = html.UnescapeString(content)
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range mentionRegex.FindAllStringSubmatch(content, -1) {
+		// Same length rules as registration
+		if len(m[2]) < 3 || len(m[2]) > 20 {
+			continue
+		}
+		if !seen[m[2]] {
+			seen[m[2]] = true
+			names = append(names, m[2])
+		}
+	}
+	return names
+}
+
+// RenderMentions turns stored (HTML-escaped) content into safe HTML where every
+// @name in names links to that user's profile. Everything else is escaped as text.
+func RenderMentions(content string, names map[string]bool) template.HTML {
+	content = html.UnescapeString(content)
+
+	var b strings.Builder
+	last := 0
+	for _, m := range mentionRegex.FindAllStringSubmatchIndex(content, -1) {
+		// m[4]:m[5] is the username; the @ sits just before it
+		name := content[m[4]:m[5]]
+		if !names[name] {
+			continue
+		}
+		at := m[4] - 1
+		b.WriteString(template.HTMLEscapeString(content[last:at]))
+		b.WriteString(`<a class="mention" href="/user/` + url.PathEscape(name) + `">@` + template.HTMLEscapeString(name) + `</a>`)
+		last = m[5]
+	}
+	b.WriteString(template.HTMLEscapeString(content[last:]))
+	return template.HTML(b.String())
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptMaxBytes is the most input bcrypt looks at; anything longer is silently ignored by it
+const bcryptMaxBytes = 72
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// PasswordPolicy holds the rules applied to new passwords
+type PasswordPolicy struct {
+	MinLength  int    // minimum length in characters
+	MaxLength  int    // maximum length in bytes, never above bcrypt's 72
+	BcryptCost int    // cost for new hashes; older, cheaper hashes are upgraded on login
+	BreachDir  string // optional directory of offline k-anonymity range files
+}
+
+// Policy is the active password policy, set from the environment by LoadPasswordPolicy
+var Policy = PasswordPolicy{
+	MinLength:  8,
+	MaxLength:  bcryptMaxBytes,
+	BcryptCost: bcrypt.DefaultCost,
+}
+
+var commonPasswords = map[string]bool{}
+
+func init() {
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commonPasswords[strings.ToLower(line)] = true
+	}
+}
+
+// LoadPasswordPolicy reads PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, BCRYPT_COST and
+// PASSWORD_BREACH_DIR, keeping the defaults for anything unset or invalid
+func LoadPasswordPolicy() {
+	if v, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && v > 0 {
+		Policy.MinLength = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_LENGTH")); err == nil && v > 0 {
+		if v > bcryptMaxBytes {
+			log.Printf("Warning: PASSWORD_MAX_LENGTH %d exceeds bcrypt's %d-byte limit, using %d", v, bcryptMaxBytes, bcryptMaxBytes)
+			v = bcryptMaxBytes
+		}
+		Policy.MaxLength = v
+	}
+	if Policy.MinLength > Policy.MaxLength {
+		log.Printf("Warning: PASSWORD_MIN_LENGTH %d exceeds the maximum, using %d", Policy.MinLength, Policy.MaxLength)
+		Policy.MinLength = Policy.MaxLength
+	}
+	if v, err := strconv.Atoi(os.Getenv("BCRYPT_COST")); err == nil {
+		if v < bcrypt.MinCost || v > bcrypt.MaxCost {
+			log.Printf("Warning: BCRYPT_COST %d is outside %d-%d, using %d", v, bcrypt.MinCost, bcrypt.MaxCost, Policy.BcryptCost)
+		} else {
+			Policy.BcryptCost = v
+		}
+	}
+	Policy.BreachDir = os.Getenv("PASSWORD_BREACH_DIR")
+}
+
+// CheckPassword validates a new password against the policy.
+// Returns false and a user-facing message when it's rejected.
+func CheckPassword(password string, username string, email string) (bool, string) {
+	if utf8.RuneCountInString(password) < Policy.MinLength {
+		return false, fmt.Sprintf("Password must be at least %d characters long.", Policy.MinLength)
+	}
+	if len(password) > Policy.MaxLength {
+		return false, fmt.Sprintf("Password must be no more than %d bytes long.", Policy.MaxLength)
+	}
+
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return false, "That password is too common. Please choose something harder to guess."
+	}
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return false, "Password must not contain your username."
+	}
+	if local := strings.SplitN(email, "@", 2)[0]; len(local) >= 3 && strings.Contains(lower, strings.ToLower(local)) {
+		return false, "Password must not contain your email address."
+	}
+
+	breached, err := isBreachedPassword(password)
+	if err != nil {
+		// A missing or unreadable range file must not block registration
+		log.Printf("Warning: breached password lookup failed: %v", err)
+	} else if breached {
+		return false, "That password has appeared in a data breach. Please choose a different one."
+	}
+	return true, ""
+}
+
+// isBreachedPassword looks the password up in an offline copy of a k-anonymity
+// breach corpus: one file per 5-hex-digit SHA-1 prefix (named PREFIX or PREFIX.txt),
+// each line holding the remaining 35 digits and a count as "SUFFIX:COUNT"
+func isBreachedPassword(password string) (bool, error) {
+	if Policy.BreachDir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(Policy.BreachDir, prefix+".txt"))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(Policy.BreachDir, prefix))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// HashPassword hashes a password with the policy's bcrypt cost
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), Policy.BcryptCost)
+	return string(hash), err
+}
+
+// NeedsRehash reports whether a stored hash was made with a lower cost than the policy asks for
+func NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < Policy.BcryptCost
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"os"
+	"time"
+)
+
+// exactTimeFormat is how full dates and times are shown, e.g. on hover over a relative time
+const exactTimeFormat = "January 2, 2006 15:04 MST"
+
+// DefaultLocation is the timezone for visitors who are logged out or haven't chosen one:
+// the TZ environment variable, or UTC
+var DefaultLocation = defaultLocation()
+
+func defaultLocation() *time.Location {
+	if tz := os.Getenv("TZ"); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// ValidTimezone reports whether name is an IANA timezone name such as Europe/Berlin
+func ValidTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// ViewerLocation returns the timezone chosen by the logged-in viewer, or DefaultLocation
+func ViewerLocation(r *http.Request) *time.Location {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return DefaultLocation
+	}
+	user, err := Sessions.User(r.Context(), cookie.Value)
+	if err != nil || !ValidTimezone(user.Timezone) {
+		return DefaultLocation
+	}
+	loc, _ := time.LoadLocation(user.Timezone)
+	return loc
+}
+
+// ExactTime formats t in loc, e.g. "January 2, 2006 15:04 CET". Zero times, which is what
+// unreadable timestamps scan as, show as "unknown date".
+func ExactTime(t time.Time, loc *time.Location) string {
+	if t.IsZero() {
+		return "unknown date"
+	}
+	return t.In(loc).Format(exactTimeFormat)
+}
+
+// RelativeTime describes how far t is from now, e.g. "3 hours ago" or "in 7 days"
+func RelativeTime(t, now time.Time) string {
+	if t.IsZero() {
+		return "unknown date"
+	}
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	var amount int
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		amount, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		amount, unit = int(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		amount, unit = int(d/(24*time.Hour)), "day"
+	case d < 365*24*time.Hour:
+		amount, unit = int(d/(30*24*time.Hour)), "month"
+	default:
+		amount, unit = int(d/(365*24*time.Hour)), "year"
+	}
+	if amount != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %s", amount, unit)
+	}
+	return fmt.Sprintf("%d %s ago", amount, unit)
+}
+
+// TimeHTML renders t as a <time> element reading like "3 hours ago", with the exact
+// date and time in loc shown on hover
+func TimeHTML(t time.Time, loc *time.Location) template.HTML {
+	if t.IsZero() {
+		return template.HTML(`<time>unknown date</time>`)
+	}
+	return template.HTML(fmt.Sprintf(`<time datetime="%s" title="%s">%s</time>`,
+		t.UTC().Format(time.RFC3339),
+		html.EscapeString(ExactTime(t, loc)),
+		html.EscapeString(RelativeTime(t, time.Now()))))
+}
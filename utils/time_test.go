@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		offset time.Duration // how long before now; negative is in the future
+		want   string
+	}{
+		{0, "just now"},
+		{59 * time.Second, "just now"},
+		{-59 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{2 * time.Minute, "2 minutes ago"},
+		{59*time.Minute + 59*time.Second, "59 minutes ago"},
+		{time.Hour, "1 hour ago"},
+		{23 * time.Hour, "23 hours ago"},
+		{day, "1 day ago"},
+		{29 * day, "29 days ago"},
+		{30 * day, "1 month ago"},
+		{364 * day, "12 months ago"},
+		{365 * day, "1 year ago"},
+		{3 * 365 * day, "3 years ago"},
+		{-time.Minute, "in 1 minute"},
+		{-5 * time.Hour, "in 5 hours"},
+		{-day, "in 1 day"},
+		{-7 * day, "in 7 days"},
+		{-60 * day, "in 2 months"},
+		{-2 * 365 * day, "in 2 years"},
+	}
+	for _, tt := range tests {
+		if got := RelativeTime(now.Add(-tt.offset), now); got != tt.want {
+			t.Errorf("RelativeTime(now - %v) = %q, want %q", tt.offset, got, tt.want)
+		}
+	}
+
+	if got := RelativeTime(time.Time{}, now); got != "unknown date" {
+		t.Errorf("RelativeTime(zero) = %q, want %q", got, "unknown date")
+	}
+}
+
+func TestTimeHTML(t *testing.T) {
+	if got := TimeHTML(time.Time{}, time.UTC); got != `<time>unknown date</time>` {
+		t.Errorf("TimeHTML(zero) = %s", got)
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no timezone database:", err)
+	}
+	posted := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	got := string(TimeHTML(posted, berlin))
+	for _, want := range []string{
+		`datetime="` + posted.UTC().Format(time.RFC3339) + `"`,
+		`title="` + posted.In(berlin).Format(exactTimeFormat) + `"`,
+		`>3 hours ago</time>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("TimeHTML = %s, missing %s", got, want)
+		}
+	}
+}
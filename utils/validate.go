@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DeletedUsername and DeletedEmail belong to the placeholder account anonymised content
+// is credited to. Neither passes validation, so no real user can ever claim them.
+const (
+	DeletedUsername = "[deleted]"
+	DeletedEmail    = "deleted@invalid"
+)
+
+// usernameChars are the characters a username may contain
+const usernameChars = `a-zA-Z0-9_-`
+
+var (
+	usernamePattern      = regexp.MustCompile(`^[` + usernameChars + `]+$`)
+	usernameInvalidChars = regexp.MustCompile(`[^` + usernameChars + `]+`)
+)
+
+// ValidateEmail checks if the email format is valid
+func ValidateEmail(email string) bool {
+
+	// emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+\.[a-zA-Z]{2,}$`)
+
+	// Additional checks for common invalid patterns
+	if strings.Contains(email, "..") {
+		return false
+	}
+	if strings.HasPrefix(email, ".") || strings.HasSuffix(email, ".") {
+		return false
+	}
+	if strings.Contains(email, "@.") || strings.Contains(email, ".@") {
+		return false
+	}
+
+	// Check that there's at least one dot in the domain part
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return false
+	}
+	domain := parts[1]
+	if !strings.Contains(domain, ".") {
+		return false
+	}
+
+	// Check that the domain has at least one character before the first dot
+	domainParts := strings.Split(domain, ".")
+	if len(domainParts) < 2 || domainParts[0] == "" {
+		return false
+	}
+
+	return len(email) <= 254
+}
+
+// ValidateUsername checks if username meets requirements: 3-20 letters, numbers,
+// underscores and hyphens
+func ValidateUsername(username string) (bool, string) {
+	if len(username) < 3 {
+		return false, "Username must be at least 3 characters long."
+	}
+	if len(username) > 20 {
+		return false, "Username must be no more than 20 characters long."
+	}
+	if !usernamePattern.MatchString(username) {
+		return false, "Username can only contain letters, numbers, underscores, and hyphens."
+	}
+	return true, ""
+}
+
+// UsernameBase turns name into a valid username of at most 16 characters, leaving room
+// for a number to make it unique: "Jane Doe" becomes "JaneDoe", and a name with nothing
+// usable becomes "user"
+func UsernameBase(name string) string {
+	base := usernameInvalidChars.ReplaceAllString(name, "")
+	if len(base) > 16 {
+		base = base[:16]
+	}
+	if base == "" {
+		base = "user"
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+	return base
+}
@@ -0,0 +1,68 @@
+package utils
+
+import "testing"
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"rex@example.com", true},
+		{"t.rex+forum@mail.example.org", true},
+		{"", false},
+		{"rex", false},
+		{"rex@localhost", false},
+		{"rex@home@example.com", false},
+		{"rex@.example.com", false},
+		{"rex.@example.com", false},
+		{"rex@example..com", false},
+		{"rex@example.com.", false},
+	}
+	for _, tt := range tests {
+		if got := ValidateEmail(tt.email); got != tt.want {
+			t.Errorf("ValidateEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		want     bool
+	}{
+		{"rex", true},
+		{"T-Rex_2024", true},
+		{"abcdefghijklmnopqrst", true},
+		{"re", false},
+		{"abcdefghijklmnopqrstu", false},
+		{"t rex", false},
+		{"rëx", false},
+	}
+	for _, tt := range tests {
+		if got, msg := ValidateUsername(tt.username); got != tt.want || (got == (msg != "")) {
+			t.Errorf("ValidateUsername(%q) = %v, %q, want %v", tt.username, got, msg, tt.want)
+		}
+	}
+}
+
+func TestUsernameBase(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"rex", "rex"},
+		{"Jane Doe", "JaneDoe"},
+		{"jane.doe+forum", "janedoeforum"},
+		{"a", "a__"},
+		{"!!!", "user"},
+		{"averyveryverylongusername", "averyveryverylon"},
+	}
+	for _, tt := range tests {
+		got := UsernameBase(tt.name)
+		if got != tt.want {
+			t.Errorf("UsernameBase(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if valid, _ := ValidateUsername(got); !valid {
+			t.Errorf("UsernameBase(%q) = %q, which isn't a valid username", tt.name, got)
+		}
+	}
+}